@@ -0,0 +1,190 @@
+/*
+Package apperrors holds the errors returned by the
+packages of gURL. Each type represents a category of
+failure, so the caller (e.g. cmd/main.go) can decide
+what to do with it with errors.As, e.g. the exit code.
+*/
+package apperrors
+
+import (
+	"fmt"
+	"time"
+)
+
+// Invalid flags or combination of flags
+type UsageError struct {
+	Reason string
+}
+
+func (e UsageError) Error() string {
+	return e.Reason
+}
+
+// The URL (domain) given by the user or in a
+// Location header could not be parsed.
+type URLError struct {
+	URL    string
+	Reason string
+}
+
+func (e URLError) Error() string {
+	return fmt.Sprintf("invalid url %q: %s", e.URL, e.Reason)
+}
+
+// Response codes (RCODE) of a DNS response header
+const (
+	RCodeNoError uint8 = iota
+	RCodeFormErr
+	RCodeServFail
+	RCodeNXDomain
+	RCodeNotImp
+	RCodeRefused
+)
+
+var rcodeNames = map[uint8]string{
+	RCodeNoError:  "NOERROR",
+	RCodeFormErr:  "FORMERR",
+	RCodeServFail: "SERVFAIL",
+	RCodeNXDomain: "NXDOMAIN",
+	RCodeNotImp:   "NOTIMP",
+	RCodeRefused:  "REFUSED",
+}
+
+func RCodeName(rcode uint8) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("RCODE(%d)", rcode)
+}
+
+/*
+The domain could not be resolved. RCode is set when
+the DNS server answered with an error (e.g. NXDOMAIN
+for a domain that does not exist). Otherwise Err
+shows why (e.g. no address in the answer).
+*/
+type DNSError struct {
+	Domain string
+	RCode  uint8
+	Err    error
+}
+
+func (e DNSError) Error() string {
+	if e.RCode != RCodeNoError {
+		return fmt.Sprintf("could not resolve %s: %s", e.Domain, RCodeName(e.RCode))
+	}
+	return fmt.Sprintf("could not resolve %s: %v", e.Domain, e.Err)
+}
+
+func (e DNSError) Unwrap() error {
+	return e.Err
+}
+
+// TCP connection to Addr (the server or the
+// proxy) could not be opened.
+type ConnectError struct {
+	Addr string
+	Err  error
+}
+
+func (e ConnectError) Error() string {
+	return fmt.Sprintf("could not connect to %s: %v", e.Addr, e.Err)
+}
+
+func (e ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// The proxy refused to open the connection
+// to the target or failed its handshake.
+type ProxyError struct {
+	Proxy string
+	Err   error
+}
+
+func (e ProxyError) Error() string {
+	return fmt.Sprintf("proxy %s: %v", e.Proxy, e.Err)
+}
+
+func (e ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// TLS handshake failed, e.g. the certificate of
+// the server could not be verified.
+type TLSError struct {
+	ServerName string
+	Err        error
+}
+
+func (e TLSError) Error() string {
+	return fmt.Sprintf("TLS handshake with %s failed: %v", e.ServerName, e.Err)
+}
+
+func (e TLSError) Unwrap() error {
+	return e.Err
+}
+
+// The server sent something the protocol
+// (HTTP/1.1, HTTP/2 or WebSocket) does not allow.
+type ProtocolError struct {
+	Protocol string
+	Err      error
+}
+
+func (e ProtocolError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Protocol, e.Err)
+}
+
+func (e ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// Implements net.Error so it's treated the
+// same as other network timeouts.
+type TimeoutError struct {
+	Phase string
+	After time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("%s timeout after %s", e.Phase, e.After)
+}
+
+func (e TimeoutError) Timeout() bool   { return true }
+func (e TimeoutError) Temporary() bool { return true }
+
+type TooManyRedirectsError struct {
+	Max int
+}
+
+func (e TooManyRedirectsError) Error() string {
+	return fmt.Sprintf("maximum (%d) redirects followed", e.Max)
+}
+
+/*
+A WebSocket session ended with a close code other
+than 1000 (normal closure). Code is 1006 if the
+connection was closed without a close frame.
+*/
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e WebSocketCloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed with code %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+// Messages of the server didn't match what the
+// WebSocket script expected (-expect, -ws-count).
+type ExpectationError struct {
+	Reason string
+}
+
+func (e ExpectationError) Error() string {
+	return "expectation failed: " + e.Reason
+}
@@ -1,12 +1,15 @@
 package cli
 
 import (
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/saeidalz13/gurl/api/apperrors"
 	"github.com/saeidalz13/gurl/internal/httpconstants"
 )
 
-func TestMustDetermineDataInfo(t *testing.T) {
+func TestDetermineDataInfo(t *testing.T) {
 	tests := []struct {
 		expectedDataType uint8
 		name             string
@@ -21,7 +24,10 @@ func TestMustDetermineDataInfo(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			dataType, data := mustDetermineDataInfo(&test.jsonPtr, &test.textPtr)
+			dataType, data, err := determineDataInfo(&test.jsonPtr, &test.textPtr)
+			if err != nil {
+				t.Fatal(err)
+			}
 
 			if dataType != test.expectedDataType {
 				t.Fatalf("expected data type:%d\tgot:%d\t", test.expectedDataType, dataType)
@@ -33,3 +39,266 @@ func TestMustDetermineDataInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestDetermineHTTPVersion(t *testing.T) {
+	tests := []struct {
+		name                string
+		http1               bool
+		http2               bool
+		http2PriorKnowledge bool
+		expectedVersion     uint8
+	}{
+		{name: "negotiate_by_default", expectedVersion: httpconstants.HTTPVersionNegotiate},
+		{name: "http1_only", http1: true, expectedVersion: httpconstants.HTTPVersion1_1},
+		{name: "http2_only", http2: true, expectedVersion: httpconstants.HTTPVersion2},
+		{name: "http2_prior_knowledge", http2PriorKnowledge: true, expectedVersion: httpconstants.HTTPVersion2PriorKnowledge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version, err := determineHTTPVersion(&test.http1, &test.http2, &test.http2PriorKnowledge)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if version != test.expectedVersion {
+				t.Fatalf("expected version:%d\tgot:%d\t", test.expectedVersion, version)
+			}
+		})
+	}
+}
+
+func TestDetermineAuthInfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		user        string
+		bearer      string
+		digest      bool
+		expectedErr bool
+		expected    authInfo
+	}{
+		{name: "no_auth", expected: authInfo{}},
+		{name: "basic", user: "bob:pa:ss", expected: authInfo{scheme: httpconstants.AuthSchemeBasic, user: "bob", password: "pa:ss"}},
+		{name: "digest", user: "bob:pass", digest: true, expected: authInfo{scheme: httpconstants.AuthSchemeDigest, user: "bob", password: "pass"}},
+		{name: "bearer", bearer: "token", expected: authInfo{scheme: httpconstants.AuthSchemeBearer, bearerToken: "token"}},
+		{name: "user_and_bearer", user: "bob:pass", bearer: "token", expectedErr: true},
+		{name: "digest_without_user", digest: true, expectedErr: true},
+		{name: "no_password_separator", user: "bob", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auth, err := determineAuthInfo(&test.user, &test.bearer, &test.digest)
+			if test.expectedErr {
+				var usageErr apperrors.UsageError
+				if !errors.As(err, &usageErr) {
+					t.Fatalf("expected usage error\tgot: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if auth != test.expected {
+				t.Fatalf("expected auth:%+v\tgot:%+v\t", test.expected, auth)
+			}
+		})
+	}
+}
+
+func TestValidateOutput(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		verbose     bool
+		writeOut    string
+		expectedErr bool
+	}{
+		{name: "default", output: ""},
+		{name: "json", output: "json"},
+		{name: "default_with_verbose", output: "", verbose: true, writeOut: "%{http_code}"},
+		{name: "unknown_format", output: "yaml", expectedErr: true},
+		{name: "json_with_verbose", output: "json", verbose: true, expectedErr: true},
+		{name: "json_with_write_out", output: "json", writeOut: "%{http_code}", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateOutput(test.output, test.verbose, test.writeOut)
+
+			var usageErr apperrors.UsageError
+			if test.expectedErr && !errors.As(err, &usageErr) {
+				t.Fatalf("expected usage error\tgot: %v", err)
+			}
+			if !test.expectedErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDetermineOutput(t *testing.T) {
+	tests := []struct {
+		name           string
+		output         string
+		remoteName     bool
+		resumeFrom     string
+		expectedFormat string
+		expectedFile   string
+		expectedErr    bool
+	}{
+		{name: "default"},
+		{name: "json", output: "json", expectedFormat: "json"},
+		{name: "file", output: "out.bin", expectedFile: "out.bin"},
+		{name: "file_named_json", output: "./json", expectedFile: "./json"},
+		{name: "remote_name", remoteName: true},
+		{name: "resume_file", output: "out.bin", resumeFrom: "-", expectedFile: "out.bin"},
+		{name: "resume_remote_name", remoteName: true, resumeFrom: "-"},
+		{name: "both_o_and_O", output: "out.bin", remoteName: true, expectedErr: true},
+		{name: "resume_without_file", resumeFrom: "-", expectedErr: true},
+		{name: "resume_with_json", output: "json", resumeFrom: "-", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, file, err := determineOutput(test.output, test.remoteName, test.resumeFrom)
+
+			var usageErr apperrors.UsageError
+			if test.expectedErr {
+				if !errors.As(err, &usageErr) {
+					t.Fatalf("expected usage error\tgot: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if format != test.expectedFormat || file != test.expectedFile {
+				t.Fatalf("expected: %q %q\tgot: %q %q", test.expectedFormat, test.expectedFile, format, file)
+			}
+		})
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "spaced", header: "X-Api-Key: abc", expected: "X-Api-Key: abc"},
+		{name: "no_space", header: "X-Api-Key:abc", expected: "X-Api-Key: abc"},
+		{name: "colon_in_value", header: "Origin: https://example.com", expected: "Origin: https://example.com"},
+		{name: "empty_value", header: "X-Empty:", expected: "X-Empty: "},
+		{name: "no_colon", header: "X-Api-Key abc", expectedErr: true},
+		{name: "no_name", header: ": abc", expectedErr: true},
+		{name: "space_in_name", header: "X Api: abc", expectedErr: true},
+		{name: "new_line", header: "X-Api-Key: abc\r\nHost: evil", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseHeader(test.header)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", test.header)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestDetermineWsScript(t *testing.T) {
+	tests := []struct {
+		name          string
+		send          string
+		ndjson        bool
+		count         int
+		match         string
+		expect        string
+		timeout       time.Duration
+		expectedNil   bool
+		expectedCount int
+		expectedErr   bool
+	}{
+		{name: "interactive", expectedNil: true},
+		{name: "send", send: "-"},
+		{name: "send_ndjson", send: "in.ndjson", ndjson: true},
+		{name: "count", count: 3, expectedCount: 3},
+		{name: "match", match: "^done$"},
+		{name: "expect_one", expect: "ok", expectedCount: 1},
+		{name: "expect_count", expect: "ok", count: 2, expectedCount: 2},
+		{name: "ndjson_without_send", ndjson: true, expectedErr: true},
+		{name: "negative_count", count: -1, expectedErr: true},
+		{name: "negative_timeout", send: "-", timeout: -time.Second, expectedErr: true},
+		{name: "match_and_expect", match: "a", expect: "b", expectedErr: true},
+		{name: "match_and_count", match: "a", count: 2, expectedErr: true},
+		{name: "invalid_regex", expect: "(", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := determineWsScript(test.send, test.ndjson, test.count, test.match, test.expect, test.timeout)
+
+			var usageErr apperrors.UsageError
+			if test.expectedErr {
+				if !errors.As(err, &usageErr) {
+					t.Fatalf("expected usage error\tgot: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.expectedNil {
+				if got != nil {
+					t.Fatalf("expected: nil\tgot: %+v", got)
+				}
+				return
+			}
+			if got == nil || got.Count != test.expectedCount || got.Send != test.send {
+				t.Fatalf("expected: count %d send %q\tgot: %+v", test.expectedCount, test.send, got)
+			}
+		})
+	}
+}
+
+func TestValidateWsReplay(t *testing.T) {
+	tests := []struct {
+		name        string
+		replay      string
+		speed       float64
+		script      *WsScriptParams
+		expectedErr bool
+	}{
+		{name: "none", speed: 1},
+		{name: "replay", replay: "session.ndjson", speed: 1},
+		{name: "without_waiting", replay: "session.ndjson", speed: 0},
+		{name: "negative_speed", replay: "session.ndjson", speed: -1, expectedErr: true},
+		{name: "with_script", replay: "session.ndjson", speed: 1, script: &WsScriptParams{Count: 1}, expectedErr: true},
+		{name: "script_only", speed: 1, script: &WsScriptParams{Count: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateWsReplay(test.replay, test.speed, test.script)
+
+			var usageErr apperrors.UsageError
+			if test.expectedErr != errors.As(err, &usageErr) {
+				t.Fatalf("expected: usage error %v\tgot: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
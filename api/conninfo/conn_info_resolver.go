@@ -1,6 +1,7 @@
 package conninfo
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -8,10 +9,11 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/saeidalz13/gurl/api/apperrors"
 	"github.com/saeidalz13/gurl/api/dns"
 	"github.com/saeidalz13/gurl/internal/domainparser"
-	"github.com/saeidalz13/gurl/internal/errutils"
 	"github.com/saeidalz13/gurl/internal/httpconstants"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
 	"github.com/saeidalz13/gurl/models"
 )
 
@@ -94,39 +96,89 @@ func (c ConnInfoResolver) cacheDomainIp(ipStr string) error {
 	return os.WriteFile(domainFile, []byte(ipStr), 0o600)
 }
 
-// bool shows if the connection should be TLS
-func (c ConnInfoResolver) Resolve() models.ConnInfo {
+// Localhost domains must include the port
+func (c ConnInfoResolver) localhostPort() (int, error) {
+	port, err := c.extractPort()
+	if err != nil {
+		return 0, apperrors.URLError{URL: c.domain, Reason: err.Error()}
+	}
+	return port, nil
+}
+
+/*
+IP of the domain from the cache of previous runs or
+a DNS query. The IP is cached for the next runs unless
+ipCacheDir is empty.
+*/
+func (c ConnInfoResolver) LookupIP(ctx context.Context) (net.IP, uint8, error) {
 	if c.isDomainLocalHost() {
-		ip := net.IPv4(127, 0, 0, 1)
-		port, err := c.extractPort()
-		errutils.CheckErr(err)
-
-		return models.ConnInfo{
-			IP:     ip,
-			IPType: dns.IpTypeV4,
-			Port:   port,
-			IsTls:  false,
+		return net.IPv4(127, 0, 0, 1), dns.IpTypeV4, nil
+	}
+
+	if ip := net.ParseIP(c.domain); ip != nil {
+		if ip.To4() != nil {
+			return ip.To4(), dns.IpTypeV4, nil
 		}
+		return ip, dns.IpTypeV6, nil
 	}
 
-	ip, ipType, err := c.fetchCachedIp()
+	if c.ipCacheDir != "" {
+		if ip, ipType, err := c.fetchCachedIp(); err == nil {
+			return ip, ipType, nil
+		}
+	}
+
+	ip, ipType, err := dns.ResolveIP(ctx, c.domainSegments)
 	if err != nil {
-		ip, ipType = dns.MustResolveIP(c.domainSegments)
+		return nil, 0, err
+	}
+
+	if c.ipCacheDir != "" {
 		if err := c.cacheDomainIp(ip.String()); err != nil {
 			// Should not stop the operation
-			fmt.Printf("skipped ip caching: %v\n", err)
+			terminalutils.PrintAppWarning(fmt.Sprintf("skipped ip caching: %v", err))
+		}
+	}
+
+	return ip, ipType, nil
+}
+
+/*
+Port and TLS of the connection. Behind a proxy it's
+all that is needed since the proxy resolves the domain.
+
+The port of the domain is used if it has one, otherwise
+the default of the protocol: 80 for http:// and ws://,
+443 for https:// and wss://. ws:// and wss:// decide
+TLS for every host; localhost is connected without TLS
+for HTTP, since a domain without protocol is HTTPS.
+*/
+func (c ConnInfoResolver) ResolveWithoutIP() (models.ConnInfo, error) {
+	isWebSocket := domainparser.IsWebSocket(c.protocol)
+
+	if c.isDomainLocalHost() && !isWebSocket {
+		port, err := c.localhostPort()
+		if err != nil {
+			return models.ConnInfo{}, err
 		}
+
+		return models.ConnInfo{Port: port, IsTls: false}, nil
 	}
 
-	port := httpconstants.PortHTTPS
-	if c.protocol == domainparser.ProtocolHTTP {
-		port = httpconstants.PortHTTP
+	isTls := c.protocol == domainparser.ProtocolHTTPS || c.protocol == domainparser.ProtocolWSS
+
+	port := httpconstants.PortHTTP
+	if isTls {
+		port = httpconstants.PortHTTPS
 	}
 
-	return models.ConnInfo{
-		IP:     ip,
-		IPType: ipType,
-		Port:   port,
-		IsTls:  c.protocol == domainparser.ProtocolHTTPS,
+	if _, portStr, err := net.SplitHostPort(c.domain); err == nil {
+		explicitPort, err := strconv.Atoi(portStr)
+		if err != nil || explicitPort < 1 || explicitPort > 65535 {
+			return models.ConnInfo{}, apperrors.URLError{URL: c.domain, Reason: fmt.Sprintf("invalid port %q", portStr)}
+		}
+		port = explicitPort
 	}
+
+	return models.ConnInfo{Port: port, IsTls: isTls}, nil
 }
@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/saeidalz13/gurl/api/dns"
+	"github.com/saeidalz13/gurl/internal/domainparser"
+	"github.com/saeidalz13/gurl/models"
 )
 
 var testCir = ConnInfoResolver{}
@@ -118,3 +120,45 @@ func TestCacheIP(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestResolveWithoutIP(t *testing.T) {
+	tests := []struct {
+		name        string
+		domain      string
+		protocol    uint8
+		expected    models.ConnInfo
+		expectedErr bool
+	}{
+		{name: "http_default_port", domain: "example.com", protocol: domainparser.ProtocolHTTP, expected: models.ConnInfo{Port: 80}},
+		{name: "https_default_port", domain: "example.com", protocol: domainparser.ProtocolHTTPS, expected: models.ConnInfo{Port: 443, IsTls: true}},
+		{name: "ws_default_port", domain: "example.com", protocol: domainparser.ProtocolWS, expected: models.ConnInfo{Port: 80}},
+		{name: "wss_default_port", domain: "example.com", protocol: domainparser.ProtocolWSS, expected: models.ConnInfo{Port: 443, IsTls: true}},
+		{name: "https_explicit_port", domain: "example.com:8443", protocol: domainparser.ProtocolHTTPS, expected: models.ConnInfo{Port: 8443, IsTls: true}},
+		{name: "ws_explicit_port", domain: "example.com:8080", protocol: domainparser.ProtocolWS, expected: models.ConnInfo{Port: 8080}},
+		{name: "wss_explicit_port", domain: "example.com:9443", protocol: domainparser.ProtocolWSS, expected: models.ConnInfo{Port: 9443, IsTls: true}},
+		{name: "localhost_https", domain: "localhost:8080", protocol: domainparser.ProtocolHTTPS, expected: models.ConnInfo{Port: 8080}},
+		{name: "localhost_without_port", domain: "localhost", protocol: domainparser.ProtocolHTTPS, expectedErr: true},
+		{name: "localhost_ws", domain: "localhost", protocol: domainparser.ProtocolWS, expected: models.ConnInfo{Port: 80}},
+		{name: "localhost_wss", domain: "127.0.0.1:8443", protocol: domainparser.ProtocolWSS, expected: models.ConnInfo{Port: 8443, IsTls: true}},
+		{name: "invalid_port", domain: "example.com:99999", protocol: domainparser.ProtocolWS, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := NewConnInfoResolver("", test.domain, nil, test.protocol).ResolveWithoutIP()
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for %s", test.domain)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Port != test.expected.Port || got.IsTls != test.expected.IsTls {
+				t.Fatalf("expected: %+v\tgot: %+v", test.expected, got)
+			}
+		})
+	}
+}
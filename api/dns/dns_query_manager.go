@@ -1,7 +1,7 @@
 package dns
 
 import (
-	"log"
+	"errors"
 	"math/rand"
 	"strings"
 )
@@ -77,17 +77,18 @@ func (d *DNSQueryManager) setHeader() {
 	d.setNumOfAdditionalRRs()
 }
 
-func (d *DNSQueryManager) setQuestionName() {
+func (d *DNSQueryManager) setQuestionName() error {
 	for _, part := range d.domainSegments {
 		part = strings.TrimSpace(part)
 		if len(part) == 0 {
-			log.Fatalln("invalid input domain")
+			return errors.New("invalid input domain")
 		}
 		// Each label prefixed by a length byte, followed by the label itself
 		d.query = append(d.query, byte(len(part)))
 		d.query = append(d.query, []byte(part)...)
 	}
 	d.query = append(d.query, 0b00000000) // To show that this is end of the domain
+	return nil
 }
 
 // Type A (host address) - 2 bytes (A, AAAA, MX, etc.)
@@ -106,15 +107,18 @@ func (d *DNSQueryManager) setQuestionClass() {
 	d.query = append(d.query, 0b00000000, 0b00000001)
 }
 
-func (d *DNSQueryManager) setQuestion() {
-	d.setQuestionName()
+func (d *DNSQueryManager) setQuestion() error {
+	if err := d.setQuestionName(); err != nil {
+		return err
+	}
 	d.setQuestionType()
 	d.setQuestionClass()
+	return nil
 }
 
-func (d *DNSQueryManager) prepareQuery() {
+func (d *DNSQueryManager) prepareQuery() error {
 	d.setHeader()
-	d.setQuestion()
+	return d.setQuestion()
 }
 
 func (d *DNSQueryManager) toggleQuestionType(ipType uint8) {
@@ -1,55 +1,81 @@
 package dns
 
 import (
+	"context"
+	"errors"
 	"net"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/saeidalz13/gurl/internal/errutils"
+	"github.com/saeidalz13/gurl/api/apperrors"
 	"github.com/saeidalz13/gurl/internal/terminalutils"
 )
 
+// UDP does not tell if the query was lost,
+// so the response is only waited this long.
+const dnsTimeout = 5 * time.Second
+
 // Fetch the domain IPv4 from 8.8.8.8 (Google server).
-// Average time is 25 ms.
-func MustResolveIP(domainSegments []string) (net.IP, uint8) {
+// Average time is 25 ms. Cancelling ctx stops waiting
+// for the response.
+func ResolveIP(ctx context.Context, domainSegments []string) (net.IP, uint8, error) {
+	domain := strings.Join(domainSegments, ".")
 	ipType := IpTypeV4
+
+	dqm := NewDNSQueryManager(domainSegments, ipType)
+	if err := dqm.prepareQuery(); err != nil {
+		return nil, 0, apperrors.URLError{URL: domain, Reason: err.Error()}
+	}
+
 	udpConn, err := net.DialUDP("udp", nil, &net.UDPAddr{Port: 53, IP: net.IPv4(8, 8, 8, 8)})
-	errutils.CheckErr(err)
+	if err != nil {
+		return nil, 0, apperrors.DNSError{Domain: domain, Err: err}
+	}
 	defer udpConn.Close()
 
-	dqm := NewDNSQueryManager(domainSegments, ipType)
-	dqm.prepareQuery()
+	// Closing the conn unblocks the read
+	stop := context.AfterFunc(ctx, func() { udpConn.Close() })
+	defer stop()
 
-dnsLoop:
 	for {
-		_, err = udpConn.Write(dqm.Query())
-		errutils.CheckErr(err)
+		if _, err := udpConn.Write(dqm.Query()); err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			return nil, 0, apperrors.DNSError{Domain: domain, Err: err}
+		}
 
 		// DNS responses are small, 256 bytes is enough. Especially that
 		// I only have one question per request.
 		response := make([]byte, 256)
-		_, _, err = udpConn.ReadFrom(response)
-		errutils.CheckErr(err)
-
-		ip, err := NewDNSResponseParser(response, ipType).Parse()
-		if err != nil {
-			switch err.Error() {
-			case "no ipv4":
-				ipType = IpTypeV6
-				dqm.toggleQuestionType(ipType)
-
-				terminalutils.PrintAppWarning("ipv4 could not fetched. attempting for ipv6...")
-				continue dnsLoop
-
-			case "no ipv6":
-				terminalutils.PrintAppError("could not fetch ip from DNS")
-				os.Exit(1)
-
-			default:
-				terminalutils.PrintAppError(err.Error())
-				os.Exit(1)
+		udpConn.SetReadDeadline(time.Now().Add(dnsTimeout))
+		if _, _, err := udpConn.ReadFrom(response); err != nil {
+			if ctx.Err() != nil {
+				return nil, 0, ctx.Err()
+			}
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil, 0, apperrors.TimeoutError{Phase: "DNS", After: dnsTimeout}
 			}
+			return nil, 0, apperrors.DNSError{Domain: domain, Err: err}
 		}
 
-		return ip, ipType
+		ip, rcode, err := NewDNSResponseParser(response, ipType).Parse()
+		switch {
+		case err == nil:
+			return ip, ipType, nil
+
+		case errors.Is(err, errNoIPv4):
+			ipType = IpTypeV6
+			dqm.toggleQuestionType(ipType)
+
+			terminalutils.PrintAppWarning("ipv4 could not fetched. attempting for ipv6...")
+
+		case errors.Is(err, errNoIPv6):
+			return nil, 0, apperrors.DNSError{Domain: domain, Err: errors.New("no ipv4 or ipv6 address found")}
+
+		default:
+			return nil, 0, apperrors.DNSError{Domain: domain, RCode: rcode, Err: err}
+		}
 	}
 }
@@ -2,10 +2,16 @@ package dns
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 )
 
+var (
+	errNoIPv4 = errors.New("no ipv4")
+	errNoIPv6 = errors.New("no ipv6")
+)
+
 /*
 DNS Response:
 * Header
@@ -46,6 +52,12 @@ func NewDNSResponseParser(response []byte, iptype uint8) DNSResponseParser {
 	}
 }
 
+// RCODE is the lower 4 bits of the second flags
+// byte. Zero means no error.
+func (drp DNSResponseParser) rcode() uint8 {
+	return drp.response[3] & 0x0F
+}
+
 func (drp *DNSResponseParser) isAnswerAvailable() bool {
 	anCount := binary.BigEndian.Uint16(drp.response[6:8])
 	return anCount != 0
@@ -77,9 +89,25 @@ func (drp *DNSResponseParser) determineDataLength() uint16 {
 	return binary.BigEndian.Uint16(drp.response[drp.pos-2 : drp.pos])
 }
 
-func (drp DNSResponseParser) Parse() (net.IP, error) {
+// RCODE of the response is returned along with the
+// error when the server could not answer the query.
+func (drp DNSResponseParser) Parse() (net.IP, uint8, error) {
+	if len(drp.response) < startingQueryIdx {
+		return nil, 0, fmt.Errorf("dns response too short")
+	}
+
+	if rcode := drp.rcode(); rcode != 0 {
+		return nil, rcode, fmt.Errorf("dns server responded with RCODE %d", rcode)
+	}
+
+	// A domain may only have one of IPv4 and IPv6
+	// addresses, so no answer is the same as an
+	// answer without the address.
 	if !drp.isAnswerAvailable() {
-		return nil, fmt.Errorf("no answer received from 8.8.8.8 server")
+		if drp.iptype == IpTypeV4 {
+			return nil, 0, errNoIPv4
+		}
+		return nil, 0, errNoIPv6
 	}
 
 	drp.determineIdxAfterQuery()
@@ -88,17 +116,17 @@ func (drp DNSResponseParser) Parse() (net.IP, error) {
 	switch drp.iptype {
 	case IpTypeV4:
 		if dataLength != 4 {
-			return nil, fmt.Errorf("no ipv4")
+			return nil, 0, errNoIPv4
 		}
 		ip := net.IPv4(drp.response[drp.pos], drp.response[drp.pos+1], drp.response[drp.pos+2], drp.response[drp.pos+3])
-		return ip, nil
+		return ip, 0, nil
 	case IpTypeV6:
 		if dataLength != 16 {
-			return nil, fmt.Errorf("no ipv6")
+			return nil, 0, errNoIPv6
 		}
 		ip := net.IP(drp.response[drp.pos : drp.pos+16])
-		return ip, nil
+		return ip, 0, nil
 	default:
-		return nil, fmt.Errorf("unsupported IP type")
+		return nil, 0, fmt.Errorf("unsupported IP type")
 	}
 }
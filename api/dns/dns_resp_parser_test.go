@@ -0,0 +1,74 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+// Response to an A query for "a.io" with the given
+// RCODE and, if not nil, one answer with the ip.
+func testDNSResponse(rcode uint8, ip net.IP) []byte {
+	response := []byte{
+		0x12, 0x34, // ID
+		0x81, 0x80 | rcode, // QR, RD, RA and RCODE
+		0x00, 0x01, // questions
+		0x00, 0x00, // answers
+		0x00, 0x00, 0x00, 0x00, // authority and additional RRs
+		0x01, 'a', 0x02, 'i', 'o', 0x00, // name
+		0x00, 0x01, 0x00, 0x01, // type A, class IN
+	}
+
+	if ip != nil {
+		response[7] = 0x01
+		response = append(response,
+			0xc0, 0x0c, // pointer to the name of the question
+			0x00, 0x01, 0x00, 0x01, // type A, class IN
+			0x00, 0x00, 0x00, 0x3c, // TTL
+			0x00, 0x04, // data length
+		)
+		response = append(response, ip.To4()...)
+	}
+
+	return response
+}
+
+func TestDNSResponseParserParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		response      []byte
+		expectedIP    net.IP
+		expectedRCode uint8
+		expectedErr   error
+	}{
+		{name: "answer", response: testDNSResponse(0, net.IPv4(93, 184, 216, 34)), expectedIP: net.IPv4(93, 184, 216, 34)},
+		{name: "no_answer", response: testDNSResponse(0, nil), expectedErr: errNoIPv4},
+		{name: "nxdomain", response: testDNSResponse(3, nil), expectedRCode: 3},
+		{name: "servfail", response: testDNSResponse(2, nil), expectedRCode: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ip, rcode, err := NewDNSResponseParser(test.response, IpTypeV4).Parse()
+
+			if rcode != test.expectedRCode {
+				t.Fatalf("expected rcode: %d\tgot: %d", test.expectedRCode, rcode)
+			}
+
+			if test.expectedErr != nil && !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected err: %v\tgot: %v", test.expectedErr, err)
+			}
+
+			if test.expectedIP == nil {
+				if err == nil {
+					t.Fatalf("expected error\tgot ip: %v", ip)
+				}
+				return
+			}
+
+			if err != nil || !ip.Equal(test.expectedIP) {
+				t.Fatalf("expected ip: %v\tgot: %v (%v)", test.expectedIP, ip, err)
+			}
+		})
+	}
+}
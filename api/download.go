@@ -0,0 +1,315 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+)
+
+// Used by -O if the URL has no file name
+const defaultDownloadName = "index.html"
+
+// Progress is printed at most this often
+const progressInterval = 100 * time.Millisecond
+
+// -C takes "-" to continue from the size of the file
+const resumeFromFileSize = "-"
+
+func headerValue(headers []string, name string) string {
+	for _, header := range headers {
+		headerName, value, found := strings.Cut(header, ":")
+		if found && strings.EqualFold(strings.TrimSpace(headerName), name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// Last segment of the path without the query,
+// e.g. "example.com/files/a.zip?v=2" -> "a.zip"
+func fileNameFromURL(rawURL string) string {
+	rawURL, _, _ = strings.Cut(rawURL, "?")
+	rawURL, _, _ = strings.Cut(rawURL, "#")
+	_, urlPath, found := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(rawURL, "http://"), "https://"), "/")
+	if !found {
+		return ""
+	}
+	return sanitizeFileName(path.Base("/" + urlPath))
+}
+
+/*
+Name given by the server, e.g.
+
+	Content-Disposition: attachment; filename="report.pdf"
+
+"filename*" (RFC 5987, for non-ASCII names) is decoded
+by the mime package and preferred over "filename".
+*/
+func fileNameFromContentDisposition(contentDisposition string) string {
+	_, params, err := mime.ParseMediaType(contentDisposition)
+	if err != nil {
+		return ""
+	}
+	return sanitizeFileName(params["filename"])
+}
+
+// The name comes from the server, so any directory
+// in it is dropped (e.g. "../../.bashrc" -> ".bashrc").
+func sanitizeFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+/*
+e.g. "bytes 100-999/1000" -> 100, 1000. Total is
+-1 if it's unknown ("bytes 100-999/*").
+*/
+func parseContentRange(contentRange string) (int64, int64, error) {
+	rangeSpec, found := strings.CutPrefix(contentRange, "bytes ")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %s", contentRange)
+	}
+
+	byteRange, totalStr, found := strings.Cut(rangeSpec, "/")
+	startStr, _, _ := strings.Cut(byteRange, "-")
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if !found || err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %s", contentRange)
+	}
+
+	if totalStr == "*" {
+		return start, -1, nil
+	}
+	total, err := strconv.ParseInt(totalStr, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range: %s", contentRange)
+	}
+
+	return start, total, nil
+}
+
+/*
+Saves the body of a successful (2xx) response to a
+file with -o or -O. Other responses (redirects, auth
+challenges, errors) stay in memory so they don't
+overwrite what was downloaded before.
+
+With -C, the request asks for the rest of the file
+with a Range header. The server answers with
+"206 Partial Content" and the body is appended, or
+with 200 (it doesn't support ranges) and the file is
+written again from the start.
+*/
+type download struct {
+	path         string
+	offset       int64
+	showProgress bool
+
+	file     *os.File
+	progress *progressWriter
+	written  bool
+}
+
+// Path is empty with -O until the name is known.
+// The offset of -C - is the size of the file.
+func newDownload(outputPath string, useURLName bool, rawURL, resumeFrom string, showProgress bool) (*download, error) {
+	d := &download{path: outputPath, showProgress: showProgress}
+
+	// The name must be known before sending to resume
+	if useURLName && resumeFrom != "" {
+		if d.path = fileNameFromURL(rawURL); d.path == "" {
+			return nil, apperrors.UsageError{Reason: "-O with -C requires a file name in the URL"}
+		}
+	}
+
+	switch resumeFrom {
+	case "":
+	case resumeFromFileSize:
+		info, err := os.Stat(d.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			d.offset = info.Size()
+		}
+	default:
+		offset, err := strconv.ParseInt(resumeFrom, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, apperrors.UsageError{Reason: fmt.Sprintf("invalid -C offset: %s", resumeFrom)}
+		}
+		d.offset = offset
+	}
+
+	return d, nil
+}
+
+// Range header to resume from the offset, if any
+func (d *download) rangeHeader() string {
+	if d.offset == 0 {
+		return ""
+	}
+	return fmt.Sprintf("Range: bytes=%d-", d.offset)
+}
+
+func (d *download) determinePath(headers []string, rawURL string) {
+	if d.path != "" {
+		return
+	}
+
+	d.path = fileNameFromContentDisposition(headerValue(headers, "Content-Disposition"))
+	if d.path == "" {
+		d.path = fileNameFromURL(rawURL)
+	}
+	if d.path == "" {
+		d.path = defaultDownloadName
+	}
+}
+
+// Used as the BodyWriter of the request
+func (d *download) bodyWriter(rawURL string) func(statusCode string, headers []string) (io.Writer, error) {
+	return func(statusCode string, headers []string) (io.Writer, error) {
+		if !strings.HasPrefix(statusCode, "2") {
+			return nil, nil
+		}
+
+		// A retry after a failed attempt starts over:
+		// from the start of the file, or from the offset
+		// when resuming, dropping what the attempt wrote.
+		d.Close()
+		d.determinePath(headers, rawURL)
+
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		var start int64
+		total := int64(-1)
+		if contentLength, err := strconv.ParseInt(headerValue(headers, "Content-Length"), 10, 64); err == nil {
+			total = contentLength
+		}
+
+		if statusCode == "206" {
+			var err error
+			if start, total, err = parseContentRange(headerValue(headers, "Content-Range")); err != nil {
+				return nil, apperrors.ProtocolError{Protocol: "HTTP", Err: err}
+			}
+			if start != d.offset {
+				return nil, fmt.Errorf("server resumed from byte %d instead of %d", start, d.offset)
+			}
+		} else if d.offset > 0 {
+			terminalutils.PrintAppWarning("server does not support resuming, downloading the whole file")
+		}
+
+		// A 206 from byte 0 replaces the whole file. O_TRUNC
+		// instead of Truncate since -o can be /dev/null.
+		if start > 0 {
+			flags = os.O_CREATE | os.O_WRONLY
+		}
+		file, err := os.OpenFile(d.path, flags, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		// Bytes after the resumed range are stale, also
+		// when a 206 starts at 0 on an existing file.
+		if err := file.Truncate(start); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if _, err := file.Seek(start, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		d.file = file
+		d.written = true
+
+		if !d.showProgress {
+			return file, nil
+		}
+		d.progress = newProgressWriter(file, start, total)
+		return d.progress, nil
+	}
+}
+
+// Whether a body was written to the file
+func (d *download) saved() bool {
+	return d.written
+}
+
+func (d *download) Close() error {
+	if d.progress != nil {
+		d.progress.finish()
+		d.progress = nil
+	}
+
+	if d.file == nil {
+		return nil
+	}
+
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+/*
+Prints the progress to stderr while the body is
+written. done starts at the resumed offset so the
+percentage is of the whole file, while the rate
+only counts the bytes of this run.
+*/
+type progressWriter struct {
+	w         io.Writer
+	start     time.Time
+	lastPrint time.Time
+	offset    int64
+	done      int64
+	total     int64
+}
+
+// Total is -1 if it's unknown
+func newProgressWriter(w io.Writer, offset, total int64) *progressWriter {
+	return &progressWriter{w: w, start: time.Now(), offset: offset, done: offset, total: total}
+}
+
+// Bytes per second and the estimated time left
+// (zero if the total or the rate is unknown).
+func (pw *progressWriter) rateAndETA() (float64, time.Duration) {
+	elapsed := time.Since(pw.start).Seconds()
+	if elapsed == 0 {
+		return 0, 0
+	}
+
+	rate := float64(pw.done-pw.offset) / elapsed
+	if pw.total < 0 || rate == 0 {
+		return rate, 0
+	}
+	return rate, time.Duration(float64(pw.total-pw.done) / rate * float64(time.Second))
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.done += int64(n)
+
+	if time.Since(pw.lastPrint) >= progressInterval {
+		rate, eta := pw.rateAndETA()
+		terminalutils.PrintProgress(pw.done, pw.total, rate, eta)
+		pw.lastPrint = time.Now()
+	}
+
+	return n, err
+}
+
+func (pw *progressWriter) finish() {
+	rate, _ := pw.rateAndETA()
+	terminalutils.PrintProgress(pw.done, pw.total, rate, 0)
+	terminalutils.PrintProgressDone()
+}
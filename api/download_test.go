@@ -0,0 +1,224 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileNameFromURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{name: "file", url: "https://example.com/files/a.zip", expected: "a.zip"},
+		{name: "query", url: "http://example.com/a.zip?v=2#top", expected: "a.zip"},
+		{name: "no_scheme", url: "example.com/docs/readme.txt", expected: "readme.txt"},
+		{name: "root", url: "https://example.com/", expected: ""},
+		{name: "no_path", url: "https://example.com", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := fileNameFromURL(test.url); got != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestFileNameFromContentDisposition(t *testing.T) {
+	tests := []struct {
+		name               string
+		contentDisposition string
+		expected           string
+	}{
+		{name: "quoted", contentDisposition: `attachment; filename="report.pdf"`, expected: "report.pdf"},
+		{name: "token", contentDisposition: "attachment; filename=report.pdf", expected: "report.pdf"},
+		{name: "extended", contentDisposition: `attachment; filename="a.txt"; filename*=UTF-8''caf%C3%A9.txt`, expected: "café.txt"},
+		{name: "path_traversal", contentDisposition: `attachment; filename="../../.bashrc"`, expected: ".bashrc"},
+		{name: "windows_path", contentDisposition: `attachment; filename="C:\tmp\x.exe"`, expected: "x.exe"},
+		{name: "dot_dot", contentDisposition: `attachment; filename=".."`, expected: ""},
+		{name: "no_filename", contentDisposition: "inline", expected: ""},
+		{name: "invalid", contentDisposition: "; ;", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := fileNameFromContentDisposition(test.contentDisposition); got != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentRange  string
+		expectedStart int64
+		expectedTotal int64
+		expectedErr   bool
+	}{
+		{name: "full", contentRange: "bytes 100-999/1000", expectedStart: 100, expectedTotal: 1000},
+		{name: "unknown_total", contentRange: "bytes 100-999/*", expectedStart: 100, expectedTotal: -1},
+		{name: "no_unit", contentRange: "100-999/1000", expectedErr: true},
+		{name: "no_total", contentRange: "bytes 100-999", expectedErr: true},
+		{name: "bad_start", contentRange: "bytes x-999/1000", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, total, err := parseContentRange(test.contentRange)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error\tgot: %d %d", start, total)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if start != test.expectedStart || total != test.expectedTotal {
+				t.Fatalf("expected: %d %d\tgot: %d %d", test.expectedStart, test.expectedTotal, start, total)
+			}
+		})
+	}
+}
+
+func TestDownloadBodyWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		existing    string
+		resumeFrom  string
+		statusCode  string
+		headers     []string
+		body        string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "new_file", statusCode: "200", body: "hello", expected: "hello"},
+		{name: "overwrite", existing: "old content", statusCode: "200", body: "new", expected: "new"},
+		{
+			name: "resume", existing: "hel", resumeFrom: "-", statusCode: "206",
+			headers: []string{"Content-Range: bytes 3-4/5"}, body: "lo", expected: "hello",
+		},
+		{
+			name: "partial_from_start", existing: "old content", statusCode: "206",
+			headers: []string{"Content-Range: bytes 0-2/3"}, body: "new", expected: "new",
+		},
+		{name: "resume_not_supported", existing: "hel", resumeFrom: "-", statusCode: "200", body: "hello", expected: "hello"},
+		{
+			name: "resume_wrong_offset", existing: "hel", resumeFrom: "-", statusCode: "206",
+			headers: []string{"Content-Range: bytes 0-4/5"}, expected: "hel", expectedErr: true,
+		},
+		{name: "not_found", existing: "hel", resumeFrom: "-", statusCode: "404", expected: "hel"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.bin")
+			if test.existing != "" {
+				if err := os.WriteFile(path, []byte(test.existing), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			d, err := newDownload(path, false, "http://example.com/out.bin", test.resumeFrom, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := d.bodyWriter("http://example.com/out.bin")(test.statusCode, test.headers)
+			if test.expectedErr != (err != nil) {
+				t.Fatalf("expected error: %v\tgot: %v", test.expectedErr, err)
+			}
+			if w != nil {
+				if _, err := w.Write([]byte(test.body)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := d.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if saved := w != nil; d.saved() != saved {
+				t.Fatalf("expected saved: %v\tgot: %v", saved, d.saved())
+			}
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, content)
+			}
+		})
+	}
+}
+
+// The first attempt fails partway, so the retry
+// resumes from the same offset again.
+func TestDownloadResumeRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.bin")
+	if err := os.WriteFile(path, []byte("hel"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := newDownload(path, false, "http://example.com/out.bin", "-", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bodyWriter := d.bodyWriter("http://example.com/out.bin")
+	headers := []string{"Content-Range: bytes 3-4/5"}
+
+	for _, body := range []string{"l", "lo"} {
+		w, err := bodyWriter("206", headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "hello"; string(content) != expected {
+		t.Fatalf("expected: %q\tgot: %q", expected, content)
+	}
+}
+
+func TestDownloadDeterminePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		headers  []string
+		expected string
+	}{
+		{name: "content_disposition", url: "http://example.com/dl?id=1", headers: []string{`Content-Disposition: attachment; filename="r.pdf"`}, expected: "r.pdf"},
+		{name: "url", url: "http://example.com/files/a.zip", expected: "a.zip"},
+		{name: "default", url: "http://example.com/", expected: defaultDownloadName},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d, err := newDownload("", true, test.url, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d.determinePath(test.headers, test.url)
+			if d.path != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, d.path)
+			}
+		})
+	}
+}
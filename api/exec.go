@@ -1,70 +1,360 @@
 package api
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/saeidalz13/gurl"
+	"github.com/saeidalz13/gurl/api/apperrors"
 	"github.com/saeidalz13/gurl/api/cli"
-	"github.com/saeidalz13/gurl/api/conninfo"
 	"github.com/saeidalz13/gurl/api/http"
 	"github.com/saeidalz13/gurl/api/tcp"
-	"github.com/saeidalz13/gurl/api/ws"
 	"github.com/saeidalz13/gurl/internal/domainparser"
-	"github.com/saeidalz13/gurl/internal/errutils"
-	"github.com/saeidalz13/gurl/internal/methodparser"
+	"github.com/saeidalz13/gurl/internal/httpconstants"
 	"github.com/saeidalz13/gurl/internal/pathutils"
 	"github.com/saeidalz13/gurl/internal/terminalutils"
 )
 
-func ExecGurl() {
-	ipCacheDir := pathutils.MustMakeIpCacheDir()
+// Jar is nil when disabled by the user
+func loadCookieJar(path string, disabled bool) (*http.CookieJar, error) {
+	if disabled {
+		return nil, nil
+	}
+
+	if path == "" {
+		var err error
+		if path, err = pathutils.MakeCookieJarPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	jar := http.NewCookieJar(path)
+	if err := jar.Load(); err != nil {
+		return nil, err
+	}
+
+	return jar, nil
+}
+
+// Colors of ~/.gurl/config over the default theme.
+// Without the file the default is used.
+func loadTheme() (terminalutils.Theme, error) {
+	path, err := pathutils.MakeConfigPath()
+	if err != nil {
+		return terminalutils.Theme{}, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return terminalutils.DefaultTheme(), nil
+	}
+	if err != nil {
+		return terminalutils.Theme{}, err
+	}
+	defer file.Close()
+
+	theme, err := terminalutils.ParseTheme(file, terminalutils.DefaultTheme())
+	if err != nil {
+		return terminalutils.Theme{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return theme, nil
+}
+
+// Client with the settings of the flags. IPs and
+// TLS sessions are cached in ~/.gurl between runs.
+func newClient(cp cli.CliParams) (*gurl.Client, error) {
+	ipCacheDir, err := pathutils.MakeIpCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &gurl.Client{
+		Resolver: gurl.DNSResolver{CacheDir: ipCacheDir},
+		Timeouts: gurl.Timeouts{
+			Connect:      cp.ConnectTimeout,
+			TLSHandshake: cp.TLSTimeout,
+			FirstByte:    cp.FirstByteTimeout,
+			IdleRead:     cp.IdleTimeout,
+			Total:        cp.MaxTime,
+		},
+		Proxy:           gurl.ProxyFromEnvironment,
+		Retry:           http.NewRetryPolicy(cp.Retries, cp.RetryDelay, cp.RetryMaxDelay, cp.RetryOnStatus),
+		FollowRedirects: cp.FollowRedirects,
+		HTTPVersion:     cp.HTTPVersion,
+		Verbose:         cp.Verbose,
+	}
+
+	// -proxy has precedence over the environment variables
+	if cp.Proxy != "" {
+		if client.Proxy, err = gurl.ProxyURL(cp.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	if !cp.NoSessionCache {
+		tlsSessionCacheDir, err := pathutils.MakeTLSSessionCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		client.TLSConfig = &tls.Config{ClientSessionCache: tcp.NewFileSessionCache(tlsSessionCacheDir)}
+	}
 
-	cp := cli.InitCli()
+	return client, nil
+}
 
-	method, err := methodparser.ParseMethod(cp.Method)
-	errutils.CheckErr(err)
+func newRequest(ctx context.Context, cp cli.CliParams) (gurl.Request, error) {
+	req, err := gurl.NewRequest(ctx, cp.Method, cp.Domain)
+	if err != nil {
+		return gurl.Request{}, err
+	}
+
+	req.Body = cp.Data
+	req.DataType = cp.DataType
+	req.Cookies = cp.Cookies
+	req.Header = cp.Headers
+
+	switch cp.AuthScheme {
+	case httpconstants.AuthSchemeBasic:
+		req.SetBasicAuth(cp.User, cp.Password)
+	case httpconstants.AuthSchemeBearer:
+		req.SetBearerToken(cp.BearerToken)
+	case httpconstants.AuthSchemeDigest:
+		req.SetDigestAuth(cp.User, cp.Password)
+	}
+
+	return req, nil
+}
+
+func saveCookieJar(jar *http.CookieJar) {
+	if jar == nil {
+		return
+	}
+	if err := jar.Save(); err != nil {
+		// Should not stop the operation
+		terminalutils.PrintAppWarning(fmt.Sprintf("skipped saving cookies: %v", err))
+	}
+}
+
+// Cookies set in the handshake are saved even if
+// the session ends with an error.
+func execWebSocket(ctx context.Context, client *gurl.Client, cp cli.CliParams) error {
+	// Ctrl-C closes the session with a close frame
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	script, closeInput, err := wsScript(cp.WsScript)
+	if err != nil {
+		return err
+	}
+	defer closeInput()
+
+	replay, err := wsReplay(cp)
+	if err != nil {
+		return err
+	}
+
+	var record io.Writer
+	if cp.WsRecord != "" {
+		f, err := os.Create(cp.WsRecord)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		record = f
+	}
+
+	// Without the file, the history is only kept
+	// for the session.
+	historyFile, err := pathutils.MakeWsHistoryPath()
+	if err != nil {
+		terminalutils.PrintAppWarning(fmt.Sprintf("history of the prompt is not saved: %v", err))
+	}
+
+	err = client.WebSocketSession(ctx, cp.Domain, gurl.WebSocketOptions{
+		Subprotocols:       cp.WsProtocols,
+		Origin:             cp.Origin,
+		Header:             cp.Headers,
+		Cookies:            cp.Cookies,
+		BinaryDir:          cp.WsBinaryDir,
+		DisableCompression: cp.NoWsCompression,
+		Script:             script,
+		HistoryFile:        historyFile,
+		Record:             record,
+		Replay:             replay,
+	})
+	saveCookieJar(client.Jar)
+	return err
+}
+
+// Recording is read before connecting so a broken
+// file fails early.
+func wsReplay(cp cli.CliParams) (*gurl.WebSocketReplay, error) {
+	if cp.WsReplay == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(cp.WsReplay)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	replay, err := tcp.NewWebSocketReplay(f, cp.WsReplaySpeed, cp.WsTimeout)
+	if err != nil {
+		return nil, apperrors.UsageError{Reason: fmt.Sprintf("-ws-replay %s: %v", cp.WsReplay, err)}
+	}
+	return replay, nil
+}
+
+// Input of -ws-send is opened before connecting so
+// a missing file fails early.
+func wsScript(params *cli.WsScriptParams) (*gurl.WebSocketScript, func(), error) {
+	if params == nil {
+		return nil, func() {}, nil
+	}
+
+	script := &gurl.WebSocketScript{
+		NDJSON:  params.NDJSON,
+		Count:   params.Count,
+		Match:   params.Match,
+		Expect:  params.Expect,
+		Timeout: params.Timeout,
+	}
+
+	switch params.Send {
+	case "":
+		return script, func() {}, nil
+	case "-":
+		script.Input = os.Stdin
+		return script, func() {}, nil
+	}
+
+	f, err := os.Open(params.Send)
+	if err != nil {
+		return nil, nil, err
+	}
+	script.Input = f
+	return script, func() { f.Close() }, nil
+}
+
+// Errors are returned to cmd/main.go which
+// maps them to the exit codes.
+func ExecGurl() error {
+	// Before parsing so usage errors are printed right too
+	terminalutils.DetectColors()
+
+	cp, err := cli.InitCli()
+	if err != nil {
+		return err
+	}
+
+	if cp.Silent {
+		terminalutils.SetSilent(cp.ShowError)
+	}
+
+	if cp.NoColor {
+		terminalutils.DisableColors()
+	} else if theme, err := loadTheme(); err != nil {
+		// Should not stop the operation
+		terminalutils.PrintAppWarning(fmt.Sprintf("default colors are used: %v", err))
+	} else {
+		terminalutils.SetTheme(theme)
+	}
+
+	client, err := newClient(cp)
+	if err != nil {
+		return err
+	}
+
+	if cp.Output == outputJSON {
+		terminalutils.EnableJSONOutput()
+	}
+
+	ctx := context.Background()
 
 	dp := domainparser.NewDomainParser(cp.Domain)
-	err = dp.Parse()
-	errutils.CheckErr(err)
+	if err := dp.Parse(); err != nil {
+		return err
+	}
 
-	connInfo := conninfo.NewConnInfoResolver(
-		ipCacheDir,
-		dp.Domain,
-		dp.DomainSegment,
-		dp.Protocol,
-	).Resolve()
+	client.Jar, err = loadCookieJar(cp.CookieJar, cp.NoCookieJar)
+	if err != nil {
+		return err
+	}
 
-	tcm := tcp.NewTCPConnManager(connInfo, dp.Domain)
-	err = tcm.InitTCPConn()
-	errutils.CheckErr(err)
+	if domainparser.IsWebSocket(dp.Protocol) {
+		return execWebSocket(ctx, client, cp)
+	}
 
-	switch dp.Protocol {
-	case domainparser.ProtocolWS:
-		secWsKey, err := ws.GenerateSecWebSocketKey()
-		errutils.CheckErr(err)
+	req, err := newRequest(ctx, cp)
+	if err != nil {
+		return err
+	}
 
-		wsRequest := ws.GenerateWebSocketRequest(dp.Domain, dp.Path, secWsKey)
+	// Unknown variables are found before sending
+	if _, err := formatWriteOut(cp.WriteOut, &gurl.Response{}); err != nil {
+		return err
+	}
 
-		if cp.Verbose {
-			terminalutils.PrintWebSocketClientInfo(connInfo.IP.String(), wsRequest)
+	var dl *download
+	if cp.OutputFile != "" || cp.RemoteName {
+		if dl, err = newDownload(cp.OutputFile, cp.RemoteName, cp.Domain, cp.ResumeFrom, terminalutils.StderrIsTerminal() && !cp.Silent); err != nil {
+			return err
+		}
+		if rangeHeader := dl.rangeHeader(); rangeHeader != "" {
+			req.Header = append(req.Header, rangeHeader)
+		}
+		req.BodyWriter = dl.bodyWriter(cp.Domain)
+	}
+
+	resp, err := client.Do(req)
+	if dl != nil {
+		if closeErr := dl.Close(); err == nil {
+			err = closeErr
 		}
+	}
+	if err != nil {
+		return err
+	}
 
-		go tcm.ReadWebSocketData(secWsKey, cp.Verbose)
-		tcm.WriteWebSocketData([]byte(wsRequest))
+	saveCookieJar(client.Jar)
 
-	case domainparser.ProtocolHTTP, domainparser.ProtocolHTTPS:
-		httpRequest := http.NewHTTPRequestGenerator(
-			dp.Domain,
-			dp.Path,
-			cp.Cookies,
-			method,
-			cp.Data,
-			cp.DataType,
-		).Generate()
+	if cp.Output == outputJSON {
+		return printJSON(resp)
+	}
 
+	switch {
+	case dl != nil && dl.saved():
 		if cp.Verbose {
-			terminalutils.PrintHTTPClientInfo(connInfo.IP.String(), httpRequest)
+			resp.Print(cp.Verbose, cp.Raw)
 		}
+		terminalutils.PrintSavedFile(dl.path)
+
+	// The range starts at the end of the file
+	case dl != nil && dl.offset > 0 && resp.StatusCode == "416":
+		terminalutils.PrintAppWarning(fmt.Sprintf("%s is already complete", dl.path))
 
-		respBytes := tcm.DispatchHTTPRequest(httpRequest)
-		http.NewHTTPResponseParser(respBytes).Parse().Print(cp.Verbose)
+	default:
+		resp.Print(cp.Verbose, cp.Raw)
 	}
+
+	if cp.Verbose {
+		resp.Timing.Print()
+	}
+
+	if cp.WriteOut != "" {
+		writeOut, err := formatWriteOut(cp.WriteOut, resp)
+		if err != nil {
+			return err
+		}
+		fmt.Print(writeOut)
+	}
+
+	return nil
 }
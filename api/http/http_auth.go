@@ -0,0 +1,331 @@
+package http
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/saeidalz13/gurl/internal/httpconstants"
+)
+
+// Basic scheme is base64 of "user:password" (RFC 7617)
+func BasicAuthorization(user, password string) string {
+	return httpconstants.AuthSchemeBasic + " " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+func BearerAuthorization(token string) string {
+	return httpconstants.AuthSchemeBearer + " " + token
+}
+
+/*
+Parameters of a Digest challenge sent by the server
+in the WWW-Authenticate header of a 401 response:
+
+	WWW-Authenticate: Digest realm="x", qop="auth, auth-int",
+	  algorithm=SHA-256, nonce="...", opaque="..."
+*/
+type DigestChallenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	Qop       []string
+	Stale     bool
+}
+
+// Splits the auth-params of a challenge while respecting
+// quoted strings (which may contain commas). Parsing stops
+// at the next challenge (a token without '=').
+func parseAuthParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+
+		eqIdx := strings.IndexByte(s, '=')
+		commaIdx := strings.IndexByte(s, ',')
+		if eqIdx == -1 || (commaIdx != -1 && commaIdx < eqIdx) {
+			// Start of another challenge, e.g. "Basic realm=..."
+			return params
+		}
+
+		key := strings.ToLower(strings.TrimSpace(s[:eqIdx]))
+		if strings.ContainsAny(key, " \t") {
+			return params
+		}
+		s = strings.TrimLeft(s[eqIdx+1:], " \t")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			sb := strings.Builder{}
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				// quoted-pair: backslash escapes the next char
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				sb.WriteByte(s[i])
+			}
+			value = sb.String()
+			s = s[min(i+1, len(s)):]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end == -1 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+
+		params[key] = value
+	}
+}
+
+// Index of the auth scheme token in a header value,
+// which must be at the beginning or after a space/comma.
+func findAuthScheme(value, scheme string) int {
+	lower := strings.ToLower(value)
+	target := strings.ToLower(scheme) + " "
+
+	for offset := 0; ; {
+		idx := strings.Index(lower[offset:], target)
+		if idx == -1 {
+			return -1
+		}
+
+		idx += offset
+		if idx == 0 || lower[idx-1] == ' ' || lower[idx-1] == ',' {
+			return idx
+		}
+		offset = idx + 1
+	}
+}
+
+// Finds the Digest challenge among the values of
+// WWW-Authenticate headers. A header value may hold
+// several challenges (e.g. Digest and Basic).
+func ParseDigestChallenge(wwwAuthenticateValues []string) (DigestChallenge, error) {
+	for _, value := range wwwAuthenticateValues {
+		idx := findAuthScheme(value, httpconstants.AuthSchemeDigest)
+		if idx == -1 {
+			continue
+		}
+
+		params := parseAuthParams(value[idx+len(httpconstants.AuthSchemeDigest)+1:])
+
+		challenge := DigestChallenge{
+			Realm:     params["realm"],
+			Nonce:     params["nonce"],
+			Opaque:    params["opaque"],
+			Algorithm: params["algorithm"],
+			Stale:     strings.EqualFold(params["stale"], "true"),
+		}
+
+		if challenge.Algorithm == "" {
+			challenge.Algorithm = "MD5"
+		}
+
+		for _, qop := range strings.Split(params["qop"], ",") {
+			if qop = strings.TrimSpace(qop); qop != "" {
+				challenge.Qop = append(challenge.Qop, qop)
+			}
+		}
+
+		if challenge.Nonce == "" {
+			return DigestChallenge{}, errors.New("digest challenge has no nonce")
+		}
+
+		return challenge, nil
+	}
+
+	return DigestChallenge{}, errors.New("server did not send a digest challenge")
+}
+
+/*
+DigestAuth answers a Digest challenge (RFC 7616).
+
+Each response to the same nonce must use a bigger
+nonce count (nc) so the server can detect replays.
+A new nonce resets the count.
+*/
+type DigestAuth struct {
+	user       string
+	password   string
+	nonceCount uint32
+	challenge  DigestChallenge
+
+	// Only set in tests to get deterministic output
+	cnonce string
+}
+
+func NewDigestAuth(user, password string) *DigestAuth {
+	return &DigestAuth{user: user, password: password}
+}
+
+func (d *DigestAuth) SetChallenge(challenge DigestChallenge) {
+	if challenge.Nonce != d.challenge.Nonce {
+		d.nonceCount = 0
+	}
+	d.challenge = challenge
+}
+
+func digestHashFunc(algorithm string) (func() hash.Hash, bool, error) {
+	upper := strings.ToUpper(algorithm)
+	isSess := strings.HasSuffix(upper, "-SESS")
+
+	switch strings.TrimSuffix(upper, "-SESS") {
+	case "MD5":
+		return md5.New, isSess, nil
+	case "SHA-256":
+		return sha256.New, isSess, nil
+	default:
+		return nil, false, fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+}
+
+func generateCnonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Only "auth" quality of protection is supported.
+// Servers without qop use the legacy RFC 2069 scheme.
+func (d *DigestAuth) selectQop() (string, error) {
+	if len(d.challenge.Qop) == 0 {
+		return "", nil
+	}
+
+	for _, qop := range d.challenge.Qop {
+		if strings.EqualFold(qop, "auth") {
+			return "auth", nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported digest qop: %s", strings.Join(d.challenge.Qop, ", "))
+}
+
+/*
+Computes the Authorization header value:
+
+	HA1      = H(user:realm:password)
+	HA1-sess = H(HA1:nonce:cnonce)
+	HA2      = H(method:uri)
+	response = H(HA1:nonce:nc:cnonce:qop:HA2)
+
+without qop, response is H(HA1:nonce:HA2).
+*/
+func (d *DigestAuth) Authorization(method, uri string) (string, error) {
+	newHash, isSess, err := digestHashFunc(d.challenge.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	qop, err := d.selectQop()
+	if err != nil {
+		return "", err
+	}
+
+	h := func(s string) string {
+		hasher := newHash()
+		hasher.Write([]byte(s))
+		return hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	cnonce := d.cnonce
+	if cnonce == "" {
+		cnonce, err = generateCnonce()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	d.nonceCount++
+	nc := fmt.Sprintf("%08x", d.nonceCount)
+
+	ha1 := h(d.user + ":" + d.challenge.Realm + ":" + d.password)
+	if isSess {
+		ha1 = h(ha1 + ":" + d.challenge.Nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + d.challenge.Nonce + ":" + ha2)
+	} else {
+		response = h(strings.Join([]string{ha1, d.challenge.Nonce, nc, cnonce, qop, ha2}, ":"))
+	}
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, `%s username=%s, realm=%s, uri=%s, algorithm=%s, nonce=%s`,
+		httpconstants.AuthSchemeDigest, quotedString(d.user), quotedString(d.challenge.Realm), quotedString(uri),
+		d.challenge.Algorithm, quotedString(d.challenge.Nonce))
+	if qop != "" {
+		fmt.Fprintf(&sb, `, nc=%s, cnonce="%s", qop=%s`, nc, cnonce, qop)
+	}
+	fmt.Fprintf(&sb, `, response="%s"`, response)
+	if d.challenge.Opaque != "" {
+		fmt.Fprintf(&sb, `, opaque=%s`, quotedString(d.challenge.Opaque))
+	}
+
+	return sb.String(), nil
+}
+
+// '"' and '\' are escaped with a backslash
+// (quoted-pair), e.g. a"b -> "a\"b".
+func quotedString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// Keeps the auth scheme visible but hides the
+// credentials when the request is printed.
+func maskAuthorizationValue(value string) string {
+	scheme, _, _ := strings.Cut(value, " ")
+	return scheme + " ****"
+}
+
+// Headers that carry credentials and must never be shown
+func isCredentialHeader(name string) bool {
+	return strings.EqualFold(name, "authorization") || strings.EqualFold(name, "proxy-authorization")
+}
+
+// Masks the Authorization and Proxy-Authorization headers
+// of an HTTP/1.1 request before it's printed in verbose mode.
+func MaskCredentials(httpRequest string) string {
+	lines := strings.Split(httpRequest, "\r\n")
+
+	for i, line := range lines {
+		// Headers end at the first empty line
+		if line == "" {
+			break
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		trimmedName := strings.TrimSpace(name)
+		if found && isCredentialHeader(trimmedName) {
+			lines[i] = name + ": " + maskAuthorizationValue(strings.TrimSpace(value))
+		}
+	}
+
+	return strings.Join(lines, "\r\n")
+}
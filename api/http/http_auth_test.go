@@ -0,0 +1,161 @@
+package http
+
+import (
+	"strings"
+	"testing"
+)
+
+// Example of RFC 7616 section 3.9.1
+const rfc7616Challenge = `Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=%s, ` +
+	`nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+
+func TestDigestAuthorizationRFCExample(t *testing.T) {
+	tests := []struct {
+		name             string
+		algorithm        string
+		expectedResponse string
+	}{
+		{name: "md5", algorithm: "MD5", expectedResponse: "8ca523f5e9506fed4657c9700eebdbec"},
+		{name: "sha256", algorithm: "SHA-256", expectedResponse: "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			challenge, err := ParseDigestChallenge([]string{strings.Replace(rfc7616Challenge, "%s", test.algorithm, 1)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := NewDigestAuth("Mufasa", "Circle of Life")
+			d.cnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+			d.SetChallenge(challenge)
+
+			authorization, err := d.Authorization("GET", "/dir/index.html")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expectedParts := []string{
+				`response="` + test.expectedResponse + `"`,
+				"nc=00000001",
+				"qop=auth,",
+				`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			}
+			for _, part := range expectedParts {
+				if !strings.Contains(authorization, part) {
+					t.Fatalf("expected %s in:\n%s", part, authorization)
+				}
+			}
+
+			// Same nonce must increase the nonce count
+			authorization, err = d.Authorization("GET", "/dir/index.html")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(authorization, "nc=00000002") {
+				t.Fatalf("expected nc=00000002 in:\n%s", authorization)
+			}
+		})
+	}
+}
+
+func TestDigestAuthorizationQuoting(t *testing.T) {
+	challenge, err := ParseDigestChallenge([]string{`Digest realm="a \"b\" c", nonce="n\\1", opaque="o"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDigestAuth(`Mu"fa\sa`, "pass")
+	d.SetChallenge(challenge)
+
+	authorization, err := d.Authorization("GET", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The values come back as they were
+	params := parseAuthParams(strings.TrimPrefix(authorization, "Digest "))
+	expected := map[string]string{"username": `Mu"fa\sa`, "realm": `a "b" c`, "nonce": `n\1`, "uri": "/", "opaque": "o"}
+	for key, value := range expected {
+		if params[key] != value {
+			t.Fatalf("expected %s: %q\tgot: %q in:\n%s", key, value, params[key], authorization)
+		}
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      []string
+		expectedErr bool
+		expected    DigestChallenge
+	}{
+		{
+			name:     "digest_after_basic_challenge",
+			values:   []string{`Basic realm="a", Digest realm="b, c", nonce="n1", stale=TRUE`},
+			expected: DigestChallenge{Realm: "b, c", Nonce: "n1", Algorithm: "MD5", Stale: true},
+		},
+		{
+			name:     "second_header_value",
+			values:   []string{`Bearer realm="x"`, `Digest nonce="n2", algorithm=SHA-256-sess, qop=auth`},
+			expected: DigestChallenge{Nonce: "n2", Algorithm: "SHA-256-sess", Qop: []string{"auth"}},
+		},
+		{name: "no_digest", values: []string{`Basic realm="a"`}, expectedErr: true},
+		{name: "no_nonce", values: []string{`Digest realm="a"`}, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			challenge, err := ParseDigestChallenge(test.values)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if challenge.Realm != test.expected.Realm ||
+				challenge.Nonce != test.expected.Nonce ||
+				challenge.Algorithm != test.expected.Algorithm ||
+				challenge.Stale != test.expected.Stale ||
+				strings.Join(challenge.Qop, ",") != strings.Join(test.expected.Qop, ",") {
+				t.Fatalf("expected: %+v\tgot: %+v", test.expected, challenge)
+			}
+		})
+	}
+}
+
+func TestMaskCredentials(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: a.com\r\nAuthorization: Basic dXNlcjpwYXNz\r\nProxy-Authorization: Basic cDpx\r\n\r\nAuthorization: body"
+	expected := "GET / HTTP/1.1\r\nHost: a.com\r\nAuthorization: Basic ****\r\nProxy-Authorization: Basic ****\r\n\r\nAuthorization: body"
+
+	if got := MaskCredentials(request); got != expected {
+		t.Fatalf("expected: %q\tgot: %q", expected, got)
+	}
+}
+
+func TestFormatHTTP2RequestMasksAdditionalHeaders(t *testing.T) {
+	reqGenerator := NewHTTPRequestGenerator("a.com", "/", "", "GET", "", 0)
+	reqGenerator.AddHeader("Authorization: Bearer secret")
+	reqGenerator.AddHeader("Proxy-Authorization: Basic cDpx")
+
+	fields, body := reqGenerator.GenerateHTTP2("https")
+	for _, hf := range fields {
+		if isCredentialHeader(hf.Name) && !hf.Sensitive {
+			t.Fatalf("expected: %s to be sensitive", hf.Name)
+		}
+	}
+
+	got := FormatHTTP2Request(fields, body)
+	for _, expected := range []string{"authorization: Bearer ****\r\n", "proxy-authorization: Basic ****\r\n"} {
+		if !strings.Contains(got, expected) {
+			t.Fatalf("expected: %q\tgot: %q", expected, got)
+		}
+	}
+	if strings.Contains(got, "secret") || strings.Contains(got, "cDpx") {
+		t.Fatalf("expected: masked credentials\tgot: %q", got)
+	}
+}
@@ -0,0 +1,211 @@
+package http
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/gurl/internal/domainparser"
+)
+
+const (
+	SameSiteDefault uint8 = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+/*
+A cookie set by the server with Set-Cookie (RFC 6265):
+
+	Set-Cookie: sid=abc; Domain=example.com; Path=/;
+	  Max-Age=3600; Secure; HttpOnly; SameSite=Lax
+
+HostOnly cookies (no Domain attribute) are only sent
+to the exact host that set them, while the others are
+sent to the subdomains too.
+
+A zero Expires means a session cookie.
+*/
+type Cookie struct {
+	Name     string
+	Value    string
+	Domain   string
+	Path     string
+	Expires  time.Time
+	HostOnly bool
+	Secure   bool
+	HttpOnly bool
+	SameSite uint8
+}
+
+func (c Cookie) isExpired(now time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(now)
+}
+
+// Servers use several date formats (e.g. in Expires)
+// even though RFC 1123 is the standard one.
+var httpDateLayouts = []string{
+	"Mon, 02 Jan 2006 15:04:05 MST",
+	"Mon, 02-Jan-2006 15:04:05 MST",
+	"Monday, 02-Jan-06 15:04:05 MST",
+	"Mon, 02-Jan-06 15:04:05 MST",
+	"Mon Jan _2 15:04:05 2006",
+}
+
+func parseHTTPDate(value string) (time.Time, bool) {
+	for _, layout := range httpDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Port is not a part of the cookie domain
+func CookieHost(domain string) string {
+	return strings.ToLower(domainparser.Host(domain))
+}
+
+// Host matches the cookie domain if they are equal or
+// host is a subdomain of it. IPs only match exactly.
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+
+	return net.ParseIP(host) == nil && strings.HasSuffix(host, "."+domain)
+}
+
+// Default path of a cookie is the directory of the
+// request path, e.g. "/docs" for "/docs/web".
+func defaultCookiePath(requestPath string) string {
+	requestPath, _, _ = strings.Cut(requestPath, "?")
+
+	if !strings.HasPrefix(requestPath, "/") {
+		return "/"
+	}
+
+	lastSlashIdx := strings.LastIndexByte(requestPath, '/')
+	if lastSlashIdx == 0 {
+		return "/"
+	}
+
+	return requestPath[:lastSlashIdx]
+}
+
+// "/docs" matches "/docs", "/docs/" and "/docs/web"
+// but not "/docsets".
+func pathMatch(requestPath, cookiePath string) bool {
+	requestPath, _, _ = strings.Cut(requestPath, "?")
+
+	if requestPath == cookiePath {
+		return true
+	}
+
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+
+	return strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/'
+}
+
+/*
+Parses the value of a Set-Cookie header received from
+host for a request to requestPath. Unknown attributes
+are ignored. Max-Age has precedence over Expires; a
+cookie with Max-Age <= 0 comes back already expired
+which tells the jar to delete it.
+*/
+func ParseSetCookie(value, host, requestPath string, isSecure bool, now time.Time) (Cookie, error) {
+	parts := strings.Split(value, ";")
+
+	name, cookieValue, found := strings.Cut(parts[0], "=")
+	name = strings.TrimSpace(name)
+	if !found || name == "" {
+		return Cookie{}, errors.New("set-cookie has no cookie name")
+	}
+
+	cookie := Cookie{
+		Name:     name,
+		Value:    strings.Trim(strings.TrimSpace(cookieValue), `"`),
+		Domain:   host,
+		Path:     defaultCookiePath(requestPath),
+		HostOnly: true,
+	}
+
+	hasMaxAge := false
+	for _, part := range parts[1:] {
+		attr, attrValue, _ := strings.Cut(part, "=")
+		attr = strings.ToLower(strings.TrimSpace(attr))
+		attrValue = strings.TrimSpace(attrValue)
+
+		switch attr {
+		case "domain":
+			domain := strings.ToLower(strings.TrimPrefix(attrValue, "."))
+			if domain == "" {
+				continue
+			}
+			if !domainMatch(host, domain) {
+				return Cookie{}, errors.New("set-cookie domain " + domain + " does not match host " + host)
+			}
+			// A single label domain (e.g. "com") would
+			// share the cookie with every site under it.
+			if !strings.Contains(domain, ".") && domain != host {
+				return Cookie{}, errors.New("set-cookie domain " + domain + " is too broad")
+			}
+			cookie.Domain = domain
+			cookie.HostOnly = false
+
+		case "path":
+			if strings.HasPrefix(attrValue, "/") {
+				cookie.Path = attrValue
+			}
+
+		case "max-age":
+			seconds, err := strconv.Atoi(attrValue)
+			if err != nil {
+				continue
+			}
+			hasMaxAge = true
+			if seconds <= 0 {
+				cookie.Expires = time.Unix(0, 0)
+			} else {
+				cookie.Expires = now.Add(time.Duration(seconds) * time.Second)
+			}
+
+		case "expires":
+			if hasMaxAge {
+				continue
+			}
+			if expires, ok := parseHTTPDate(attrValue); ok {
+				cookie.Expires = expires
+			}
+
+		case "secure":
+			cookie.Secure = true
+
+		case "httponly":
+			cookie.HttpOnly = true
+
+		case "samesite":
+			switch strings.ToLower(attrValue) {
+			case "lax":
+				cookie.SameSite = SameSiteLax
+			case "strict":
+				cookie.SameSite = SameSiteStrict
+			case "none":
+				cookie.SameSite = SameSiteNone
+			}
+		}
+	}
+
+	// Insecure origins must not set secure cookies
+	if cookie.Secure && !isSecure {
+		return Cookie{}, errors.New("secure cookie " + name + " set over insecure connection")
+	}
+
+	return cookie, nil
+}
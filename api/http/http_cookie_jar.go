@@ -0,0 +1,236 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	netscapeCookieHeader = "# Netscape HTTP Cookie File\n# This file was generated by gURL. Edit at your own risk.\n\n"
+	netscapeHttpOnly     = "#HttpOnly_"
+)
+
+/*
+CookieJar keeps the cookies between requests (e.g.
+redirects) and between runs by storing them in a
+file in Netscape format, the same format as cURL:
+
+	domain  subdomains  path  secure  expires  name  value
+
+fields are separated by tabs, expires is a Unix time
+(0 for session cookies) and HttpOnly cookies have the
+"#HttpOnly_" prefix before the domain.
+
+SameSite is not a part of this format, so it's not
+persisted.
+*/
+type CookieJar struct {
+	path    string
+	cookies []Cookie
+
+	// Replaced in tests to control expiry
+	now func() time.Time
+}
+
+func NewCookieJar(path string) *CookieJar {
+	return &CookieJar{path: path, now: time.Now}
+}
+
+func parseNetscapeBool(s string) bool {
+	return strings.EqualFold(s, "TRUE")
+}
+
+func formatNetscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+func parseNetscapeCookieLine(line string) (Cookie, error) {
+	httpOnly := false
+	if after, found := strings.CutPrefix(line, netscapeHttpOnly); found {
+		line = after
+		httpOnly = true
+	}
+
+	fields := strings.Split(line, "\t")
+	if len(fields) != 7 {
+		return Cookie{}, fmt.Errorf("cookie line must have 7 fields, got %d", len(fields))
+	}
+
+	expiresUnix, err := strconv.ParseInt(fields[4], 10, 64)
+	if err != nil {
+		return Cookie{}, fmt.Errorf("invalid cookie expiry: %w", err)
+	}
+
+	cookie := Cookie{
+		Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+		HostOnly: !parseNetscapeBool(fields[1]),
+		Path:     fields[2],
+		Secure:   parseNetscapeBool(fields[3]),
+		Name:     fields[5],
+		Value:    fields[6],
+		HttpOnly: httpOnly,
+	}
+	if expiresUnix != 0 {
+		cookie.Expires = time.Unix(expiresUnix, 0)
+	}
+
+	return cookie, nil
+}
+
+// A missing jar file is not an error since it is
+// created the first time cookies are saved.
+func (j *CookieJar) Load() error {
+	f, err := os.Open(j.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	now := j.now()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || (strings.HasPrefix(line, "#") && !strings.HasPrefix(line, netscapeHttpOnly)) {
+			continue
+		}
+
+		cookie, err := parseNetscapeCookieLine(line)
+		if err != nil {
+			return fmt.Errorf("cookie jar %s: %w", j.path, err)
+		}
+
+		if !cookie.isExpired(now) {
+			j.cookies = append(j.cookies, cookie)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (j *CookieJar) Save() error {
+	sb := strings.Builder{}
+	sb.WriteString(netscapeCookieHeader)
+
+	now := j.now()
+	for _, c := range j.cookies {
+		if c.isExpired(now) {
+			continue
+		}
+
+		var expiresUnix int64
+		if !c.Expires.IsZero() {
+			expiresUnix = c.Expires.Unix()
+		}
+
+		domain := c.Domain
+		if !c.HostOnly {
+			domain = "." + domain
+		}
+		if c.HttpOnly {
+			domain = netscapeHttpOnly + domain
+		}
+
+		fmt.Fprintf(
+			&sb,
+			"%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain,
+			formatNetscapeBool(!c.HostOnly),
+			c.Path,
+			formatNetscapeBool(c.Secure),
+			expiresUnix,
+			c.Name,
+			c.Value,
+		)
+	}
+
+	// Cookies may hold session tokens
+	return os.WriteFile(j.path, []byte(sb.String()), 0o600)
+}
+
+// A cookie with the same name, domain and path
+// replaces the stored one. Expired cookies remove it.
+func (j *CookieJar) add(cookie Cookie) {
+	for i, c := range j.cookies {
+		if c.Name == cookie.Name && c.Domain == cookie.Domain && c.Path == cookie.Path {
+			if cookie.isExpired(j.now()) {
+				j.cookies = append(j.cookies[:i], j.cookies[i+1:]...)
+			} else {
+				j.cookies[i] = cookie
+			}
+			return
+		}
+	}
+
+	if !cookie.isExpired(j.now()) {
+		j.cookies = append(j.cookies, cookie)
+	}
+}
+
+// Stores the cookies of the Set-Cookie header values
+// of a response. Invalid cookies are skipped and their
+// errors returned so they can be shown in verbose mode.
+func (j *CookieJar) SetCookies(domain, requestPath string, isSecure bool, setCookieValues []string) []error {
+	host := CookieHost(domain)
+	errs := make([]error, 0)
+
+	for _, value := range setCookieValues {
+		cookie, err := ParseSetCookie(value, host, requestPath, isSecure, j.now())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		j.add(cookie)
+	}
+
+	return errs
+}
+
+/*
+Value of the Cookie header for a request. Cookies
+with longer paths are listed first (RFC 6265 5.4),
+otherwise the order they were stored is kept.
+*/
+func (j *CookieJar) CookieHeader(domain, requestPath string, isSecure bool) string {
+	host := CookieHost(domain)
+	now := j.now()
+
+	matched := make([]Cookie, 0, len(j.cookies))
+	for _, c := range j.cookies {
+		if c.isExpired(now) || (c.Secure && !isSecure) || !pathMatch(requestPath, c.Path) {
+			continue
+		}
+
+		if c.HostOnly && host != c.Domain {
+			continue
+		}
+
+		if !c.HostOnly && !domainMatch(host, c.Domain) {
+			continue
+		}
+
+		matched = append(matched, c)
+	}
+
+	sort.SliceStable(matched, func(a, b int) bool {
+		return len(matched[a].Path) > len(matched[b].Path)
+	})
+
+	pairs := make([]string, 0, len(matched))
+	for _, c := range matched {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+
+	return strings.Join(pairs, "; ")
+}
@@ -0,0 +1,211 @@
+package http
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCookieNow = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestParseSetCookie(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		host        string
+		requestPath string
+		isSecure    bool
+		expectedErr bool
+		expected    Cookie
+	}{
+		{
+			name:        "host_only_default_path",
+			value:       "sid=abc",
+			host:        "example.com",
+			requestPath: "/account/login",
+			expected:    Cookie{Name: "sid", Value: "abc", Domain: "example.com", Path: "/account", HostOnly: true},
+		},
+		{
+			name:        "all_attributes",
+			value:       `sid="abc"; Domain=.Example.com; Path=/; Max-Age=60; Secure; HttpOnly; SameSite=Strict`,
+			host:        "www.example.com",
+			requestPath: "/",
+			isSecure:    true,
+			expected: Cookie{
+				Name: "sid", Value: "abc", Domain: "example.com", Path: "/",
+				Expires: testCookieNow.Add(time.Minute), Secure: true, HttpOnly: true, SameSite: SameSiteStrict,
+			},
+		},
+		{
+			name:        "expires",
+			value:       "a=b; Expires=Wed, 21 Oct 2026 07:28:00 GMT",
+			host:        "example.com",
+			requestPath: "/",
+			expected:    Cookie{Name: "a", Value: "b", Domain: "example.com", Path: "/", HostOnly: true, Expires: time.Date(2026, 10, 21, 7, 28, 0, 0, time.UTC)},
+		},
+		{
+			name:        "max_age_precedes_expires",
+			value:       "a=b; Max-Age=0; Expires=Wed, 21 Oct 2026 07:28:00 GMT",
+			host:        "example.com",
+			requestPath: "/",
+			expected:    Cookie{Name: "a", Value: "b", Domain: "example.com", Path: "/", HostOnly: true, Expires: time.Unix(0, 0)},
+		},
+		{name: "foreign_domain", value: "a=b; Domain=other.com", host: "example.com", requestPath: "/", expectedErr: true},
+		{name: "top_level_domain", value: "a=b; Domain=com", host: "example.com", requestPath: "/", expectedErr: true},
+		{name: "secure_over_http", value: "a=b; Secure", host: "example.com", requestPath: "/", expectedErr: true},
+		{name: "no_name", value: "=b", host: "example.com", requestPath: "/", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cookie, err := ParseSetCookie(test.value, test.host, test.requestPath, test.isSecure, testCookieNow)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error\tgot: %+v", cookie)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !cookie.Expires.Equal(test.expected.Expires) {
+				t.Fatalf("expected expires: %v\tgot: %v", test.expected.Expires, cookie.Expires)
+			}
+			cookie.Expires, test.expected.Expires = time.Time{}, time.Time{}
+
+			if cookie != test.expected {
+				t.Fatalf("expected: %+v\tgot: %+v", test.expected, cookie)
+			}
+		})
+	}
+}
+
+func newTestCookieJar(t *testing.T) *CookieJar {
+	t.Helper()
+
+	jar := NewCookieJar(filepath.Join(t.TempDir(), "cookies.txt"))
+	jar.now = func() time.Time { return testCookieNow }
+
+	return jar
+}
+
+func TestCookieHeader(t *testing.T) {
+	jar := newTestCookieJar(t)
+	jar.SetCookies("example.com", "/", true, []string{
+		"host=1",
+		"domain=2; Domain=example.com",
+		"docs=3; Path=/docs",
+		"secure=4; Secure",
+		"expired=5; Max-Age=0",
+	})
+	jar.SetCookies("api.example.com:8443", "/", true, []string{"api=6"})
+
+	tests := []struct {
+		name        string
+		domain      string
+		requestPath string
+		isSecure    bool
+		expected    string
+	}{
+		{name: "longer_path_first", domain: "example.com", requestPath: "/docs/web", isSecure: true, expected: "docs=3; host=1; domain=2; secure=4"},
+		{name: "path_prefix_only_at_slash", domain: "example.com", requestPath: "/docsets", isSecure: true, expected: "host=1; domain=2; secure=4"},
+		{name: "no_secure_over_http", domain: "example.com:80", requestPath: "/", expected: "host=1; domain=2"},
+		{name: "subdomain", domain: "api.example.com", requestPath: "/", isSecure: true, expected: "domain=2; api=6"},
+		{name: "other_site", domain: "notexample.com", requestPath: "/", isSecure: true, expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := jar.CookieHeader(test.domain, test.requestPath, test.isSecure); got != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestCookieJarReplaceAndDelete(t *testing.T) {
+	jar := newTestCookieJar(t)
+
+	jar.SetCookies("example.com", "/", false, []string{"sid=old"})
+	jar.SetCookies("example.com", "/", false, []string{"sid=new"})
+	if got := jar.CookieHeader("example.com", "/", false); got != "sid=new" {
+		t.Fatalf("expected: sid=new\tgot: %q", got)
+	}
+
+	jar.SetCookies("example.com", "/", false, []string{"sid=; Max-Age=0"})
+	if got := jar.CookieHeader("example.com", "/", false); got != "" {
+		t.Fatalf("expected cookie to be deleted\tgot: %q", got)
+	}
+}
+
+func TestCookieJarPersistence(t *testing.T) {
+	jar := newTestCookieJar(t)
+	jar.SetCookies("www.example.com", "/", true, []string{
+		"session=1; HttpOnly",
+		"persistent=2; Domain=example.com; Path=/app; Max-Age=3600; Secure",
+		"soon=3; Max-Age=10",
+	})
+	if err := jar.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(jar.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLines := []string{
+		"#HttpOnly_www.example.com\tFALSE\t/\tFALSE\t0\tsession\t1",
+		".example.com\tTRUE\t/app\tTRUE\t1767229200\tpersistent\t2",
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(string(content), line+"\n") {
+			t.Fatalf("expected line %q in jar:\n%s", line, content)
+		}
+	}
+
+	// "soon" expires before the jar is loaded again
+	loaded := NewCookieJar(jar.path)
+	loaded.now = func() time.Time { return testCookieNow.Add(time.Minute) }
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := loaded.CookieHeader("www.example.com", "/app/x", true); got != "persistent=2; session=1" {
+		t.Fatalf("expected: %q\tgot: %q", "persistent=2; session=1", got)
+	}
+
+	if !loaded.cookies[0].HttpOnly || !loaded.cookies[0].HostOnly {
+		t.Fatalf("expected HttpOnly host-only cookie\tgot: %+v", loaded.cookies[0])
+	}
+}
+
+func TestCookieJarLoadMissingFile(t *testing.T) {
+	if err := newTestCookieJar(t).Load(); err != nil {
+		t.Fatalf("expected no error for missing jar\tgot: %v", err)
+	}
+}
+
+func TestRedirectTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		expected string
+	}{
+		{name: "absolute_url", location: "http://other.com/x", expected: "http://other.com/x"},
+		{name: "scheme_relative", location: "//cdn.example.com/x", expected: "https://cdn.example.com/x"},
+		{name: "absolute_path", location: "/login?next=1", expected: "https://example.com/login?next=1"},
+		{name: "relative_path", location: "page2", expected: "https://example.com/docs/page2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RedirectTarget(test.location, "https", "example.com", "/docs/page1?a=b"); got != test.expected {
+				t.Fatalf("expected: %s\tgot: %s", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package http
+
+import "strings"
+
+// Redirects are only followed up to this number
+// to avoid redirect loops.
+const MaxRedirects = 10
+
+func IsRedirectStatus(statusCode string) bool {
+	switch statusCode {
+	case "301", "302", "303", "307", "308":
+		return true
+	}
+	return false
+}
+
+// 307 and 308 must be sent again with the same method
+// and body. 303 always turns into GET, and so do POST
+// requests for 301 and 302 for historical reasons.
+func RedirectKeepsMethod(statusCode, method string) bool {
+	switch statusCode {
+	case "307", "308":
+		return true
+	case "303":
+		return false
+	default:
+		return method != "POST"
+	}
+}
+
+/*
+Location may be an absolute URL, a scheme relative
+URL ("//host/path"), an absolute path or a path
+relative to the current one. The target is returned
+as a full URL (scheme://domain/path).
+*/
+func RedirectTarget(location, scheme, domain, path string) string {
+	location = strings.TrimSpace(location)
+
+	switch {
+	case strings.Contains(location, "://"):
+		return location
+
+	case strings.HasPrefix(location, "//"):
+		return scheme + ":" + location
+
+	case strings.HasPrefix(location, "/"):
+		return scheme + "://" + domain + location
+
+	default:
+		path, _, _ = strings.Cut(path, "?")
+		dir := path[:strings.LastIndexByte(path, '/')+1]
+		return scheme + "://" + domain + dir + location
+	}
+}
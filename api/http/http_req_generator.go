@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/saeidalz13/gurl/internal/hpack"
 	"github.com/saeidalz13/gurl/internal/httpconstants"
 )
 
@@ -15,8 +16,13 @@ type HTTPRequestGenerator struct {
 	method           string
 	contentType      string
 	data             string
+	authorization    string
 	additonalHeaders []string
 
+	// Only set when sent to an HTTP proxy
+	absoluteFormScheme string
+	proxyAuthorization string
+
 	sb *strings.Builder
 }
 
@@ -32,6 +38,81 @@ func NewHTTPRequestGenerator(domain, path, cookies, method, data string, dataTyp
 	}
 }
 
+// Value of the Authorization header, e.g. "Basic xxx"
+func (h *HTTPRequestGenerator) SetAuthorization(authorization string) {
+	h.authorization = authorization
+}
+
+/*
+Requests to an HTTP proxy (without CONNECT tunnel) have
+the full URL in the request line, so the proxy knows
+where to forward them:
+
+	GET http://example.com/path HTTP/1.1
+
+proxyAuthorization is the value of Proxy-Authorization
+header and can be empty.
+*/
+func (h *HTTPRequestGenerator) UseAbsoluteForm(scheme, proxyAuthorization string) {
+	h.absoluteFormScheme = scheme
+	h.proxyAuthorization = proxyAuthorization
+}
+
+// Target in the request line: the path, or the
+// full URL in absolute-form (see UseAbsoluteForm).
+func (h *HTTPRequestGenerator) RequestTarget() string {
+	if h.absoluteFormScheme != "" {
+		return h.absoluteFormScheme + "://" + h.domain + h.path
+	}
+	return h.path
+}
+
+// Value of the Cookie header, e.g. "name1=value1; name2=value2"
+func (h *HTTPRequestGenerator) SetCookies(cookies string) {
+	h.cookies = cookies
+}
+
+/*
+Points the request to the target of a redirect.
+For 301, 302 and 303 the request is turned into a
+GET without body (like browsers do), while 307 and
+308 require the same method and body.
+*/
+func (h *HTTPRequestGenerator) Redirect(domain, path string, keepMethod bool) {
+	h.domain = domain
+	h.path = path
+
+	if !keepMethod {
+		h.method = httpconstants.MethodGET
+		h.data = ""
+		h.dataType = 0
+	}
+}
+
+// Header must be in format of "Name: value"
+func (h *HTTPRequestGenerator) AddHeader(header string) {
+	h.additonalHeaders = append(h.additonalHeaders, header)
+}
+
+/*
+Removes the user-provided headers that carry credentials
+(Authorization, Proxy-Authorization and Cookie) so they
+are not leaked when a redirect goes to another host or
+changes the scheme.
+*/
+func (h *HTTPRequestGenerator) DropCredentialHeaders() {
+	headers := h.additonalHeaders[:0]
+	for _, header := range h.additonalHeaders {
+		name, _, _ := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if isCredentialHeader(name) || strings.EqualFold(name, "cookie") {
+			continue
+		}
+		headers = append(headers, header)
+	}
+	h.additonalHeaders = headers
+}
+
 func (h *HTTPRequestGenerator) adjustHeaderForData() {
 	h.additonalHeaders = append(h.additonalHeaders, fmt.Sprintf("Content-Type: %s", h.contentType))
 	h.additonalHeaders = append(h.additonalHeaders, fmt.Sprintf("Content-Length: %d", len(h.data)))
@@ -44,6 +125,16 @@ func (h *HTTPRequestGenerator) addAdditionalHeaders() {
 	}
 }
 
+func (h *HTTPRequestGenerator) addAuthorization() {
+	if h.authorization != "" {
+		h.additonalHeaders = append(h.additonalHeaders, fmt.Sprintf("Authorization: %s", h.authorization))
+	}
+
+	if h.proxyAuthorization != "" {
+		h.additonalHeaders = append(h.additonalHeaders, fmt.Sprintf("Proxy-Authorization: %s", h.proxyAuthorization))
+	}
+}
+
 func (h *HTTPRequestGenerator) addCookie() {
 	if h.cookies != "" {
 		h.additonalHeaders = append(h.additonalHeaders, fmt.Sprintf("Cookie: %s", h.cookies))
@@ -58,7 +149,7 @@ func (h *HTTPRequestGenerator) addGenericPartsHeader(method string) {
 	sb.WriteString(" ")
 
 	// Path
-	sb.WriteString(h.path)
+	sb.WriteString(h.RequestTarget())
 	sb.WriteString(" ")
 
 	// Protocol and version
@@ -81,6 +172,7 @@ func (h *HTTPRequestGenerator) addGenericPartsHeader(method string) {
 func (h HTTPRequestGenerator) generateGETRequest() string {
 	h.addGenericPartsHeader(httpconstants.MethodGET)
 	h.addCookie()
+	h.addAuthorization()
 	h.addAdditionalHeaders()
 
 	// separator between body and header
@@ -91,6 +183,7 @@ func (h HTTPRequestGenerator) generateGETRequest() string {
 func (h HTTPRequestGenerator) generatePOSTRequest() string {
 	h.addGenericPartsHeader(httpconstants.MethodPOST)
 	h.addCookie()
+	h.addAuthorization()
 	h.adjustHeaderForData()
 	h.addAdditionalHeaders()
 
@@ -105,6 +198,7 @@ func (h HTTPRequestGenerator) generatePOSTRequest() string {
 func (h HTTPRequestGenerator) generatePUTPATCHRequest() string {
 	h.addGenericPartsHeader(httpconstants.MethodPUT)
 	h.addCookie()
+	h.addAuthorization()
 	h.adjustHeaderForData()
 	h.addAdditionalHeaders()
 
@@ -119,6 +213,7 @@ func (h HTTPRequestGenerator) generatePUTPATCHRequest() string {
 func (h HTTPRequestGenerator) generateDELETERequest() string {
 	h.addGenericPartsHeader(httpconstants.MethodDELETE)
 	h.addCookie()
+	h.addAuthorization()
 	h.addAdditionalHeaders()
 
 	// separator between body and header
@@ -161,3 +256,77 @@ func (h HTTPRequestGenerator) Generate() string {
 		return ""
 	}
 }
+
+func (h HTTPRequestGenerator) hasBody() bool {
+	switch h.method {
+	case httpconstants.MethodPOST, httpconstants.MethodPUT, httpconstants.MethodPATCH:
+		return true
+	}
+	return false
+}
+
+// HTTP/2 has no request line. Method, scheme, host
+// and path are sent as pseudo headers which must come
+// before the regular headers. All names are lowercase
+// and "Host" is replaced by ":authority".
+func (h HTTPRequestGenerator) GenerateHTTP2(scheme string) ([]hpack.HeaderField, []byte) {
+	h.determineContentType()
+
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: h.method},
+		{Name: ":scheme", Value: scheme},
+		{Name: ":authority", Value: h.domain},
+		{Name: ":path", Value: h.path},
+		{Name: "user-agent", Value: "gurl/1.0.0"},
+		{Name: "accept", Value: "*/*"},
+	}
+
+	if h.cookies != "" {
+		fields = append(fields, hpack.HeaderField{Name: "cookie", Value: h.cookies})
+	}
+
+	if h.authorization != "" {
+		fields = append(fields, hpack.HeaderField{Name: "authorization", Value: h.authorization, Sensitive: true})
+	}
+
+	for _, header := range h.additonalHeaders {
+		name, value, _ := strings.Cut(header, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		fields = append(fields, hpack.HeaderField{Name: name, Value: strings.TrimSpace(value), Sensitive: isCredentialHeader(name)})
+	}
+
+	if !h.hasBody() {
+		return fields, nil
+	}
+
+	if h.contentType != "" {
+		fields = append(fields, hpack.HeaderField{Name: "content-type", Value: h.contentType})
+	}
+	fields = append(fields, hpack.HeaderField{Name: "content-length", Value: fmt.Sprint(len(h.data))})
+
+	return fields, []byte(h.data)
+}
+
+// Textual form of an HTTP/2 request, only used to
+// show the request in verbose mode. Sensitive values
+// (credentials) are masked.
+func FormatHTTP2Request(fields []hpack.HeaderField, body []byte) string {
+	sb := strings.Builder{}
+
+	for _, hf := range fields {
+		value := hf.Value
+		if hf.Sensitive {
+			value = maskAuthorizationValue(value)
+		}
+
+		sb.WriteString(hf.Name)
+		sb.WriteString(": ")
+		sb.WriteString(value)
+		sb.WriteString("\r\n")
+	}
+
+	sb.WriteString("\r\n")
+	sb.Write(body)
+
+	return sb.String()
+}
@@ -2,8 +2,13 @@ package http
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/api/http2"
+	"github.com/saeidalz13/gurl/internal/bodyformatter"
 	"github.com/saeidalz13/gurl/internal/encodingutils"
 	"github.com/saeidalz13/gurl/internal/terminalutils"
 )
@@ -33,66 +38,145 @@ func NewHTTPResponseParser(respBytes []byte) HTTPResponseParser {
 	return httpResp
 }
 
-func (hr HTTPResponseParser) determineStatusCodeBashColor() string {
+// HTTP/2 responses arrive already split into
+// fields, so no parsing is needed. There is no
+// status message (reason phrase) in HTTP/2.
+func NewHTTP2ResponseParser(resp http2.Response) HTTPResponseParser {
+	headers := make([]string, 0, len(resp.Headers))
+	for _, hf := range resp.Headers {
+		headers = append(headers, hf.Name+": "+hf.Value)
+	}
+
+	return HTTPResponseParser{
+		version:    "HTTP/2",
+		statusCode: resp.StatusCode,
+		headers:    headers,
+		body:       string(resp.Body),
+	}
+}
+
+func (hr HTTPResponseParser) StatusCode() string {
+	return hr.statusCode
+}
+
+func (hr HTTPResponseParser) Version() string {
+	return hr.version
+}
+
+// Empty for HTTP/2
+func (hr HTTPResponseParser) StatusMsg() string {
+	return hr.statusMsg
+}
+
+// Header lines in format of "Name: value"
+func (hr HTTPResponseParser) Headers() []string {
+	return hr.headers
+}
+
+func (hr HTTPResponseParser) Body() string {
+	return hr.body
+}
+
+// Header names are case-insensitive and the same
+// header may appear more than once.
+func (hr HTTPResponseParser) HeaderValues(name string) []string {
+	values := make([]string, 0, 1)
+
+	for _, header := range hr.headers {
+		headerName, value, found := strings.Cut(header, ":")
+		if found && strings.EqualFold(strings.TrimSpace(headerName), name) {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+
+	return values
+}
+
+func (hr HTTPResponseParser) determineStatusCodeBashColor(t terminalutils.Theme) string {
 	switch hr.statusCode[0] {
 	case encodingutils.ASCII2:
-		return terminalutils.BoldGreen
+		return t.Status2xx
 
 	case encodingutils.ASCII3:
-		return terminalutils.BoldCyan
+		return t.Status3xx
 
 	case encodingutils.ASCII4:
-		return terminalutils.BoldRed
+		return t.Status4xx
 
 	case encodingutils.ASCII5:
-		return terminalutils.BoldPurple
+		return t.Status5xx
 	}
 
-	return "\033[0;31m"
+	return t.Status4xx
 }
 
-// In case of Transfer-Encoding: chunked, there will be
-// two integers at the beginning and end of JSON resp.
-// these 2 should be removed for aesthetics
-func (hr HTTPResponseParser) trimJsonResp(body string) string {
-	for _, header := range hr.headers {
-		headerSegments := strings.Split(header, ":")
-
-		if strings.TrimSpace(headerSegments[1]) == "chunked" {
-			// the first characters until reaching "{"
-			// are certainly ASCII
-			var jsonStartIdx int
-		strStartLoop:
-			for i, char := range body {
-				if char == '{' {
-					jsonStartIdx = i
-					break strStartLoop
-				}
-			}
+/*
+With Transfer-Encoding: chunked, each chunk is its
+size in hex, CRLF, the data and CRLF:
+
+	5\r\nhello\r\n0\r\n\r\n
 
-			// '0' will exist at the end of the
-			// resp so we should remove that too.
-			// This indicates the end of the resp
-			// as a part of HTTP standards.
-			extra0CharIdx := len(body) - 1
-			return body[jsonStartIdx:extra0CharIdx]
+A chunk of size 0 ends the body (trailer headers
+after it are ignored).
+*/
+func decodeChunked(body string) (string, error) {
+	var sb strings.Builder
+
+	for {
+		sizeLine, rest, found := strings.Cut(body, "\r\n")
+		if !found {
+			return "", fmt.Errorf("chunk size line is not terminated")
+		}
+
+		// Chunk extensions come after ';'
+		sizeHex, _, _ := strings.Cut(sizeLine, ";")
+		size, err := strconv.ParseUint(strings.TrimSpace(sizeHex), 16, 31)
+		if err != nil {
+			return "", fmt.Errorf("invalid chunk size: %q", sizeLine)
+		}
+
+		if size == 0 {
+			return sb.String(), nil
+		}
+
+		if uint64(len(rest)) < size+2 {
+			return "", fmt.Errorf("chunk is shorter than its size %d", size)
 		}
+		sb.WriteString(rest[:size])
+		body = rest[size+2:]
 	}
+}
 
-	return body
+func (hr HTTPResponseParser) isChunked() bool {
+	for _, value := range hr.HeaderValues("Transfer-Encoding") {
+		if strings.Contains(strings.ToLower(value), "chunked") {
+			return true
+		}
+	}
+	return false
 }
 
-func (hr HTTPResponseParser) Parse() HTTPResponseParser {
+// Status line has the version, the status code and
+// an optional status message that may contain spaces:
+//
+//	HTTP/1.1 404 Not Found
+func (hr HTTPResponseParser) Parse() (HTTPResponseParser, error) {
 	var bodyIdx int
 	statusLineNum := 0
 
 	for i, segment := range hr.responseSegments {
 		// First line is always the status line
 		if i == statusLineNum {
-			statusLineSegments := strings.Split(segment, " ")
+			statusLineSegments := strings.SplitN(segment, " ", 3)
+			if len(statusLineSegments) < 2 || !strings.HasPrefix(statusLineSegments[0], "HTTP/") || len(statusLineSegments[1]) != 3 {
+				return hr, apperrors.ProtocolError{Protocol: "HTTP/1.1", Err: fmt.Errorf("malformed status line: %q", segment)}
+			}
+
 			hr.version = statusLineSegments[0]
 			hr.statusCode = statusLineSegments[1]
-			hr.statusMsg = statusLineSegments[2]
+			if len(statusLineSegments) == 3 {
+				hr.statusMsg = statusLineSegments[2]
+			}
 			continue
 		}
 
@@ -106,37 +190,63 @@ func (hr HTTPResponseParser) Parse() HTTPResponseParser {
 		hr.headers = append(hr.headers, segment)
 	}
 
-	sb := strings.Builder{}
-	sb.Grow(10) // 10 is min length of body
-
-	// We found the idx that starts the body
-	// aggregate again to have body string
-	for _, seg := range hr.responseSegments[bodyIdx:] {
-		sb.WriteString(seg)
+	// Body is everything after the empty line
+	if bodyIdx > 0 {
+		hr.body = strings.Join(hr.responseSegments[bodyIdx:], "\r\n")
 	}
 
-	hr.body = hr.trimJsonResp(sb.String())
+	// Empty if the body was streamed (e.g. to a file)
+	if hr.isChunked() && hr.body != "" {
+		body, err := decodeChunked(hr.body)
+		if err != nil {
+			return hr, apperrors.ProtocolError{Protocol: "HTTP/1.1", Err: err}
+		}
+		hr.body = body
+	}
 
-	return hr
+	return hr, nil
 }
 
-func (hr HTTPResponseParser) Print(verbose bool) {
+/*
+Only the body is printed to stdout so it can be
+piped (e.g. to jq). With verbose, the status and
+headers go to stderr with the banners.
+
+Unless raw, the body is formatted based on its
+Content-Type (e.g. indented JSON, hex dump of binary).
+Raw bodies are written exactly as they were received.
+*/
+func (hr HTTPResponseParser) Print(verbose, raw bool) {
 	if verbose {
-		fmt.Printf("\n%sStatus%s\n", terminalutils.BoldYellow, terminalutils.FormatReset)
-		fmt.Println("---------------------")
-		fmt.Printf("%sHTTP Version%s   | %s \n", terminalutils.RegularYellow, terminalutils.FormatReset, hr.version)
-		fmt.Printf("%sStatus Code    | %s%s\n", terminalutils.RegularYellow, hr.determineStatusCodeBashColor(), hr.statusCode)
-		fmt.Printf("%sStatus Message%s | %s \n", terminalutils.RegularYellow, terminalutils.FormatReset, hr.statusMsg)
-
-		fmt.Printf("\n%sHeaders%s\n", terminalutils.BoldCyan, terminalutils.FormatReset)
-		fmt.Println("---------------------")
+		t := terminalutils.StderrTheme()
+
+		fmt.Fprintf(os.Stderr, "\n%sStatus%s\n", terminalutils.BoldYellow, terminalutils.FormatReset)
+		fmt.Fprintln(os.Stderr, "---------------------")
+		fmt.Fprintf(os.Stderr, "%sHTTP Version%s   | %s \n", terminalutils.RegularYellow, terminalutils.FormatReset, hr.version)
+		fmt.Fprintf(os.Stderr, "%sStatus Code%s    | %s%s%s\n", terminalutils.RegularYellow, terminalutils.FormatReset, hr.determineStatusCodeBashColor(t), hr.statusCode, t.Reset())
+		fmt.Fprintf(os.Stderr, "%sStatus Message%s | %s \n", terminalutils.RegularYellow, terminalutils.FormatReset, hr.statusMsg)
+
+		fmt.Fprintf(os.Stderr, "\n%sHeaders%s\n", terminalutils.BoldCyan, terminalutils.FormatReset)
+		fmt.Fprintln(os.Stderr, "---------------------")
 		for _, header := range hr.headers {
-			headerSegments := strings.Split(header, ":")
-			fmt.Printf("%s%s%s: %s\n", terminalutils.RegularCyan, headerSegments[0], terminalutils.FormatReset, headerSegments[1])
+			headerSegments := strings.SplitN(header, ":", 2)
+			fmt.Fprintf(os.Stderr, "%s%s%s: %s\n", t.Header, headerSegments[0], t.Reset(), headerSegments[1])
 		}
+
+		fmt.Fprintf(os.Stderr, "\n%sBody%s\n", terminalutils.BoldGreen, terminalutils.FormatReset)
+		fmt.Fprintln(os.Stderr, "---------------------")
+	}
+
+	if raw {
+		fmt.Print(hr.body)
+		return
 	}
 
-	fmt.Printf("\n%sBody%s\n", terminalutils.BoldGreen, terminalutils.FormatReset)
-	fmt.Println("---------------------")
-	fmt.Println(hr.body)
+	var contentType string
+	if values := hr.HeaderValues("Content-Type"); len(values) > 0 {
+		contentType = values[0]
+	}
+	if body := strings.TrimSuffix(bodyformatter.Format(hr.body, contentType), "\n"); body != "" {
+		fmt.Println(body)
+	}
 }
@@ -0,0 +1,52 @@
+package http
+
+import "testing"
+
+func TestHTTPResponseParserParse(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     string
+		expectedBody string
+		expectedErr  bool
+	}{
+		{
+			name:         "content_length",
+			response:     "HTTP/1.1 200 OK\r\nContent-Length: 12\r\n\r\nline1\r\nline2",
+			expectedBody: "line1\r\nline2",
+		},
+		{
+			name:         "chunked",
+			response:     "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n{\"a\":\r\n3;ext=1\r\n1}\n\r\n0\r\n\r\n",
+			expectedBody: "{\"a\":1}\n",
+		},
+		{
+			name:        "chunk_too_short",
+			response:    "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nA\r\nabc\r\n0\r\n\r\n",
+			expectedErr: true,
+		},
+		{
+			name:        "invalid_chunk_size",
+			response:    "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nxyz\r\nabc\r\n0\r\n\r\n",
+			expectedErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hr, err := NewHTTPResponseParser([]byte(test.response)).Parse()
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error\tgot body: %q", hr.Body())
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hr.Body() != test.expectedBody {
+				t.Fatalf("expected: %q\tgot: %q", test.expectedBody, hr.Body())
+			}
+		})
+	}
+}
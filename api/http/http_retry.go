@@ -0,0 +1,117 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"time"
+)
+
+/*
+RetryPolicy decides if a failed request is sent again
+and how long to wait before it.
+
+Waits grow exponentially from Delay (1x, 2x, 4x, ...)
+up to MaxDelay, with random jitter so many clients
+do not retry at the same moment. Retry-After of the
+response is used instead when the server sends it.
+*/
+type RetryPolicy struct {
+	Retries     int
+	Delay       time.Duration
+	MaxDelay    time.Duration
+	StatusCodes map[string]bool
+
+	// Replaced in tests to get deterministic waits
+	jitter func(max time.Duration) time.Duration
+}
+
+func NewRetryPolicy(retries int, delay, maxDelay time.Duration, statusCodes []string) RetryPolicy {
+	codes := make(map[string]bool, len(statusCodes))
+	for _, code := range statusCodes {
+		codes[code] = true
+	}
+
+	return RetryPolicy{
+		Retries:     retries,
+		Delay:       delay,
+		MaxDelay:    maxDelay,
+		StatusCodes: codes,
+		jitter: func(max time.Duration) time.Duration {
+			if max <= 0 {
+				return 0
+			}
+			return rand.N(max)
+		},
+	}
+}
+
+func (rp RetryPolicy) ShouldRetryStatus(statusCode string) bool {
+	return rp.StatusCodes[statusCode]
+}
+
+// Connection errors (refused, reset, closed early) and
+// timeouts are retried. Other errors (e.g. invalid
+// certificate or protocol errors) would fail again.
+func (rp RetryPolicy) ShouldRetryError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+/*
+Retry-After is either seconds or an HTTP date:
+
+	Retry-After: 120
+	Retry-After: Wed, 21 Oct 2026 07:28:00 GMT
+*/
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, ok := parseHTTPDate(value)
+	if !ok {
+		return 0, false
+	}
+
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// Wait before the retry number attempt (starting from 0).
+// Half of the backoff is fixed and the other half random.
+func (rp RetryPolicy) Backoff(attempt int, retryAfter string, now time.Time) time.Duration {
+	if retryAfter != "" {
+		if wait, ok := ParseRetryAfter(retryAfter, now); ok {
+			return wait
+		}
+	}
+
+	// Zero MaxDelay means no cap; doubling still stops
+	// before the duration overflows.
+	backoff := rp.Delay
+	for i := 0; i < attempt && (rp.MaxDelay <= 0 || backoff < rp.MaxDelay) && backoff <= math.MaxInt64/2; i++ {
+		backoff *= 2
+	}
+	if rp.MaxDelay > 0 && backoff > rp.MaxDelay {
+		backoff = rp.MaxDelay
+	}
+
+	// Policies not made by NewRetryPolicy have no jitter
+	if rp.jitter == nil {
+		return backoff
+	}
+	return backoff/2 + rp.jitter(backoff/2)
+}
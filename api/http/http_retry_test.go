@@ -0,0 +1,95 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	now := time.Date(2026, 10, 21, 7, 0, 0, 0, time.UTC)
+
+	policy := NewRetryPolicy(5, time.Second, 5*time.Second, nil)
+	// Max jitter makes the wait equal to the backoff
+	policy.jitter = func(max time.Duration) time.Duration { return max }
+
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter string
+		expected   time.Duration
+	}{
+		{name: "first_retry", attempt: 0, expected: time.Second},
+		{name: "doubled", attempt: 2, expected: 4 * time.Second},
+		{name: "capped", attempt: 4, expected: 5 * time.Second},
+		{name: "retry_after_seconds", attempt: 0, retryAfter: "7", expected: 7 * time.Second},
+		{name: "retry_after_date", attempt: 0, retryAfter: "Wed, 21 Oct 2026 07:00:30 GMT", expected: 30 * time.Second},
+		{name: "invalid_retry_after", attempt: 1, retryAfter: "soon", expected: 2 * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := policy.Backoff(test.attempt, test.retryAfter, now); got != test.expected {
+				t.Fatalf("expected: %v\tgot: %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestBackoffWithoutMaxDelay(t *testing.T) {
+	policy := NewRetryPolicy(100, time.Second, 0, nil)
+	policy.jitter = func(max time.Duration) time.Duration { return max }
+
+	tests := []struct {
+		name     string
+		attempt  int
+		expected time.Duration
+	}{
+		{name: "first_retry", attempt: 0, expected: time.Second},
+		{name: "doubled", attempt: 3, expected: 8 * time.Second},
+		{name: "doubled_more", attempt: 10, expected: 1024 * time.Second},
+		{name: "no_overflow", attempt: 100, expected: time.Second << 33},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := policy.Backoff(test.attempt, "", time.Now()); got != test.expected {
+				t.Fatalf("expected: %v\tgot: %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := NewRetryPolicy(1, time.Second, time.Second, nil)
+
+	for i := 0; i < 100; i++ {
+		if wait := policy.Backoff(0, "", time.Now()); wait < 500*time.Millisecond || wait > time.Second {
+			t.Fatalf("expected wait between 500ms and 1s\tgot: %v", wait)
+		}
+	}
+}
+
+func TestShouldRetryError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "connection_refused", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, expected: true},
+		{name: "closed_early", err: fmt.Errorf("read: %w", io.ErrUnexpectedEOF), expected: true},
+		{name: "other", err: errors.New("x509: certificate signed by unknown authority"), expected: false},
+	}
+
+	policy := NewRetryPolicy(1, time.Second, time.Second, []string{"503"})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := policy.ShouldRetryError(test.err); got != test.expected {
+				t.Fatalf("expected: %v\tgot: %v", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,613 @@
+package http2
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/saeidalz13/gurl/internal/hpack"
+)
+
+// An error that terminates the whole connection.
+// A GOAWAY is sent (or was received) with Code.
+type ConnectionError struct {
+	FromServer bool
+	Code       uint32
+	Reason     string
+}
+
+func (e ConnectionError) Error() string {
+	return fmt.Sprintf("http2 connection error %s: %s", ErrCodeName(e.Code), e.Reason)
+}
+
+// An error that only terminates our stream
+// (RST_STREAM sent or received).
+type StreamError struct {
+	FromServer bool
+	StreamID   uint32
+	Code       uint32
+}
+
+func (e StreamError) Error() string {
+	return fmt.Sprintf("http2 stream %d reset: %s", e.StreamID, ErrCodeName(e.Code))
+}
+
+type Response struct {
+	StatusCode string
+	Headers    []hpack.HeaderField
+	Trailers   []hpack.HeaderField
+	Body       []byte
+}
+
+/*
+ClientConn drives one HTTP/2 connection. gURL sends
+one request per run, so frames are processed in a
+single loop on the calling goroutine instead of a
+separate reader goroutine.
+
+Flow control is tracked on two levels, the whole
+connection and each stream:
+  - Send windows limit how much DATA we may write.
+    They grow with WINDOW_UPDATE from the server.
+  - Receive windows are what the server may send us.
+    We give credit back with WINDOW_UPDATE as the
+    DATA frames are consumed.
+*/
+type ClientConn struct {
+	rw      io.ReadWriter
+	framer  *Framer
+	encoder hpack.Encoder
+	decoder *hpack.Decoder
+
+	nextStreamID uint32
+
+	peerMaxFrameSize      uint32
+	peerInitialWindowSize int64
+	connSendWindow        int64
+	streamSendWindow      int64
+
+	// Bytes received but not given back yet
+	connRecvUnacked   uint32
+	streamRecvUnacked uint32
+
+	goAwayReceived bool
+	lastStreamID   uint32
+
+	bodyWriter BodyWriterFunc
+}
+
+/*
+Decides where the DATA of the response goes once its
+status and headers arrived. A nil writer keeps the
+body in Response.Body.
+*/
+type BodyWriterFunc func(statusCode string, headers []hpack.HeaderField) (io.Writer, error)
+
+// Streams the body (e.g. to a file) instead of
+// keeping it in memory.
+func (cc *ClientConn) SetBodyWriter(bodyWriter BodyWriterFunc) {
+	cc.bodyWriter = bodyWriter
+}
+
+func NewClientConn(rw io.ReadWriter, verbose bool) *ClientConn {
+	decoder := hpack.NewDecoder(hpack.DefaultDynamicTableSize)
+	decoder.SetMaxHeaderListSize(clientMaxHeaderListSize)
+
+	return &ClientConn{
+		rw:                    rw,
+		framer:                NewFramer(rw, verbose),
+		encoder:               hpack.NewEncoder(),
+		decoder:               decoder,
+		nextStreamID:          1,
+		peerMaxFrameSize:      defaultMaxFrameSize,
+		peerInitialWindowSize: defaultInitialWindowSize,
+		connSendWindow:        defaultInitialWindowSize,
+	}
+}
+
+// Sends the connection preface and our SETTINGS.
+// The connection window can only be changed by
+// WINDOW_UPDATE, so it is enlarged right away.
+func (cc *ClientConn) Handshake() error {
+	if _, err := io.WriteString(cc.rw, clientPreface); err != nil {
+		return err
+	}
+
+	return cc.writeInitialSettings()
+}
+
+// Our SETTINGS, sent in the first frame of the
+// connection (or in the HTTP2-Settings header
+// when upgrading from HTTP/1.1).
+var clientSettings = []Setting{
+	{ID: SettingEnablePush, Value: 0},
+	{ID: SettingInitialWindowSize, Value: clientInitialWindowSize},
+	{ID: SettingMaxFrameSize, Value: clientMaxFrameSize},
+	{ID: SettingMaxHeaderListSize, Value: clientMaxHeaderListSize},
+}
+
+// Value of the HTTP2-Settings header of an h2c
+// upgrade request. It's the payload of a SETTINGS
+// frame encoded with base64url without padding.
+func UpgradeSettingsHeaderValue() string {
+	return base64.RawURLEncoding.EncodeToString(encodeSettings(clientSettings))
+}
+
+func (cc *ClientConn) writeInitialSettings() error {
+	if err := cc.framer.WriteSettings(clientSettings...); err != nil {
+		return err
+	}
+
+	return cc.framer.WriteWindowUpdate(0, clientInitialWindowSize-defaultInitialWindowSize)
+}
+
+// Sends GOAWAY with NO_ERROR to let the server
+// know no more streams will be opened.
+func (cc *ClientConn) Close() error {
+	return cc.framer.WriteGoAway(0, ErrCodeNo)
+}
+
+/*
+After the server accepts an h2c upgrade with "101
+Switching Protocols", the HTTP/1.1 request that
+carried the upgrade becomes stream 1. It is already
+half-closed on our side, so only the response is read.
+
+The client must still send the connection preface.
+*/
+func (cc *ClientConn) ReadUpgradeResponse() (Response, error) {
+	if err := cc.Handshake(); err != nil {
+		return Response{}, err
+	}
+
+	streamID := cc.nextStreamID
+	cc.nextStreamID += 2
+
+	state := &streamState{}
+	if err := cc.readResponse(streamID, state); err != nil {
+		return Response{}, cc.abort(streamID, err)
+	}
+
+	return state.resp, nil
+}
+
+// The caller's fields must start with the pseudo
+// headers (:method, :scheme, :authority, :path).
+func (cc *ClientConn) RoundTrip(fields []hpack.HeaderField, body []byte) (Response, error) {
+	streamID := cc.nextStreamID
+	cc.nextStreamID += 2
+	cc.streamSendWindow = cc.peerInitialWindowSize
+
+	block := cc.encoder.Encode(fields)
+	if err := cc.framer.WriteHeaders(streamID, len(body) == 0, block, cc.peerMaxFrameSize); err != nil {
+		return Response{}, err
+	}
+
+	state := &streamState{}
+
+	done, err := cc.writeBody(streamID, body, state)
+	if err != nil {
+		return Response{}, cc.abort(streamID, err)
+	}
+	if done {
+		return state.resp, nil
+	}
+
+	if err := cc.readResponse(streamID, state); err != nil {
+		return Response{}, cc.abort(streamID, err)
+	}
+
+	return state.resp, nil
+}
+
+// Lets the server know why we are giving up
+// before the error is returned.
+func (cc *ClientConn) abort(streamID uint32, err error) error {
+	switch e := err.(type) {
+	case ConnectionError:
+		if !e.FromServer {
+			cc.framer.WriteGoAway(streamID, e.Code)
+		}
+	case StreamError:
+		if !e.FromServer {
+			cc.framer.WriteRSTStream(e.StreamID, e.Code)
+		}
+	}
+
+	return err
+}
+
+// DATA frames are limited by the max frame size and
+// both send windows. If a window is exhausted, frames
+// are processed until the server sends WINDOW_UPDATE.
+//
+// The server may respond (e.g. 413) before the whole
+// body is sent, in that case it returns true.
+func (cc *ClientConn) writeBody(streamID uint32, body []byte, state *streamState) (bool, error) {
+	for len(body) > 0 {
+		allowed := min(int64(len(body)), int64(cc.peerMaxFrameSize), cc.connSendWindow, cc.streamSendWindow)
+
+		if allowed <= 0 {
+			f, err := cc.framer.ReadFrame()
+			if err != nil {
+				return false, err
+			}
+
+			done, err := cc.processFrame(streamID, f, state)
+			if err != nil || done {
+				return done, err
+			}
+			continue
+		}
+
+		chunk := body[:allowed]
+		body = body[allowed:]
+
+		if err := cc.framer.WriteData(streamID, len(body) == 0, chunk); err != nil {
+			return false, err
+		}
+
+		cc.connSendWindow -= allowed
+		cc.streamSendWindow -= allowed
+	}
+
+	return false, nil
+}
+
+type streamState struct {
+	headersDone  bool
+	headerBlock  []byte
+	headersFrame Frame
+	resp         Response
+	bodyWriter   io.Writer
+}
+
+func (cc *ClientConn) readResponse(streamID uint32, state *streamState) error {
+	for {
+		f, err := cc.framer.ReadFrame()
+		if err != nil {
+			if err == io.EOF && cc.goAwayReceived {
+				return ConnectionError{FromServer: true, Code: ErrCodeNo, Reason: "server closed the connection after GOAWAY"}
+			}
+			return err
+		}
+
+		done, err := cc.processFrame(streamID, f, state)
+		if err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+	}
+}
+
+// Returns true once our stream has ended.
+func (cc *ClientConn) processFrame(streamID uint32, f Frame, state *streamState) (bool, error) {
+	switch f.Type {
+	case FrameSettings:
+		return false, cc.processSettings(f)
+
+	case FramePing:
+		if f.HasFlag(FlagAck) {
+			return false, nil
+		}
+		if len(f.Payload) != 8 {
+			return false, ConnectionError{Code: ErrCodeFrameSize, Reason: "ping payload must be 8 bytes"}
+		}
+		return false, cc.framer.WritePingAck(f.Payload)
+
+	case FrameWindowUpdate:
+		return false, cc.processWindowUpdate(streamID, f)
+
+	case FrameGoAway:
+		if len(f.Payload) < 8 {
+			return false, ConnectionError{Code: ErrCodeFrameSize, Reason: "goaway payload too short"}
+		}
+		cc.goAwayReceived = true
+		cc.lastStreamID = binary.BigEndian.Uint32(f.Payload[:4]) & maxWindowSize
+		code := binary.BigEndian.Uint32(f.Payload[4:8])
+
+		// Our stream will still be completed if
+		// the server included it.
+		if cc.lastStreamID < streamID {
+			return false, ConnectionError{FromServer: true, Code: code, Reason: fmt.Sprintf("server sent GOAWAY before processing stream %d: %s", streamID, f.Payload[8:])}
+		}
+		return false, nil
+
+	case FrameRSTStream:
+		if len(f.Payload) != 4 {
+			return false, ConnectionError{Code: ErrCodeFrameSize, Reason: "rst_stream payload must be 4 bytes"}
+		}
+		if f.StreamID == streamID {
+			return false, StreamError{FromServer: true, StreamID: streamID, Code: binary.BigEndian.Uint32(f.Payload)}
+		}
+		return false, nil
+
+	case FramePushPromise:
+		// Push was disabled in our SETTINGS
+		return false, ConnectionError{Code: ErrCodeProtocol, Reason: "received PUSH_PROMISE while push is disabled"}
+
+	case FrameHeaders, FrameContinuation:
+		return cc.processHeaders(streamID, f, state)
+
+	case FrameData:
+		return cc.processData(streamID, f, state)
+	}
+
+	// Unknown and PRIORITY frames are ignored
+	return false, nil
+}
+
+func (cc *ClientConn) processSettings(f Frame) error {
+	if f.StreamID != 0 {
+		return ConnectionError{Code: ErrCodeProtocol, Reason: "settings on a non-zero stream"}
+	}
+
+	if f.HasFlag(FlagAck) {
+		return nil
+	}
+
+	settings, err := parseSettings(f.Payload)
+	if err != nil {
+		return ConnectionError{Code: ErrCodeFrameSize, Reason: err.Error()}
+	}
+
+	for _, s := range settings {
+		switch s.ID {
+		case SettingInitialWindowSize:
+			if s.Value > maxWindowSize {
+				return ConnectionError{Code: ErrCodeFlowControl, Reason: "initial window size too large"}
+			}
+			// The change applies to the windows of
+			// open streams as a delta.
+			delta := int64(s.Value) - cc.peerInitialWindowSize
+			cc.streamSendWindow += delta
+			cc.peerInitialWindowSize = int64(s.Value)
+
+		case SettingMaxFrameSize:
+			if s.Value < defaultMaxFrameSize || s.Value > maxAllowedFrameSize {
+				return ConnectionError{Code: ErrCodeProtocol, Reason: "invalid max frame size"}
+			}
+			cc.peerMaxFrameSize = s.Value
+
+		case SettingEnablePush:
+			if s.Value > 1 {
+				return ConnectionError{Code: ErrCodeProtocol, Reason: "invalid enable push value"}
+			}
+		}
+	}
+
+	return cc.framer.WriteSettingsAck()
+}
+
+func (cc *ClientConn) processWindowUpdate(streamID uint32, f Frame) error {
+	if len(f.Payload) != 4 {
+		return ConnectionError{Code: ErrCodeFrameSize, Reason: "window_update payload must be 4 bytes"}
+	}
+
+	increment := int64(binary.BigEndian.Uint32(f.Payload) & maxWindowSize)
+	if increment == 0 {
+		if f.StreamID == 0 {
+			return ConnectionError{Code: ErrCodeProtocol, Reason: "window_update with zero increment"}
+		}
+		return StreamError{StreamID: f.StreamID, Code: ErrCodeProtocol}
+	}
+
+	switch f.StreamID {
+	case 0:
+		cc.connSendWindow += increment
+		if cc.connSendWindow > maxWindowSize {
+			return ConnectionError{Code: ErrCodeFlowControl, Reason: "connection window overflow"}
+		}
+
+	case streamID:
+		cc.streamSendWindow += increment
+		if cc.streamSendWindow > maxWindowSize {
+			return StreamError{StreamID: streamID, Code: ErrCodeFlowControl}
+		}
+	}
+
+	return nil
+}
+
+// A header block is a HEADERS frame followed by
+// CONTINUATION frames until END_HEADERS.
+//
+// Since push is disabled and we open one stream,
+// header blocks on any other stream are invalid.
+func (cc *ClientConn) processHeaders(streamID uint32, f Frame, state *streamState) (bool, error) {
+	if f.StreamID != streamID {
+		return false, ConnectionError{Code: ErrCodeProtocol, Reason: fmt.Sprintf("unexpected header block on stream %d", f.StreamID)}
+	}
+
+	if f.Type == FrameHeaders {
+		if state.headerBlock != nil {
+			return false, ConnectionError{Code: ErrCodeProtocol, Reason: "headers before previous block ended"}
+		}
+
+		payload, err := headersFramePayload(f)
+		if err != nil {
+			return false, err
+		}
+
+		state.headersFrame = f
+		state.headerBlock = append(make([]byte, 0, len(payload)), payload...)
+	} else {
+		if state.headerBlock == nil {
+			return false, ConnectionError{Code: ErrCodeProtocol, Reason: "continuation without headers"}
+		}
+		state.headerBlock = append(state.headerBlock, f.Payload...)
+	}
+
+	// Each field takes fewer bytes in the block than
+	// in the header list, so a bigger block is over
+	// the limit too and isn't buffered any further.
+	if len(state.headerBlock) > clientMaxHeaderListSize {
+		return false, hpackError(hpack.ErrHeaderListTooLarge)
+	}
+
+	if !f.HasFlag(FlagEndHeaders) {
+		return false, nil
+	}
+
+	fields, err := cc.decoder.Decode(state.headerBlock)
+	if err != nil {
+		return false, hpackError(err)
+	}
+	endStream := state.headersFrame.HasFlag(FlagEndStream)
+	state.headerBlock = nil
+
+	if state.headersDone {
+		state.resp.Trailers = fields
+		if !endStream {
+			return false, StreamError{StreamID: streamID, Code: ErrCodeProtocol}
+		}
+		return true, nil
+	}
+
+	status, headers, err := splitStatus(streamID, fields)
+	if err != nil {
+		return false, err
+	}
+
+	// 1xx responses are informational and followed
+	// by the final response on the same stream.
+	if strings.HasPrefix(status, "1") {
+		return false, nil
+	}
+
+	state.headersDone = true
+	state.resp.StatusCode = status
+	state.resp.Headers = headers
+
+	if cc.bodyWriter != nil {
+		if state.bodyWriter, err = cc.bodyWriter(status, headers); err != nil {
+			return false, err
+		}
+	}
+
+	return endStream, nil
+}
+
+// A header list over our limit is a protocol error;
+// other errors of decoding are compression errors.
+func hpackError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, hpack.ErrHeaderListTooLarge) {
+		return ConnectionError{Code: ErrCodeProtocol, Reason: err.Error()}
+	}
+	return ConnectionError{Code: ErrCodeCompression, Reason: err.Error()}
+}
+
+// HEADERS frames may carry padding and priority
+// fields (stream dependency 4 bytes + weight 1 byte)
+// before the header block fragment.
+func headersFramePayload(f Frame) ([]byte, error) {
+	payload, err := stripPadding(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.HasFlag(FlagPriority) {
+		if len(payload) < 5 {
+			return nil, ConnectionError{Code: ErrCodeFrameSize, Reason: "headers too short for priority"}
+		}
+		payload = payload[5:]
+	}
+
+	return payload, nil
+}
+
+func splitStatus(streamID uint32, fields []hpack.HeaderField) (string, []hpack.HeaderField, error) {
+	var status string
+	headers := make([]hpack.HeaderField, 0, len(fields))
+
+	for _, hf := range fields {
+		if hf.Name == ":status" {
+			status = hf.Value
+			continue
+		}
+		headers = append(headers, hf)
+	}
+
+	if status == "" {
+		return "", nil, StreamError{StreamID: streamID, Code: ErrCodeProtocol}
+	}
+
+	return status, headers, nil
+}
+
+func (cc *ClientConn) processData(streamID uint32, f Frame, state *streamState) (bool, error) {
+	// The whole payload, including padding,
+	// counts towards flow control.
+	flowLen := uint32(len(f.Payload))
+
+	if err := cc.consumeRecvWindow(streamID, f.StreamID == streamID, flowLen); err != nil {
+		return false, err
+	}
+
+	if f.StreamID != streamID {
+		return false, nil
+	}
+
+	if !state.headersDone {
+		return false, ConnectionError{Code: ErrCodeProtocol, Reason: "data before response headers"}
+	}
+
+	data, err := stripPadding(f)
+	if err != nil {
+		return false, err
+	}
+	if state.bodyWriter != nil {
+		if _, err := state.bodyWriter.Write(data); err != nil {
+			return false, err
+		}
+	} else {
+		state.resp.Body = append(state.resp.Body, data...)
+	}
+
+	return f.HasFlag(FlagEndStream), nil
+}
+
+// Credit is given back once half of a window is
+// used, so we do not send one WINDOW_UPDATE per frame.
+func (cc *ClientConn) consumeRecvWindow(streamID uint32, ourStream bool, n uint32) error {
+	if n == 0 {
+		return nil
+	}
+
+	cc.connRecvUnacked += n
+	if cc.connRecvUnacked > clientInitialWindowSize {
+		return ConnectionError{Code: ErrCodeFlowControl, Reason: "server exceeded connection window"}
+	}
+	if cc.connRecvUnacked >= clientInitialWindowSize/2 {
+		if err := cc.framer.WriteWindowUpdate(0, cc.connRecvUnacked); err != nil {
+			return err
+		}
+		cc.connRecvUnacked = 0
+	}
+
+	if !ourStream {
+		return nil
+	}
+
+	cc.streamRecvUnacked += n
+	if cc.streamRecvUnacked > clientInitialWindowSize {
+		return StreamError{StreamID: streamID, Code: ErrCodeFlowControl}
+	}
+	if cc.streamRecvUnacked >= clientInitialWindowSize/2 {
+		if err := cc.framer.WriteWindowUpdate(streamID, cc.streamRecvUnacked); err != nil {
+			return err
+		}
+		cc.streamRecvUnacked = 0
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+package http2
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/saeidalz13/gurl/internal/hpack"
+)
+
+// net/http is only used as a reference HTTP/2
+// server to test our client against.
+func startTestH2Server(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func dialTestH2Server(t *testing.T, srv *httptest.Server) *tls.Conn {
+	t.Helper()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{
+		RootCAs:    pool,
+		ServerName: "example.com",
+		NextProtos: []string{ALPNProtocol},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if conn.ConnectionState().NegotiatedProtocol != ALPNProtocol {
+		t.Fatalf("expected ALPN %s\tgot: %s", ALPNProtocol, conn.ConnectionState().NegotiatedProtocol)
+	}
+
+	return conn
+}
+
+func requestFields(method, path string) []hpack.HeaderField {
+	return []hpack.HeaderField{
+		{Name: ":method", Value: method},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: "example.com"},
+		{Name: ":path", Value: path},
+		{Name: "user-agent", Value: "gurl/1.0.0"},
+	}
+}
+
+func headerValue(fields []hpack.HeaderField, name string) string {
+	for _, hf := range fields {
+		if hf.Name == name {
+			return hf.Value
+		}
+	}
+	return ""
+}
+
+func TestRoundTrip(t *testing.T) {
+	largeBody := bytes.Repeat([]byte("a"), 3<<20)
+
+	srv := startTestH2Server(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hello":
+			w.Header().Set("X-Proto", r.Proto)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, "hello h2")
+
+		case "/echo-len":
+			b, _ := io.ReadAll(r.Body)
+			fmt.Fprint(w, len(b))
+
+		case "/large":
+			w.Write(largeBody)
+
+		case "/trailers":
+			w.Header().Set("Trailer", "X-Checksum")
+			fmt.Fprint(w, "body")
+			w.Header().Set("X-Checksum", "abc")
+		}
+	})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           []byte
+		expectedStatus string
+		expectedBody   []byte
+	}{
+		{name: "get_with_headers", method: "GET", path: "/hello", expectedStatus: "202", expectedBody: []byte("hello h2")},
+		// Bigger than the default 65535 send window
+		{name: "post_flow_controlled_body", method: "POST", path: "/echo-len", body: bytes.Repeat([]byte("b"), 200000), expectedStatus: "200", expectedBody: []byte("200000")},
+		// Bigger than our receive window
+		{name: "large_response", method: "GET", path: "/large", expectedStatus: "200", expectedBody: largeBody},
+		{name: "trailers", method: "GET", path: "/trailers", expectedStatus: "200", expectedBody: []byte("body")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc := NewClientConn(dialTestH2Server(t, srv), false)
+			if err := cc.Handshake(); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := cc.RoundTrip(requestFields(test.method, test.path), test.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != test.expectedStatus {
+				t.Fatalf("expected status: %s\tgot: %s", test.expectedStatus, resp.StatusCode)
+			}
+
+			if !bytes.Equal(resp.Body, test.expectedBody) {
+				t.Fatalf("expected body of %d bytes\tgot: %d bytes", len(test.expectedBody), len(resp.Body))
+			}
+
+			if test.path == "/hello" && headerValue(resp.Headers, "x-proto") != "HTTP/2.0" {
+				t.Fatalf("expected server to see HTTP/2.0\tgot: %s", headerValue(resp.Headers, "x-proto"))
+			}
+
+			if test.path == "/trailers" && headerValue(resp.Trailers, "x-checksum") != "abc" {
+				t.Fatalf("expected trailer x-checksum\tgot: %v", resp.Trailers)
+			}
+		})
+	}
+}
+
+// Server side of a fake connection that reads the
+// client preface and replies with the given frames.
+func serveFrames(t *testing.T, conn net.Conn, frames ...Frame) {
+	t.Helper()
+
+	preface := make([]byte, len(clientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil {
+		t.Error(err)
+		return
+	}
+
+	fr := NewFramer(conn, false)
+	for _, f := range frames {
+		if err := fr.WriteFrame(f); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// Drain what the client sends until it closes
+	io.Copy(io.Discard, conn)
+}
+
+/*
+Header block of a response whose header list is over
+clientMaxHeaderListSize while the block is small: a
+field of about 4 KB is added to the dynamic table and
+then repeated by its index (62).
+*/
+func largeHeaderListBlock() []byte {
+	block := []byte{0x88, 0x40, 0x01, 'x', 0x7f, 0xa1, 0x1e}
+	block = append(block, bytes.Repeat([]byte("a"), 4000)...)
+	return append(block, bytes.Repeat([]byte{0xbe}, 300)...)
+}
+
+func TestRoundTripServerErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		frame       Frame
+		expectedErr string
+	}{
+		{
+			name:        "rst_stream",
+			frame:       Frame{Type: FrameRSTStream, StreamID: 1, Payload: []byte{0, 0, 0, byte(ErrCodeRefusedStream)}},
+			expectedErr: "REFUSED_STREAM",
+		},
+		{
+			name:        "goaway_before_stream",
+			frame:       Frame{Type: FrameGoAway, Payload: []byte{0, 0, 0, 0, 0, 0, 0, byte(ErrCodeEnhanceYourCalm)}},
+			expectedErr: "ENHANCE_YOUR_CALM",
+		},
+		{
+			name:        "push_promise",
+			frame:       Frame{Type: FramePushPromise, StreamID: 1, Flags: FlagEndHeaders, Payload: []byte{0, 0, 0, 2}},
+			expectedErr: "PROTOCOL_ERROR",
+		},
+		{
+			name:        "header_list_too_large",
+			frame:       Frame{Type: FrameHeaders, StreamID: 1, Flags: FlagEndHeaders | FlagEndStream, Payload: largeHeaderListBlock()},
+			expectedErr: "header list too large",
+		},
+		{
+			// :status 200, then a table size update
+			name:        "table_size_update_after_field",
+			frame:       Frame{Type: FrameHeaders, StreamID: 1, Flags: FlagEndHeaders | FlagEndStream, Payload: []byte{0x88, 0x20}},
+			expectedErr: "COMPRESSION_ERROR",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// A loopback TCP conn is used instead of net.Pipe
+			// since both sides write before reading.
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+
+			go func() {
+				serverConn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer serverConn.Close()
+				serveFrames(t, serverConn, Frame{Type: FrameSettings}, test.frame)
+			}()
+
+			clientConn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer clientConn.Close()
+
+			cc := NewClientConn(clientConn, false)
+			if err := cc.Handshake(); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = cc.RoundTrip(requestFields("GET", "/"), nil)
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Fatalf("expected error containing %s\tgot: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package http2
+
+// Protocol ID of HTTP/2 over TLS negotiated
+// with ALPN in the TLS handshake.
+const ALPNProtocol = "h2"
+
+// Every HTTP/2 connection starts with this
+// preface sent by the client, followed by
+// a SETTINGS frame.
+const clientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// Every frame starts with 9 bytes:
+// Length (24 bits), Type (8), Flags (8),
+// R (1 bit) + Stream Identifier (31 bits)
+const frameHeaderLen = 9
+
+const (
+	FrameData uint8 = iota
+	FrameHeaders
+	FramePriority
+	FrameRSTStream
+	FrameSettings
+	FramePushPromise
+	FramePing
+	FrameGoAway
+	FrameWindowUpdate
+	FrameContinuation
+)
+
+var frameNames = map[uint8]string{
+	FrameData:         "DATA",
+	FrameHeaders:      "HEADERS",
+	FramePriority:     "PRIORITY",
+	FrameRSTStream:    "RST_STREAM",
+	FrameSettings:     "SETTINGS",
+	FramePushPromise:  "PUSH_PROMISE",
+	FramePing:         "PING",
+	FrameGoAway:       "GOAWAY",
+	FrameWindowUpdate: "WINDOW_UPDATE",
+	FrameContinuation: "CONTINUATION",
+}
+
+// Some flags share the same bit but belong
+// to different frame types (END_STREAM for
+// DATA/HEADERS and ACK for SETTINGS/PING)
+const (
+	FlagEndStream  uint8 = 0x1
+	FlagAck        uint8 = 0x1
+	FlagEndHeaders uint8 = 0x4
+	FlagPadded     uint8 = 0x8
+	FlagPriority   uint8 = 0x20
+)
+
+const (
+	SettingHeaderTableSize uint16 = iota + 1
+	SettingEnablePush
+	SettingMaxConcurrentStreams
+	SettingInitialWindowSize
+	SettingMaxFrameSize
+	SettingMaxHeaderListSize
+)
+
+var settingNames = map[uint16]string{
+	SettingHeaderTableSize:      "HEADER_TABLE_SIZE",
+	SettingEnablePush:           "ENABLE_PUSH",
+	SettingMaxConcurrentStreams: "MAX_CONCURRENT_STREAMS",
+	SettingInitialWindowSize:    "INITIAL_WINDOW_SIZE",
+	SettingMaxFrameSize:         "MAX_FRAME_SIZE",
+	SettingMaxHeaderListSize:    "MAX_HEADER_LIST_SIZE",
+}
+
+const (
+	ErrCodeNo uint32 = iota
+	ErrCodeProtocol
+	ErrCodeInternal
+	ErrCodeFlowControl
+	ErrCodeSettingsTimeout
+	ErrCodeStreamClosed
+	ErrCodeFrameSize
+	ErrCodeRefusedStream
+	ErrCodeCancel
+	ErrCodeCompression
+	ErrCodeConnect
+	ErrCodeEnhanceYourCalm
+	ErrCodeInadequateSecurity
+	ErrCodeHTTP11Required
+)
+
+var errCodeNames = map[uint32]string{
+	ErrCodeNo:                 "NO_ERROR",
+	ErrCodeProtocol:           "PROTOCOL_ERROR",
+	ErrCodeInternal:           "INTERNAL_ERROR",
+	ErrCodeFlowControl:        "FLOW_CONTROL_ERROR",
+	ErrCodeSettingsTimeout:    "SETTINGS_TIMEOUT",
+	ErrCodeStreamClosed:       "STREAM_CLOSED",
+	ErrCodeFrameSize:          "FRAME_SIZE_ERROR",
+	ErrCodeRefusedStream:      "REFUSED_STREAM",
+	ErrCodeCancel:             "CANCEL",
+	ErrCodeCompression:        "COMPRESSION_ERROR",
+	ErrCodeConnect:            "CONNECT_ERROR",
+	ErrCodeEnhanceYourCalm:    "ENHANCE_YOUR_CALM",
+	ErrCodeInadequateSecurity: "INADEQUATE_SECURITY",
+	ErrCodeHTTP11Required:     "HTTP_1_1_REQUIRED",
+}
+
+const (
+	// Initial values defined by RFC 9113 before
+	// any SETTINGS frame is received.
+	defaultInitialWindowSize = 65535
+	defaultMaxFrameSize      = 16384
+	maxAllowedFrameSize      = 1<<24 - 1
+	maxWindowSize            = 1<<31 - 1
+
+	// What we advertise to the server. A bigger
+	// window avoids stalling large downloads.
+	clientInitialWindowSize = 1 << 20
+	clientMaxFrameSize      = defaultMaxFrameSize
+
+	// Bigger header lists (e.g. from a misbehaving
+	// server) fail instead of using unbounded memory.
+	clientMaxHeaderListSize = 1 << 20
+)
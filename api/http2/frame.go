@@ -0,0 +1,312 @@
+package http2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+)
+
+type Frame struct {
+	Type     uint8
+	Flags    uint8
+	StreamID uint32
+	Payload  []byte
+}
+
+func (f Frame) HasFlag(flag uint8) bool {
+	return f.Flags&flag != 0
+}
+
+func (f Frame) flagNames() string {
+	names := make([]string, 0, 3)
+
+	switch f.Type {
+	case FrameSettings, FramePing:
+		if f.HasFlag(FlagAck) {
+			names = append(names, "ACK")
+		}
+	case FrameData, FrameHeaders:
+		if f.HasFlag(FlagEndStream) {
+			names = append(names, "END_STREAM")
+		}
+	}
+
+	if (f.Type == FrameHeaders || f.Type == FrameContinuation || f.Type == FramePushPromise) && f.HasFlag(FlagEndHeaders) {
+		names = append(names, "END_HEADERS")
+	}
+	if (f.Type == FrameData || f.Type == FrameHeaders || f.Type == FramePushPromise) && f.HasFlag(FlagPadded) {
+		names = append(names, "PADDED")
+	}
+	if f.Type == FrameHeaders && f.HasFlag(FlagPriority) {
+		names = append(names, "PRIORITY")
+	}
+
+	return strings.Join(names, "|")
+}
+
+// Human readable summary of the frame used
+// in the verbose frame log.
+func (f Frame) String() string {
+	name, ok := frameNames[f.Type]
+	if !ok {
+		name = fmt.Sprintf("UNKNOWN(0x%x)", f.Type)
+	}
+
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "%s stream=%d len=%d", name, f.StreamID, len(f.Payload))
+
+	if flags := f.flagNames(); flags != "" {
+		fmt.Fprintf(&sb, " flags=%s", flags)
+	}
+
+	switch f.Type {
+	case FrameSettings:
+		settings, err := parseSettings(f.Payload)
+		if err == nil {
+			for _, s := range settings {
+				fmt.Fprintf(&sb, " %s=%d", settingName(s.ID), s.Value)
+			}
+		}
+
+	case FrameWindowUpdate:
+		if len(f.Payload) == 4 {
+			fmt.Fprintf(&sb, " increment=%d", binary.BigEndian.Uint32(f.Payload)&maxWindowSize)
+		}
+
+	case FrameRSTStream:
+		if len(f.Payload) == 4 {
+			fmt.Fprintf(&sb, " error=%s", ErrCodeName(binary.BigEndian.Uint32(f.Payload)))
+		}
+
+	case FrameGoAway:
+		if len(f.Payload) >= 8 {
+			fmt.Fprintf(
+				&sb,
+				" last_stream=%d error=%s",
+				binary.BigEndian.Uint32(f.Payload[:4])&maxWindowSize,
+				ErrCodeName(binary.BigEndian.Uint32(f.Payload[4:8])),
+			)
+			if len(f.Payload) > 8 {
+				fmt.Fprintf(&sb, " debug=%q", f.Payload[8:])
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func ErrCodeName(code uint32) string {
+	if name, ok := errCodeNames[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(0x%x)", code)
+}
+
+func settingName(id uint16) string {
+	if name, ok := settingNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("UNKNOWN(0x%x)", id)
+}
+
+type Setting struct {
+	ID    uint16
+	Value uint32
+}
+
+// Each setting is 6 bytes: ID (16 bits) and Value (32 bits)
+func parseSettings(payload []byte) ([]Setting, error) {
+	if len(payload)%6 != 0 {
+		return nil, fmt.Errorf("settings payload length %d is not a multiple of 6", len(payload))
+	}
+
+	settings := make([]Setting, 0, len(payload)/6)
+	for i := 0; i < len(payload); i += 6 {
+		settings = append(settings, Setting{
+			ID:    binary.BigEndian.Uint16(payload[i : i+2]),
+			Value: binary.BigEndian.Uint32(payload[i+2 : i+6]),
+		})
+	}
+
+	return settings, nil
+}
+
+/*
+Reads and writes HTTP/2 frames on the connection.
+If verbose is set, every frame is printed with its
+direction so the exchange can be followed.
+*/
+type Framer struct {
+	verbose      bool
+	maxReadSize  uint32
+	rw           io.ReadWriter
+	headerBuffer [frameHeaderLen]byte
+}
+
+func NewFramer(rw io.ReadWriter, verbose bool) *Framer {
+	return &Framer{
+		rw:          rw,
+		verbose:     verbose,
+		maxReadSize: clientMaxFrameSize,
+	}
+}
+
+func (fr *Framer) ReadFrame() (Frame, error) {
+	if _, err := io.ReadFull(fr.rw, fr.headerBuffer[:]); err != nil {
+		return Frame{}, err
+	}
+
+	header := fr.headerBuffer
+	length := uint32(header[0])<<16 | uint32(header[1])<<8 | uint32(header[2])
+	if length > fr.maxReadSize {
+		return Frame{}, ConnectionError{Code: ErrCodeFrameSize, Reason: fmt.Sprintf("frame of %d bytes exceeds max frame size", length)}
+	}
+
+	f := Frame{
+		Type:     header[3],
+		Flags:    header[4],
+		StreamID: binary.BigEndian.Uint32(header[5:9]) & maxWindowSize,
+		Payload:  make([]byte, length),
+	}
+
+	if _, err := io.ReadFull(fr.rw, f.Payload); err != nil {
+		return Frame{}, err
+	}
+
+	if fr.verbose {
+		terminalutils.PrintHTTP2Frame(false, f.String())
+	}
+
+	return f, nil
+}
+
+func (fr *Framer) WriteFrame(f Frame) error {
+	buf := make([]byte, frameHeaderLen, frameHeaderLen+len(f.Payload))
+
+	length := len(f.Payload)
+	buf[0] = byte(length >> 16)
+	buf[1] = byte(length >> 8)
+	buf[2] = byte(length)
+	buf[3] = f.Type
+	buf[4] = f.Flags
+	binary.BigEndian.PutUint32(buf[5:9], f.StreamID&maxWindowSize)
+	buf = append(buf, f.Payload...)
+
+	if fr.verbose {
+		terminalutils.PrintHTTP2Frame(true, f.String())
+	}
+
+	_, err := fr.rw.Write(buf)
+	return err
+}
+
+func encodeSettings(settings []Setting) []byte {
+	payload := make([]byte, 0, len(settings)*6)
+	for _, s := range settings {
+		payload = binary.BigEndian.AppendUint16(payload, s.ID)
+		payload = binary.BigEndian.AppendUint32(payload, s.Value)
+	}
+
+	return payload
+}
+
+func (fr *Framer) WriteSettings(settings ...Setting) error {
+	return fr.WriteFrame(Frame{Type: FrameSettings, Payload: encodeSettings(settings)})
+}
+
+func (fr *Framer) WriteSettingsAck() error {
+	return fr.WriteFrame(Frame{Type: FrameSettings, Flags: FlagAck})
+}
+
+func (fr *Framer) WritePingAck(data []byte) error {
+	return fr.WriteFrame(Frame{Type: FramePing, Flags: FlagAck, Payload: data})
+}
+
+func (fr *Framer) WriteWindowUpdate(streamID, increment uint32) error {
+	return fr.WriteFrame(Frame{
+		Type:     FrameWindowUpdate,
+		StreamID: streamID,
+		Payload:  binary.BigEndian.AppendUint32(nil, increment&maxWindowSize),
+	})
+}
+
+func (fr *Framer) WriteRSTStream(streamID, code uint32) error {
+	return fr.WriteFrame(Frame{
+		Type:     FrameRSTStream,
+		StreamID: streamID,
+		Payload:  binary.BigEndian.AppendUint32(nil, code),
+	})
+}
+
+func (fr *Framer) WriteGoAway(lastStreamID, code uint32) error {
+	payload := binary.BigEndian.AppendUint32(nil, lastStreamID&maxWindowSize)
+	payload = binary.BigEndian.AppendUint32(payload, code)
+
+	return fr.WriteFrame(Frame{Type: FrameGoAway, Payload: payload})
+}
+
+func (fr *Framer) WriteData(streamID uint32, endStream bool, data []byte) error {
+	var flags uint8
+	if endStream {
+		flags |= FlagEndStream
+	}
+
+	return fr.WriteFrame(Frame{Type: FrameData, Flags: flags, StreamID: streamID, Payload: data})
+}
+
+// A header block bigger than the max frame size
+// is split into HEADERS followed by CONTINUATION
+// frames. Only the last one has END_HEADERS.
+func (fr *Framer) WriteHeaders(streamID uint32, endStream bool, block []byte, maxFrameSize uint32) error {
+	frameType := FrameHeaders
+	var flags uint8
+	if endStream {
+		flags |= FlagEndStream
+	}
+
+	for {
+		chunk := block
+		if uint32(len(chunk)) > maxFrameSize {
+			chunk = block[:maxFrameSize]
+		}
+		block = block[len(chunk):]
+
+		if len(block) == 0 {
+			flags |= FlagEndHeaders
+		}
+
+		if err := fr.WriteFrame(Frame{Type: frameType, Flags: flags, StreamID: streamID, Payload: chunk}); err != nil {
+			return err
+		}
+
+		if len(block) == 0 {
+			return nil
+		}
+
+		frameType = FrameContinuation
+		flags = 0
+	}
+}
+
+// DATA, HEADERS and PUSH_PROMISE frames can be padded.
+// The first byte is the pad length and the padding
+// is at the end of the payload.
+func stripPadding(f Frame) ([]byte, error) {
+	if !f.HasFlag(FlagPadded) {
+		return f.Payload, nil
+	}
+
+	if len(f.Payload) == 0 {
+		return nil, ConnectionError{Code: ErrCodeProtocol, Reason: "padded frame without pad length"}
+	}
+
+	padLen := int(f.Payload[0])
+	if padLen >= len(f.Payload) {
+		return nil, ConnectionError{Code: ErrCodeProtocol, Reason: "padding exceeds frame payload"}
+	}
+
+	return f.Payload[1 : len(f.Payload)-padLen], nil
+}
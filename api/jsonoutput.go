@@ -0,0 +1,174 @@
+package api
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/saeidalz13/gurl"
+)
+
+const outputJSON = "json"
+
+type jsonHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type jsonRequest struct {
+	Proto   string       `json:"proto"`
+	Line    string       `json:"line,omitempty"`
+	Headers []jsonHeader `json:"headers"`
+	Body    string       `json:"body,omitempty"`
+}
+
+type jsonRemote struct {
+	IP   string `json:"ip,omitempty"`
+	Port int    `json:"port"`
+}
+
+type jsonCertificate struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+type jsonTLS struct {
+	Version     string           `json:"version"`
+	CipherSuite string           `json:"cipher_suite"`
+	ALPN        string           `json:"alpn,omitempty"`
+	ServerName  string           `json:"server_name"`
+	Resumed     bool             `json:"resumed"`
+	Certificate *jsonCertificate `json:"certificate,omitempty"`
+}
+
+// Body is base64 if it's not valid UTF-8
+// (e.g. images), so the JSON stays valid. It's
+// empty when saved to a file (-o/-O), but
+// BodySize still has the bytes received.
+type jsonResponse struct {
+	Proto        string       `json:"proto"`
+	StatusCode   string       `json:"status_code"`
+	Status       string       `json:"status,omitempty"`
+	Headers      []jsonHeader `json:"headers"`
+	Body         string       `json:"body"`
+	BodyEncoding string       `json:"body_encoding"`
+	BodySize     int64        `json:"body_size"`
+}
+
+// Milliseconds since the start of the connection
+type jsonTiming struct {
+	DNSLookup    float64 `json:"dns_lookup_ms"`
+	Connect      float64 `json:"connect_ms"`
+	TLSHandshake float64 `json:"tls_handshake_ms"`
+	RequestSent  float64 `json:"request_sent_ms"`
+	FirstByte    float64 `json:"first_byte_ms"`
+	Done         float64 `json:"done_ms"`
+	Total        float64 `json:"total_ms"`
+}
+
+type jsonExchange struct {
+	URL       string       `json:"url"`
+	Redirects int          `json:"redirects"`
+	Remote    jsonRemote   `json:"remote"`
+	TLS       *jsonTLS     `json:"tls"`
+	Request   jsonRequest  `json:"request"`
+	Response  jsonResponse `json:"response"`
+	Timing    jsonTiming   `json:"timing"`
+}
+
+func newJSONHeaders(lines []string) []jsonHeader {
+	headers := make([]jsonHeader, 0, len(lines))
+	for _, line := range lines {
+		// Pseudo headers of HTTP/2 start with ':'
+		var prefix string
+		if strings.HasPrefix(line, ":") {
+			prefix, line = ":", line[1:]
+		}
+
+		name, value, _ := strings.Cut(line, ":")
+		headers = append(headers, jsonHeader{Name: prefix + strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+	return headers
+}
+
+func newJSONTLS(state *tls.ConnectionState) *jsonTLS {
+	if state == nil {
+		return nil
+	}
+
+	jt := &jsonTLS{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		ServerName:  state.ServerName,
+		Resumed:     state.DidResume,
+	}
+
+	// The first one is of the server itself
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		jt.Certificate = &jsonCertificate{
+			Subject:  cert.Subject.String(),
+			Issuer:   cert.Issuer.String(),
+			NotAfter: cert.NotAfter,
+		}
+	}
+
+	return jt
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func newJSONExchange(resp *gurl.Response) jsonExchange {
+	body, bodyEncoding := resp.Body, "text"
+	if !utf8.ValidString(body) {
+		body, bodyEncoding = base64.StdEncoding.EncodeToString([]byte(body)), "base64"
+	}
+
+	return jsonExchange{
+		URL:       resp.URL,
+		Redirects: resp.Redirects,
+		Remote:    jsonRemote{IP: resp.RemoteIP, Port: resp.RemotePort},
+		TLS:       newJSONTLS(resp.TLS),
+		Request: jsonRequest{
+			Proto:   resp.Request.Proto,
+			Line:    resp.Request.Line,
+			Headers: newJSONHeaders(resp.Request.Header),
+			Body:    resp.Request.Body,
+		},
+		Response: jsonResponse{
+			Proto:        resp.Proto,
+			StatusCode:   resp.StatusCode,
+			Status:       resp.Status,
+			Headers:      newJSONHeaders(resp.Header),
+			Body:         body,
+			BodyEncoding: bodyEncoding,
+			BodySize:     resp.BodySize,
+		},
+		Timing: jsonTiming{
+			DNSLookup:    millis(resp.Timing.DNSLookup),
+			Connect:      millis(resp.Timing.Connect),
+			TLSHandshake: millis(resp.Timing.TLSHandshake),
+			RequestSent:  millis(resp.Timing.RequestSent),
+			FirstByte:    millis(resp.Timing.FirstByte),
+			Done:         millis(resp.Timing.Done),
+			Total:        millis(resp.Timing.Total),
+		},
+	}
+}
+
+// The whole exchange as a single JSON document
+// on stdout, for scripts (e.g. piped to jq).
+func printJSON(resp *gurl.Response) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newJSONExchange(resp))
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+
+	"github.com/saeidalz13/gurl"
+)
+
+func TestNewJSONExchange(t *testing.T) {
+	tests := []struct {
+		name                 string
+		body                 string
+		expectedBody         string
+		expectedBodyEncoding string
+	}{
+		{name: "text", body: `{"ok":true}`, expectedBody: `{"ok":true}`, expectedBodyEncoding: "text"},
+		{name: "binary", body: "\xff\xd8\xff", expectedBody: "/9j/", expectedBodyEncoding: "base64"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exchange := newJSONExchange(&gurl.Response{Body: test.body, BodySize: int64(len(test.body))})
+
+			if exchange.Response.Body != test.expectedBody || exchange.Response.BodyEncoding != test.expectedBodyEncoding {
+				t.Fatalf("expected: %s (%s)\tgot: %s (%s)", test.expectedBody, test.expectedBodyEncoding, exchange.Response.Body, exchange.Response.BodyEncoding)
+			}
+			if exchange.Response.BodySize != int64(len(test.body)) {
+				t.Fatalf("expected: %d\tgot: %d", len(test.body), exchange.Response.BodySize)
+			}
+		})
+	}
+}
+
+func TestNewJSONHeaders(t *testing.T) {
+	headers := newJSONHeaders([]string{"Content-Type: text/plain", "X-Time: 12:30", ":path: /"})
+	expected := []jsonHeader{
+		{Name: "Content-Type", Value: "text/plain"},
+		{Name: "X-Time", Value: "12:30"},
+		{Name: ":path", Value: "/"},
+	}
+
+	if !reflect.DeepEqual(headers, expected) {
+		t.Fatalf("expected: %v\tgot: %v", expected, headers)
+	}
+}
+
+func TestNewJSONTLS(t *testing.T) {
+	if jt := newJSONTLS(nil); jt != nil {
+		t.Fatalf("expected: nil\tgot: %v", jt)
+	}
+
+	jt := newJSONTLS(&tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "h2",
+		ServerName:         "example.com",
+		DidResume:          true,
+	})
+
+	expected := &jsonTLS{Version: "TLS 1.3", CipherSuite: "TLS_AES_128_GCM_SHA256", ALPN: "h2", ServerName: "example.com", Resumed: true}
+	if !reflect.DeepEqual(jt, expected) {
+		t.Fatalf("expected: %+v\tgot: %+v", expected, jt)
+	}
+}
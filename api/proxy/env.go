@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Lowercase variables are checked first, the
+// same as cURL and most other tools.
+func lookupEnv(getenv func(string) string, name string) string {
+	if value := getenv(strings.ToLower(name)); value != "" {
+		return value
+	}
+	return getenv(name)
+}
+
+/*
+NO_PROXY is a comma separated list of hosts that are
+connected directly:
+
+	NO_PROXY=localhost,127.0.0.1,.internal.com,example.com:8080
+
+"*" disables the proxy for all hosts. A domain also
+matches its subdomains (with or without leading dot)
+and an entry with port only matches that port.
+*/
+func bypassProxy(noProxy, host string, port int) bool {
+	host = strings.ToLower(host)
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+
+		if entryHost, entryPort, err := net.SplitHostPort(entry); err == nil {
+			if entryPort != strconv.Itoa(port) {
+				continue
+			}
+			entry = entryHost
+		}
+
+		entry = strings.TrimPrefix(entry, ".")
+		if host == entry || strings.HasSuffix(host, "."+entry) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fromEnvironment(getenv func(string) string, host string, port int, isSecure bool) (*Proxy, error) {
+	if bypassProxy(lookupEnv(getenv, "NO_PROXY"), host, port) {
+		return nil, nil
+	}
+
+	name := "HTTP_PROXY"
+	if isSecure {
+		name = "HTTPS_PROXY"
+	}
+
+	rawURL := lookupEnv(getenv, name)
+	if rawURL == "" {
+		return nil, nil
+	}
+
+	p, err := ParseProxyURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Proxy from HTTPS_PROXY (for TLS targets) or
+// HTTP_PROXY, unless NO_PROXY matches the host.
+// Nil means a direct connection.
+func FromEnvironment(host string, port int, isSecure bool) (*Proxy, error) {
+	return fromEnvironment(os.Getenv, host, port, isSecure)
+}
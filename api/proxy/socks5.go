@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+const (
+	socks5Version = 0x05
+
+	socks5MethodNoAuth       = 0x00
+	socks5MethodUserPassword = 0x02
+	socks5MethodNoAcceptable = 0xff
+
+	// RFC 1929
+	socks5UserPasswordVersion = 0x01
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+)
+
+var socks5ReplyMessages = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+/*
+SOCKS5 (RFC 1928) handshake on an open connection
+to the proxy:
+
+ 1. Client offers auth methods, proxy picks one
+ 2. Username/password auth if picked (RFC 1929)
+ 3. CONNECT request with the target address
+ 4. Proxy replies with the result and bound address
+
+The target is sent as a domain name, so the proxy
+does the DNS resolution (remote DNS).
+*/
+func (p Proxy) socks5Connect(conn net.Conn, targetAddr string) error {
+	host, portStr, err := net.SplitHostPort(targetAddr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("invalid target port: %s", portStr)
+	}
+
+	methods := []byte{socks5MethodNoAuth}
+	if p.User != "" {
+		methods = append(methods, socks5MethodUserPassword)
+	}
+
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("socks5 greeting: %w", err)
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5 greeting: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected version %d", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5MethodNoAuth:
+	case socks5MethodUserPassword:
+		if err := p.socks5Authenticate(conn); err != nil {
+			return err
+		}
+	case socks5MethodNoAcceptable:
+		return errors.New("socks5: proxy accepted none of the auth methods")
+	default:
+		return fmt.Errorf("socks5: unsupported auth method %d", reply[1])
+	}
+
+	request := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(append(request, socks5AddrIPv4), ip4...)
+		} else {
+			request = append(append(request, socks5AddrIPv6), ip...)
+		}
+	} else {
+		if len(host) > 255 {
+			return errors.New("socks5: domain name too long")
+		}
+		request = append(append(request, socks5AddrDomain, byte(len(host))), host...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+
+	// VER, REP, RSV, ATYP
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+
+	if header[1] != 0x00 {
+		msg, ok := socks5ReplyMessages[header[1]]
+		if !ok {
+			msg = fmt.Sprintf("unknown error %d", header[1])
+		}
+		return fmt.Errorf("socks5 connect to %s failed: %s", targetAddr, msg)
+	}
+
+	// Bound address is not needed but must be
+	// consumed before the tunnel is used.
+	var addrLen int
+	switch header[3] {
+	case socks5AddrIPv4:
+		addrLen = net.IPv4len
+	case socks5AddrIPv6:
+		addrLen = net.IPv6len
+	case socks5AddrDomain:
+		lenByte := make([]byte, 1)
+		if _, err := io.ReadFull(conn, lenByte); err != nil {
+			return fmt.Errorf("socks5 connect: %w", err)
+		}
+		addrLen = int(lenByte[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type %d", header[3])
+	}
+
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return fmt.Errorf("socks5 connect: %w", err)
+	}
+
+	return nil
+}
+
+func (p Proxy) socks5Authenticate(conn net.Conn) error {
+	if len(p.User) > 255 || len(p.Password) > 255 {
+		return errors.New("socks5: username or password too long")
+	}
+
+	request := []byte{socks5UserPasswordVersion, byte(len(p.User))}
+	request = append(request, p.User...)
+	request = append(request, byte(len(p.Password)))
+	request = append(request, p.Password...)
+
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("socks5 auth: %w", err)
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("socks5 auth: %w", err)
+	}
+
+	if reply[1] != 0x00 {
+		return errors.New("socks5: authentication failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/saeidalz13/gurl/api/http2"
+	"github.com/saeidalz13/gurl/internal/hpack"
+	"github.com/saeidalz13/gurl/models"
+)
+
+const testH2CPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// Writes the server SETTINGS and a complete
+// response on the given stream.
+func writeTestH2Response(t *testing.T, fr *http2.Framer, streamID uint32, body string) {
+	t.Helper()
+
+	block := hpack.NewEncoder().Encode([]hpack.HeaderField{
+		{Name: ":status", Value: "200"},
+		{Name: "content-type", Value: "text/plain"},
+	})
+
+	frames := []http2.Frame{
+		{Type: http2.FrameSettings},
+		{Type: http2.FrameHeaders, Flags: http2.FlagEndHeaders, StreamID: streamID, Payload: block},
+		{Type: http2.FrameData, Flags: http2.FlagEndStream, StreamID: streamID, Payload: []byte(body)},
+	}
+
+	for _, f := range frames {
+		if err := fr.WriteFrame(f); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+}
+
+func readTestPreface(t *testing.T, r io.Reader) {
+	t.Helper()
+
+	preface := make([]byte, len(testH2CPreface))
+	if _, err := io.ReadFull(r, preface); err != nil {
+		t.Error(err)
+		return
+	}
+	if string(preface) != testH2CPreface {
+		t.Errorf("unexpected client preface: %q", preface)
+	}
+}
+
+// Accepts a single connection and lets handle
+// play the server side of it.
+func startTestH2CServer(t *testing.T, handle func(conn net.Conn)) *net.TCPAddr {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+
+	return ln.Addr().(*net.TCPAddr)
+}
+
+func connectTestServer(t *testing.T, addr *net.TCPAddr) TCPConnManager {
+	t.Helper()
+
+	tcm := NewTCPConnManager(models.ConnInfo{IP: addr.IP, Port: addr.Port}, addr.String(), nil, nil)
+	if err := tcm.InitTCPConn(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tcm.conn.Close() })
+
+	return tcm
+}
+
+func TestDispatchHTTP2UpgradeRequest(t *testing.T) {
+	addr := startTestH2CServer(t, func(conn net.Conn) {
+		br := bufio.NewReader(conn)
+		header, err := readHTTP1Header(br)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if !bytes.Contains(header, []byte("Upgrade: h2c\r\n")) || !bytes.Contains(header, []byte("HTTP2-Settings: ")) {
+			t.Errorf("upgrade headers missing in request:\n%s", header)
+			return
+		}
+
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"))
+
+		// The upgraded request is stream 1
+		writeTestH2Response(t, http2.NewFramer(conn, false), 1, "upgraded")
+		readTestPreface(t, br)
+		io.Copy(io.Discard, br)
+	})
+
+	tcm := connectTestServer(t, addr)
+	request := "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: " +
+		http2.UpgradeSettingsHeaderValue() + "\r\n\r\n"
+
+	resp, _, upgraded, err := tcm.DispatchHTTP2UpgradeRequest(request, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !upgraded {
+		t.Fatal("expected connection to be upgraded")
+	}
+
+	if resp.StatusCode != "200" || string(resp.Body) != "upgraded" {
+		t.Fatalf("unexpected response: %s %q", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestDispatchHTTP2UpgradeRequestIgnored(t *testing.T) {
+	addr := startTestH2CServer(t, func(conn net.Conn) {
+		if _, err := readHTTP1Header(bufio.NewReader(conn)); err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"))
+	})
+
+	tcm := connectTestServer(t, addr)
+
+	_, respBytes, upgraded, err := tcm.DispatchHTTP2UpgradeRequest("GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: h2c\r\n\r\n", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if upgraded {
+		t.Fatal("expected no upgrade")
+	}
+
+	if !strings.HasSuffix(string(respBytes), "\r\n\r\nhello") {
+		t.Fatalf("unexpected HTTP/1.1 response: %q", respBytes)
+	}
+}
+
+func TestDispatchHTTP2RequestPriorKnowledge(t *testing.T) {
+	addr := startTestH2CServer(t, func(conn net.Conn) {
+		readTestPreface(t, conn)
+
+		fr := http2.NewFramer(conn, false)
+		for {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if f.Type != http2.FrameHeaders {
+				continue
+			}
+
+			fields, err := hpack.NewDecoder(hpack.DefaultDynamicTableSize).Decode(f.Payload)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if fields[1].Name != ":scheme" || fields[1].Value != "http" {
+				t.Errorf("expected :scheme http\tgot: %v", fields[1])
+			}
+
+			writeTestH2Response(t, fr, f.StreamID, "prior knowledge")
+			io.Copy(io.Discard, conn)
+			return
+		}
+	})
+
+	tcm := connectTestServer(t, addr)
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: "localhost"},
+		{Name: ":path", Value: "/"},
+	}
+
+	resp, err := tcm.DispatchHTTP2Request(fields, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(resp.Body) != "prior knowledge" {
+		t.Fatalf("unexpected body: %q", resp.Body)
+	}
+}
@@ -1,352 +1,610 @@
 package tcp
 
 import (
+	"bufio"
 	"bytes"
-	"crypto/sha1"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	_ "embed"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"net"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/saeidalz13/gurl/api/dns"
-	"github.com/saeidalz13/gurl/internal/errutils"
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/api/http2"
+	"github.com/saeidalz13/gurl/api/proxy"
+	"github.com/saeidalz13/gurl/internal/hpack"
 	"github.com/saeidalz13/gurl/internal/terminalutils"
-	"github.com/saeidalz13/gurl/internal/wsutils"
 	"github.com/saeidalz13/gurl/models"
 )
 
+// How the body of an HTTP/1.1 response ends
 const (
-	headerCloseConn uint8 = iota
-	headerChunk
-	headerContentLength
+	bodyUntilClose uint8 = iota
+	bodyChunked
+	bodyContentLength
+	bodyNone
 )
 
 //go:embed cacert.pem
 var cacertsPEM []byte
 
 type TCPConnManager struct {
-	domain   string
-	connInfo models.ConnInfo
-	conn     net.Conn
+	domain        string
+	connInfo      models.ConnInfo
+	conn          net.Conn
+	tlsConfig     *tls.Config
+	alpnProtocols []string
+	proxy         *proxy.Proxy
+	proxyTunnel   bool
+	timeouts      Timeouts
+	trace         *Trace
+	bodySink      BodySink
+
+	// Stops closing the conn when the context
+	// of InitTCPConn is cancelled.
+	stopCancel func() bool
 }
 
-func NewTCPConnManager(connInfo models.ConnInfo, domain string) TCPConnManager {
+// tlsConfig can be nil. It's copied for each connection
+// with the server name and ALPN protocols set, and the
+// bundled CA certificates if it has no RootCAs. Without
+// ClientSessionCache, TLS session resumption is disabled.
+//
+// alpnProtocols are offered in the TLS handshake
+// in order of preference (e.g. "h2", "http/1.1").
+func NewTCPConnManager(connInfo models.ConnInfo, domain string, tlsConfig *tls.Config, alpnProtocols []string) TCPConnManager {
 	return TCPConnManager{
-		connInfo: connInfo,
-		domain:   domain,
+		connInfo:      connInfo,
+		domain:        domain,
+		tlsConfig:     tlsConfig,
+		alpnProtocols: alpnProtocols,
 	}
 }
 
-func (tcm TCPConnManager) setDeadlineToConn() {
-	tcm.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
-	tcm.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+func (tcm *TCPConnManager) SetTimeouts(timeouts Timeouts) {
+	tcm.timeouts = timeouts
 }
 
-// For the requests that are not made with
-// TLS handshake.
-func (tcm *TCPConnManager) InitTCPConn() error {
-	if tcm.connInfo.IsTls {
-		addr := fmt.Sprintf("%s:%d", tcm.connInfo.IP.String(), tcm.connInfo.Port)
-		if tcm.connInfo.IPType == dns.IpTypeV6 {
-			addr = fmt.Sprintf("[%s]:%d", tcm.connInfo.IP.String(), tcm.connInfo.Port)
+/*
+Decides where the body of a response goes once its
+status code and headers ("Name: value") are known.
+A nil writer keeps the body in the response.
+*/
+type BodySink func(statusCode string, headers []string) (io.Writer, error)
+
+// Streams response bodies (e.g. to a file)
+// instead of keeping them in memory.
+func (tcm *TCPConnManager) SetBodySink(sink BodySink) {
+	tcm.bodySink = sink
+}
+
+// Trace can be nil to not record the timing
+// of the connection.
+func (tcm *TCPConnManager) SetTrace(trace *Trace) {
+	tcm.trace = trace
+}
+
+func (tcm TCPConnManager) Trace() *Trace {
+	return tcm.trace
+}
+
+// The conn used to send a request and read its
+// response, with the read and write timeouts.
+func (tcm TCPConnManager) timedConn() net.Conn {
+	return newTimedConn(tcm.conn, tcm.timeouts, tcm.trace)
+}
+
+// Proxy is nil for direct connections. Without
+// tunnel, an HTTP proxy receives the requests in
+// absolute-form instead of a CONNECT tunnel.
+func (tcm *TCPConnManager) SetProxy(p *proxy.Proxy, tunnel bool) {
+	tcm.proxy = p
+	tcm.proxyTunnel = tunnel
+}
+
+// Domain without the port
+func (tcm TCPConnManager) host() string {
+	host, _, err := net.SplitHostPort(tcm.domain)
+	if err != nil {
+		return tcm.domain
+	}
+	return host
+}
+
+// Port of the domain (if any) is replaced by
+// the port of the connection.
+func (tcm TCPConnManager) targetAddr() string {
+	return net.JoinHostPort(tcm.host(), strconv.Itoa(tcm.connInfo.Port))
+}
+
+func (tcm TCPConnManager) dial(ctx context.Context) (net.Conn, error) {
+	timeout, isTotal := tcm.timeouts.limit(tcm.timeouts.Connect)
+
+	var conn net.Conn
+	var err error
+	if tcm.proxy != nil {
+		conn, err = tcm.proxy.Dial(ctx, tcm.targetAddr(), tcm.proxyTunnel, timeout)
+	} else {
+		addr := (&net.TCPAddr{IP: tcm.connInfo.IP, Port: tcm.connInfo.Port}).String()
+		dialer := net.Dialer{Timeout: timeout}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil && !isTimeout(err) {
+			err = apperrors.ConnectError{Addr: addr, Err: err}
 		}
+	}
+
+	return conn, tcm.timeouts.wrapTimeout(err, "connect", tcm.timeouts.Connect, isTotal)
+}
 
-		certPool := mustPrepareCertPool()
-		conn, err := tls.Dial(
-			"tcp",
-			addr,
-			&tls.Config{RootCAs: certPool, ServerName: tcm.domain},
-		)
+func (tcm TCPConnManager) prepareTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{}
+	if tcm.tlsConfig != nil {
+		config = tcm.tlsConfig.Clone()
+	}
+
+	if config.ServerName == "" {
+		config.ServerName = tcm.host()
+	}
+	config.NextProtos = tcm.alpnProtocols
+
+	if config.RootCAs == nil {
+		certPool, err := prepareCertPool()
 		if err != nil {
-			return err
+			return nil, err
 		}
-		tcm.conn = conn
-
-		return nil
+		config.RootCAs = certPool
 	}
 
-	conn, err := net.DialTCP("tcp", nil, &net.TCPAddr{IP: tcm.connInfo.IP, Port: tcm.connInfo.Port})
+	return config, nil
+}
+
+/*
+With TLS, the handshake is done on top of the TCP
+connection (which may be a tunnel through a proxy).
+
+Cancelling ctx closes the connection, which stops
+dialing, the handshake and any read or write on it
+until Close is called.
+*/
+func (tcm *TCPConnManager) InitTCPConn(ctx context.Context) error {
+	tcm.trace.restartIfUsed()
+
+	conn, err := tcm.dial(ctx)
 	if err != nil {
 		return err
 	}
+	tcm.trace.markConnect()
+
+	if tcm.connInfo.IsTls {
+		if conn, err = tcm.handshakeTLS(ctx, conn); err != nil {
+			return err
+		}
+		tcm.trace.markTLSHandshake()
+	}
+
 	tcm.conn = conn
+	tcm.stopCancel = context.AfterFunc(ctx, func() { conn.Close() })
+
 	return nil
 }
 
+func (tcm TCPConnManager) handshakeTLS(ctx context.Context, conn net.Conn) (net.Conn, error) {
+	config, err := tcm.prepareTLSConfig()
+	if err != nil {
+		conn.Close()
+		return nil, apperrors.TLSError{ServerName: tcm.host(), Err: err}
+	}
+
+	tlsConn := tls.Client(conn, config)
+	timeout, isTotal := tcm.timeouts.limit(tcm.timeouts.TLSHandshake)
+	conn.SetDeadline(deadlineFrom(timeout))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if isTimeout(err) {
+			return nil, tcm.timeouts.wrapTimeout(err, "TLS handshake", tcm.timeouts.TLSHandshake, isTotal)
+		}
+		return nil, apperrors.TLSError{ServerName: config.ServerName, Err: err}
+	}
+	conn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// Closing lets the same manager dial again with
+// InitTCPConn (e.g. to retry a request).
+func (tcm TCPConnManager) Close() error {
+	if tcm.stopCancel != nil {
+		tcm.stopCancel()
+	}
+
+	if tcm.conn == nil {
+		return nil
+	}
+	return tcm.conn.Close()
+}
+
+// Shows if the TLS handshake resumed a previous
+// session using a cached session ticket.
+func (tcm TCPConnManager) IsTLSSessionResumed() bool {
+	tlsConn, ok := tcm.conn.(*tls.Conn)
+	if !ok {
+		return false
+	}
+
+	return tlsConn.ConnectionState().DidResume
+}
+
+// Details of the TLS connection (version, cipher
+// suite, certificates). Nil if it's not TLS.
+func (tcm TCPConnManager) ConnectionState() *tls.ConnectionState {
+	tlsConn, ok := tcm.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// The application protocol the server selected
+// with ALPN. Empty if it's not TLS or the server
+// did not select any.
+func (tcm TCPConnManager) NegotiatedProtocol() string {
+	tlsConn, ok := tcm.conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+
+	return tlsConn.ConnectionState().NegotiatedProtocol
+}
+
 // Write the prepare http request to TCP connection
 // and returns the response bytes.
-func (tcm TCPConnManager) DispatchHTTPRequest(httpRequest string) []byte {
-	tcm.setDeadlineToConn()
+func (tcm TCPConnManager) DispatchHTTPRequest(httpRequest string) ([]byte, error) {
+	conn := tcm.timedConn()
+
+	if _, err := conn.Write([]byte(httpRequest)); err != nil {
+		return nil, err
+	}
 
-	_, err := tcm.conn.Write([]byte(httpRequest))
+	br := bufio.NewReader(conn)
+	header, err := readHTTP1Header(br)
 	if err != nil {
-		fmt.Printf("write tcp read: %v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
 
-	return tcm.readHTTPRespFromConn()
+	return tcm.readHTTP1Response(br, header)
 }
 
-// in HTTP 1.1 the default header setting of
-// connection is "keep-alive".
-//
-// It is the case that if the server wants to send
-// the response in different streams of tcp, it
-// indiciates either "Content-Length" or sets the
-// "Transfer-Encoding" to "chunked"
-//
-// If none of those options provided, that means the
-// entire data is sent in one single stream and we can
-// close the TCP conn after the first read.
-func (tcm TCPConnManager) readHTTPRespFromConn() []byte {
-	var response bytes.Buffer
-	var readContentLength int = -1
-	var contentLength int
-	var headerParam uint8
-
-	bufSize := 2 << 12 // 4kb
-	var readIteration int
-	headerIteration := 1
-
-tcpLoop:
-	for readContentLength < contentLength {
-		readIteration++
-		buf := make([]byte, bufSize)
-
-		n, err := tcm.conn.Read(buf)
+// Header and body of the response. Only the header
+// is returned if the body was written to the writer
+// of the sink.
+func (tcm TCPConnManager) readHTTP1Response(br *bufio.Reader, header []byte) ([]byte, error) {
+	if tcm.bodySink == nil {
+		body, err := readHTTP1Body(br, header)
 		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-
-			if strings.Contains(err.Error(), "i/o timeout") {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-
-			fmt.Printf("error read: %v\n", err)
-			os.Exit(1)
+			return nil, err
 		}
+		return append(header, body...), nil
+	}
 
-		response.Write(buf[:n])
+	statusCode, headers := splitHTTP1Header(header)
+	w, err := tcm.bodySink(statusCode, headers)
+	if err != nil {
+		return nil, err
+	}
 
-		if readIteration == headerIteration {
-			headerParam = identifyHeaderParam(buf[:n])
+	if w == nil {
+		body, err := readHTTP1Body(br, header)
+		if err != nil {
+			return nil, err
 		}
+		return append(header, body...), nil
+	}
 
-		switch headerParam {
-		case headerCloseConn:
-			return response.Bytes()
+	return header, copyHTTP1Body(w, br, header)
+}
 
-		case headerContentLength:
-			if readIteration == headerIteration {
-				cl, bodyIdx := extractContentLengthBodyStartingIdx(buf[:n])
-				contentLength = cl
-				readContentLength = n - bodyIdx
+// e.g. "HTTP/1.1 200 OK\r\nA: b\r\n\r\n" -> "200", ["A: b"]
+func splitHTTP1Header(header []byte) (string, []string) {
+	lines := strings.Split(strings.TrimSuffix(string(header), "\r\n\r\n"), "\r\n")
 
-				continue tcpLoop
-			} else {
-				readContentLength += n
-			}
+	var statusCode string
+	if statusLine := strings.SplitN(lines[0], " ", 3); len(statusLine) > 1 {
+		statusCode = statusLine[1]
+	}
 
-		case headerChunk:
-			// bytes of final \r\n + bytes of end of body \r\n + offset of len
-			// 2 + 2 + 1 = 5
-			// position of potential '0' = 5
-			if buf[n-5] == '0' {
-				return response.Bytes()
-			}
+	return statusCode, lines[1:]
+}
 
-			// unncessary `continue` but to show explicitely
-			// what needs to happen. If '0' was not found
-			// at the end of body, it means more data
-			// will be streamed from server. So tcpLoop
-			// shall live on!
-			continue tcpLoop
-		}
+/*
+Same as readHTTP1Body but the body is written to w.
+Chunked bodies are decoded on the way, so only the
+data of the chunks is written.
+*/
+func copyHTTP1Body(w io.Writer, br *bufio.Reader, header []byte) error {
+	framing, contentLength, err := bodyFraming(header)
+	if err != nil {
+		return err
 	}
 
-	return response.Bytes()
+	switch framing {
+	case bodyNone:
+		return nil
+	case bodyContentLength:
+		_, err = io.CopyN(w, br, contentLength)
+		return err
+	case bodyChunked:
+		return readChunks(br, w, nil)
+	default:
+		_, err = io.Copy(w, br)
+		return err
+	}
 }
 
-// Reads the content of websocket frame stream
-// on a separate goroutine to be able to both
-// read from and write to TCP conn concurrently.
-func (tcm TCPConnManager) ReadWebSocketData(secWsKey string, verbose bool) {
-	headerIteration := true
+/*
+Reads a chunked body up to the end of the trailers
+that follow the last chunk (size 0). The data of the
+chunks is written to w, and the body as it was sent
+(sizes, data and trailers) to raw if it's not nil.
+*/
+func readChunks(br *bufio.Reader, w, raw io.Writer) error {
+	if raw == nil {
+		raw = io.Discard
+	}
 
 	for {
-		buf := make([]byte, 2<<15)
-		n, err := tcm.conn.Read(buf)
+		sizeLine, err := br.ReadString('\n')
 		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-
-			if strings.Contains(err.Error(), "i/o timeout") {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-
-			fmt.Printf("error read: %v\n", err)
-			os.Exit(1)
+			return err
 		}
+		io.WriteString(raw, sizeLine)
 
-		if headerIteration {
-			respHeader := string(buf[:n])
-			// 101 is code for switching protocol showing
-			// that server is ready to be serving WS
-			if !strings.Contains(respHeader, "101") {
-				fmt.Println("Server did not accept WS req:")
-				fmt.Println(respHeader)
-				os.Exit(1)
-			}
-			headerIteration = false
-			if verbose {
-				fmt.Println(respHeader)
-			}
-
-			if !isServerVerified(buf[:n], secWsKey) {
-				fmt.Println("server key not verified")
-				break
-			}
+		// Chunk extensions come after ';'
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(sizeLine), ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeHex), 16, 64)
+		if err != nil || size < 0 {
+			return apperrors.ProtocolError{Protocol: "HTTP/1.1", Err: fmt.Errorf("invalid chunk size: %q", sizeLine)}
+		}
 
-		} else {
-			payload, err := wsutils.ParseWsFrame(buf[:n])
+		// Last chunk; the trailers end with an empty line
+		if size == 0 {
+			trailers, err := readHTTP1Header(br)
 			if err != nil {
-				fmt.Println(err)
-				continue
+				return err
 			}
-			terminalutils.PrintWsServerMsg(string(payload))
+			_, err = raw.Write(trailers)
+			return err
 		}
-	}
 
-	fmt.Println("Server closed connection")
-	os.Exit(1)
-}
+		if _, err := io.CopyN(io.MultiWriter(w, raw), br, size); err != nil {
+			return err
+		}
 
-// The initial msgByte is the request sent to the
-// server to initiate the WS connection.
-func (tcm TCPConnManager) WriteWebSocketData(msgByte []byte) {
-	for {
-		_, err := tcm.conn.Write(msgByte)
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
+		crlf := make([]byte, 2)
+		if _, err := io.ReadFull(br, crlf); err != nil {
+			return err
+		}
+		if string(crlf) != "\r\n" {
+			return apperrors.ProtocolError{Protocol: "HTTP/1.1", Err: fmt.Errorf("chunk of size %d is not followed by CRLF", size)}
 		}
+		raw.Write(crlf)
+	}
+}
 
-		input := terminalutils.GetWsInputFromStdin()
-		terminalutils.PrintWsClientMsg(string(input))
+// Sends the request as a single HTTP/2 stream. If
+// verbose, every frame exchanged is printed.
+func (tcm TCPConnManager) DispatchHTTP2Request(fields []hpack.HeaderField, body []byte, verbose bool) (http2.Response, error) {
+	cc := http2.NewClientConn(tcm.timedConn(), verbose)
+	cc.SetBodyWriter(tcm.http2BodyWriter())
+	if err := cc.Handshake(); err != nil {
+		return http2.Response{}, wrapHTTP2Error(err)
+	}
 
-		frame := wsutils.CreateWsFrame(input)
-		msgByte = frame
+	resp, err := cc.RoundTrip(fields, body)
+	if err != nil {
+		return http2.Response{}, wrapHTTP2Error(err)
 	}
+
+	cc.Close()
+	return resp, nil
 }
 
-// Identifies which parameter exists in the
-// http response header so we know if we should
-// close the connection right away or keep it
-// alive and handle the rest of streams of data.
-func identifyHeaderParam(bufContainingHeader []byte) uint8 {
-	if bytes.Contains(bufContainingHeader, []byte("Content-Length")) {
-		return headerContentLength
+// The sink gets the headers in the same format
+// as HTTP/1.1. Nil if there is no sink.
+func (tcm TCPConnManager) http2BodyWriter() http2.BodyWriterFunc {
+	if tcm.bodySink == nil {
+		return nil
 	}
 
-	if bytes.Contains(bufContainingHeader, []byte("chunked")) {
-		return headerChunk
+	return func(statusCode string, fields []hpack.HeaderField) (io.Writer, error) {
+		headers := make([]string, 0, len(fields))
+		for _, hf := range fields {
+			headers = append(headers, hf.Name+": "+hf.Value)
+		}
+		return tcm.bodySink(statusCode, headers)
 	}
+}
 
-	return headerCloseConn
+// Errors of the HTTP/2 protocol (GOAWAY or RST_STREAM)
+// become protocol errors. Others (e.g. timeouts) are
+// returned as they are.
+func wrapHTTP2Error(err error) error {
+	var connErr http2.ConnectionError
+	var streamErr http2.StreamError
+	if errors.As(err, &connErr) || errors.As(err, &streamErr) {
+		return apperrors.ProtocolError{Protocol: "HTTP/2", Err: err}
+	}
+	return err
 }
 
-// Preparing the certificaion info for
-// the TLS handshake on TCP. Some systems
-// don't automatically load certificates.
-//
-// It is included in the binary package.
-func mustPrepareCertPool() *x509.CertPool {
-	certPool, err := x509.SystemCertPool()
-	errutils.CheckErr(err)
+// Reads from the buffered reader (which may hold
+// bytes read past the HTTP/1.1 response header)
+// and writes directly to the connection.
+type bufferedConn struct {
+	*bufio.Reader
+	io.Writer
+}
 
-	if !certPool.AppendCertsFromPEM(cacertsPEM) {
-		fmt.Printf("failed to load the certificates")
-		os.Exit(1)
+/*
+Sends an HTTP/1.1 request carrying "Upgrade: h2c".
+If the server answers "101 Switching Protocols", the
+response of the request arrives as HTTP/2 on stream 1.
+
+Otherwise the server ignored the upgrade and the
+HTTP/1.1 response bytes are returned with false.
+*/
+func (tcm TCPConnManager) DispatchHTTP2UpgradeRequest(httpRequest string, verbose bool) (http2.Response, []byte, bool, error) {
+	conn := tcm.timedConn()
+
+	if _, err := conn.Write([]byte(httpRequest)); err != nil {
+		return http2.Response{}, nil, false, err
 	}
 
-	return certPool
-}
+	br := bufio.NewReader(conn)
+	header, err := readHTTP1Header(br)
+	if err != nil {
+		return http2.Response{}, nil, false, err
+	}
 
-func extractContentLengthBodyStartingIdx(httpResp []byte) (int, int) {
-	var bodyPos, shouldBreakNum, contentLength int
-	bytesLines := bytes.Split(httpResp, []byte("\r\n"))
-lineLoop:
-	for _, line := range bytesLines {
-		// + 2 is for \n and \r
-		bodyPos = bodyPos + len(line) + 2
-		if string(line) == "" {
-			shouldBreakNum++
+	if !bytes.HasPrefix(header, []byte("HTTP/1.1 101")) {
+		respBytes, err := tcm.readHTTP1Response(br, header)
+		if err != nil {
+			return http2.Response{}, nil, false, err
 		}
+		return http2.Response{}, respBytes, false, nil
+	}
 
-		if bytes.Contains(line, []byte("Content-Length")) {
-			contentLengthBytes := bytes.TrimSpace(bytes.Split(line, []byte(":"))[1])
+	if verbose {
+		terminalutils.PrintSwitchingProtocols(string(header))
+	}
 
-			num, err := strconv.ParseInt(string(contentLengthBytes), 10, 64)
-			if err != nil {
-				fmt.Println("invalid response from server")
-				os.Exit(1)
-			}
-			contentLength = int(num)
-			shouldBreakNum++
+	cc := http2.NewClientConn(bufferedConn{Reader: br, Writer: conn}, verbose)
+	cc.SetBodyWriter(tcm.http2BodyWriter())
+	resp, err := cc.ReadUpgradeResponse()
+	if err != nil {
+		return http2.Response{}, nil, true, wrapHTTP2Error(err)
+	}
+
+	cc.Close()
+	return resp, nil, true, nil
+}
+
+// Reads the status line and headers, including
+// the empty line that separates them from the body.
+func readHTTP1Header(br *bufio.Reader) ([]byte, error) {
+	var header bytes.Buffer
+
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			return nil, err
 		}
+		header.Write(line)
 
-		if shouldBreakNum == 2 {
-			break lineLoop
+		if bytes.Equal(line, []byte("\r\n")) {
+			return header.Bytes(), nil
 		}
 	}
+}
 
-	return contentLength, bodyPos
+// Body is delimited by Content-Length, chunked
+// encoding or the server closing the connection.
+// Chunked bodies are returned as they were sent.
+func readHTTP1Body(br *bufio.Reader, header []byte) ([]byte, error) {
+	framing, contentLength, err := bodyFraming(header)
+	if err != nil {
+		return nil, err
+	}
+
+	switch framing {
+	case bodyNone:
+		return nil, nil
+	case bodyContentLength:
+		body := make([]byte, contentLength)
+		_, err = io.ReadFull(br, body)
+		return body, err
+	case bodyChunked:
+		var body bytes.Buffer
+		err = readChunks(br, io.Discard, &body)
+		return body.Bytes(), err
+	default:
+		return io.ReadAll(br)
+	}
 }
 
-// When the WebSocket server sends the 101 Code, it
-// includes `Sec-Weboscket-Accept: VALUE`. `VALUE` is
-// the base64 encoded value of SHA-1 hash of the
-// client key + special GUID. This GUID is a unversal
-// constant.
-//
-// This function checks the `VALUE` seny by the server
-// with the base64 SHA-1 hash of client key. If they match
-// the response was sent from the requested server and not
-// and itermediary malicious middle man.
-func isServerVerified(respHeaser []byte, key string) bool {
-	specialGUID := "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
-	var secWsAccept []byte
-
-	for _, line := range bytes.Split(respHeaser, []byte("\r\n")) {
-		lineSegments := bytes.Split(line, []byte(":"))
-
-		if len(lineSegments) != 2 {
+/*
+How the body of the response ends (RFC 9112 6.3):
+
+  - 1xx, 204 and 304 responses have no body.
+  - Transfer-Encoding: chunked, which wins over
+    Content-Length if both are sent.
+  - Content-Length, which is returned too.
+  - Otherwise the server closes the connection
+    after the body.
+
+Header names are case-insensitive.
+*/
+func bodyFraming(header []byte) (uint8, int64, error) {
+	statusCode, headers := splitHTTP1Header(header)
+	if strings.HasPrefix(statusCode, "1") || statusCode == "204" || statusCode == "304" {
+		return bodyNone, 0, nil
+	}
+
+	contentLength := int64(-1)
+	for _, line := range headers {
+		name, value, found := strings.Cut(line, ":")
+		if !found {
 			continue
 		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
 
-		if bytes.Equal(bytes.ToLower(lineSegments[0]), []byte("sec-websocket-accept")) {
-			secWsAccept = bytes.TrimSpace(lineSegments[1])
-			break
+		switch {
+		case strings.EqualFold(name, "Transfer-Encoding"):
+			if strings.Contains(strings.ToLower(value), "chunked") {
+				return bodyChunked, 0, nil
+			}
+		case strings.EqualFold(name, "Content-Length"):
+			num, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || num < 0 {
+				return 0, 0, apperrors.ProtocolError{Protocol: "HTTP/1.1", Err: fmt.Errorf("invalid Content-Length: %s", value)}
+			}
+			contentLength = num
 		}
 	}
 
-	if secWsAccept == nil {
-		return false
+	if contentLength >= 0 {
+		return bodyContentLength, contentLength, nil
 	}
+	return bodyUntilClose, 0, nil
+}
 
-	h := sha1.New()
-	h.Write([]byte(key + specialGUID))
-	hashed := h.Sum(nil)
+// Preparing the certificaion info for
+// the TLS handshake on TCP. Some systems
+// don't automatically load certificates.
+//
+// It is included in the binary package.
+func prepareCertPool() (*x509.CertPool, error) {
+	certPool, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, err
+	}
+
+	if !certPool.AppendCertsFromPEM(cacertsPEM) {
+		return nil, errors.New("failed to load the certificates")
+	}
 
-	return base64.StdEncoding.EncodeToString(hashed) == string(secWsAccept)
+	return certPool, nil
 }
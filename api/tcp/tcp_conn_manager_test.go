@@ -0,0 +1,117 @@
+package tcp
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatchHTTPRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		// Written with a pause after each part
+		parts []string
+		// The server keeps the connection open after
+		// the response instead of closing it.
+		keepOpen bool
+		expected string
+	}{
+		{
+			name:     "until_close_slow",
+			parts:    []string{"HTTP/1.1 200 OK\r\n\r\n", "hello ", "slow ", "world"},
+			expected: "HTTP/1.1 200 OK\r\n\r\nhello slow world",
+		},
+		{
+			name:     "content_length_lowercase_tiny_reads",
+			parts:    strings.Split("HTTP/1.1 200 OK\r\ncontent-length: 5\r\n\r\nhello", ""),
+			keepOpen: true,
+			expected: "HTTP/1.1 200 OK\r\ncontent-length: 5\r\n\r\nhello",
+		},
+		{
+			name:     "chunked_trailers",
+			parts:    strings.Split("HTTP/1.1 200 OK\r\ntransfer-encoding: Chunked\r\n\r\n5\r\nhello\r\n0\r\nX-Sum: abc\r\n\r\n", ""),
+			keepOpen: true,
+			expected: "HTTP/1.1 200 OK\r\ntransfer-encoding: Chunked\r\n\r\n5\r\nhello\r\n0\r\nX-Sum: abc\r\n\r\n",
+		},
+		{
+			name:     "chunked_over_content_length",
+			parts:    []string{"HTTP/1.1 200 OK\r\nContent-Length: 100\r\nTransfer-Encoding: chunked\r\n\r\n", "2\r\nhi\r\n", "0\r\n\r\n"},
+			keepOpen: true,
+			expected: "HTTP/1.1 200 OK\r\nContent-Length: 100\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n0\r\n\r\n",
+		},
+		{
+			name:     "no_content",
+			parts:    []string{"HTTP/1.1 204 No Content\r\n\r\n"},
+			keepOpen: true,
+			expected: "HTTP/1.1 204 No Content\r\n\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr := startTestH2CServer(t, func(conn net.Conn) {
+				if _, err := readHTTP1Header(bufio.NewReader(conn)); err != nil {
+					return
+				}
+				for _, part := range test.parts {
+					io.WriteString(conn, part)
+					time.Sleep(time.Millisecond)
+				}
+				if test.keepOpen {
+					time.Sleep(time.Second)
+				}
+			})
+
+			tcm := connectTestServer(t, addr)
+			defer tcm.Close()
+			tcm.SetTimeouts(Timeouts{FirstByte: time.Second, IdleRead: 500 * time.Millisecond})
+
+			got, err := tcm.DispatchHTTPRequest("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadChunks(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "chunks", body: "3\r\nhel\r\n2;ext=1\r\nlo\r\n0\r\n\r\n", expected: "hello"},
+		{name: "trailers", body: "5\r\nhello\r\n0\r\nA: b\r\nC: d\r\n\r\n", expected: "hello"},
+		{name: "data_like_last_chunk", body: "7\r\n\r\n0\r\n\r\n\r\n0\r\n\r\n", expected: "\r\n0\r\n\r\n"},
+		{name: "invalid_size", body: "zz\r\nhello\r\n0\r\n\r\n", expectedErr: true},
+		{name: "missing_crlf", body: "5\r\nhelloX0\r\n\r\n", expectedErr: true},
+		{name: "truncated", body: "5\r\nhel", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var data, raw strings.Builder
+			err := readChunks(bufio.NewReader(strings.NewReader(test.body)), &data, &raw)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", test.body)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data.String() != test.expected || raw.String() != test.body {
+				t.Fatalf("expected: %q from %q\tgot: %q from %q", test.expected, test.body, data.String(), raw.String())
+			}
+		})
+	}
+}
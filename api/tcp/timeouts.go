@@ -0,0 +1,121 @@
+package tcp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+)
+
+/*
+Each phase of a request has its own timeout:
+
+  - Connect: TCP connection (and proxy handshake)
+  - TLSHandshake: TLS handshake after connecting
+  - FirstByte: waiting for the first byte of the response
+  - IdleRead: waiting between two reads (and for writes)
+
+Total limits the whole operation (including redirects
+and retries) and ends at Deadline. Zero means no limit.
+*/
+type Timeouts struct {
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+	IdleRead     time.Duration
+	Total        time.Duration
+	Deadline     time.Time
+}
+
+// Phase timeout, shortened if the total deadline
+// comes earlier. The bool shows if it was shortened.
+func (t Timeouts) limit(timeout time.Duration) (time.Duration, bool) {
+	if t.Deadline.IsZero() {
+		return timeout, false
+	}
+
+	untilDeadline := time.Until(t.Deadline)
+	if untilDeadline <= 0 {
+		// Already passed; the smallest timeout fails right away
+		return time.Nanosecond, true
+	}
+
+	if timeout == 0 || untilDeadline < timeout {
+		return untilDeadline, true
+	}
+
+	return timeout, false
+}
+
+// Zero time clears the deadline of the conn
+func deadlineFrom(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// Replaces a timeout error with the phase (or the
+// total time) that ran out.
+func (t Timeouts) wrapTimeout(err error, phase string, timeout time.Duration, isTotal bool) error {
+	if err == nil || !isTimeout(err) {
+		return err
+	}
+
+	if isTotal {
+		return apperrors.TimeoutError{Phase: "total", After: t.Total}
+	}
+	return apperrors.TimeoutError{Phase: phase, After: timeout}
+}
+
+/*
+Sets the read deadline before every read instead of
+once per request, so a slow but steady download does
+not fail as long as data keeps arriving.
+
+The reads and writes are also recorded in the trace.
+*/
+type timedConn struct {
+	net.Conn
+	timeouts     Timeouts
+	trace        *Trace
+	gotFirstByte bool
+}
+
+func newTimedConn(conn net.Conn, timeouts Timeouts, trace *Trace) *timedConn {
+	return &timedConn{Conn: conn, timeouts: timeouts, trace: trace}
+}
+
+func (tc *timedConn) Read(b []byte) (int, error) {
+	phase, timeout := "idle read", tc.timeouts.IdleRead
+	if !tc.gotFirstByte {
+		phase, timeout = "first byte", tc.timeouts.FirstByte
+	}
+
+	limited, isTotal := tc.timeouts.limit(timeout)
+	tc.Conn.SetReadDeadline(deadlineFrom(limited))
+
+	n, err := tc.Conn.Read(b)
+	if n > 0 {
+		tc.gotFirstByte = true
+	}
+	tc.trace.markRead(n)
+
+	return n, tc.timeouts.wrapTimeout(err, phase, timeout, isTotal)
+}
+
+func (tc *timedConn) Write(b []byte) (int, error) {
+	limited, isTotal := tc.timeouts.limit(tc.timeouts.IdleRead)
+	tc.Conn.SetWriteDeadline(deadlineFrom(limited))
+
+	n, err := tc.Conn.Write(b)
+	tc.trace.markWrite()
+	return n, tc.timeouts.wrapTimeout(err, "write", tc.timeouts.IdleRead, isTotal)
+}
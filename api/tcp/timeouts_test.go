@@ -0,0 +1,92 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/models"
+)
+
+func TestDispatchHTTPRequestTimeouts(t *testing.T) {
+	tests := []struct {
+		name          string
+		timeouts      Timeouts
+		serve         func(conn net.Conn)
+		expectedPhase string
+	}{
+		{
+			name:          "first_byte",
+			timeouts:      Timeouts{FirstByte: 50 * time.Millisecond, IdleRead: time.Second},
+			serve:         func(conn net.Conn) { time.Sleep(300 * time.Millisecond) },
+			expectedPhase: "first byte",
+		},
+		{
+			name:     "idle_read",
+			timeouts: Timeouts{FirstByte: time.Second, IdleRead: 50 * time.Millisecond},
+			serve: func(conn net.Conn) {
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 10\r\n\r\nabc")
+				time.Sleep(300 * time.Millisecond)
+			},
+			expectedPhase: "idle read",
+		},
+		{
+			name:          "total",
+			timeouts:      Timeouts{FirstByte: time.Second, Total: 50 * time.Millisecond},
+			serve:         func(conn net.Conn) { time.Sleep(300 * time.Millisecond) },
+			expectedPhase: "total",
+		},
+		{
+			// Each read resets the idle timeout
+			name:     "slow_but_steady",
+			timeouts: Timeouts{FirstByte: time.Second, IdleRead: 150 * time.Millisecond},
+			serve: func(conn net.Conn) {
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 3\r\n\r\n")
+				for _, b := range []string{"a", "b", "c"} {
+					time.Sleep(80 * time.Millisecond)
+					io.WriteString(conn, b)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr := startTestH2CServer(t, func(conn net.Conn) {
+				if _, err := conn.Read(make([]byte, 1024)); err != nil {
+					return
+				}
+				test.serve(conn)
+			})
+
+			if test.timeouts.Total > 0 {
+				test.timeouts.Deadline = time.Now().Add(test.timeouts.Total)
+			}
+
+			tcm := NewTCPConnManager(models.ConnInfo{IP: addr.IP, Port: addr.Port}, addr.String(), nil, nil)
+			tcm.SetTimeouts(test.timeouts)
+			if err := tcm.InitTCPConn(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer tcm.Close()
+
+			_, err := tcm.DispatchHTTPRequest("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+
+			if test.expectedPhase == "" {
+				if err != nil {
+					t.Fatalf("expected no error\tgot: %v", err)
+				}
+				return
+			}
+
+			var timeoutErr apperrors.TimeoutError
+			if !errors.As(err, &timeoutErr) || timeoutErr.Phase != test.expectedPhase {
+				t.Fatalf("expected %s timeout\tgot: %v", test.expectedPhase, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Bytes used at the beginning of a cached session
+// file to store the length of the session ticket.
+const sessionTicketLenBytes = 4
+
+/*
+Every gURL run is a new process, so the in-memory
+session cache of crypto/tls is lost after each run.
+FileSessionCache implements tls.ClientSessionCache
+and stores the session tickets on disk so the next
+run against the same server can resume the session
+and skip a full handshake.
+
+Each server name has its own file:
+  - Ticket length (4 bytes)
+  - Ticket (variable)
+  - Serialized session state (rest of the file)
+*/
+type FileSessionCache struct {
+	dir string
+}
+
+func NewFileSessionCache(dir string) FileSessionCache {
+	return FileSessionCache{dir: dir}
+}
+
+// The session key is the server name (or the address
+// if no server name was set), so path separators must
+// not end up in the file name.
+func (f FileSessionCache) sessionFile(sessionKey string) string {
+	fileName := strings.NewReplacer("/", "_", "\\", "_").Replace(sessionKey)
+	return filepath.Join(f.dir, fileName)
+}
+
+func (f FileSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	content, err := os.ReadFile(f.sessionFile(sessionKey))
+	if err != nil {
+		return nil, false
+	}
+
+	cs, err := decodeClientSession(content)
+	if err != nil {
+		// A corrupted file is useless, the next
+		// handshake will store a fresh one.
+		os.Remove(f.sessionFile(sessionKey))
+		return nil, false
+	}
+
+	return cs, true
+}
+
+// crypto/tls calls Put with nil session when the
+// cached session must be evicted.
+func (f FileSessionCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if cs == nil {
+		os.Remove(f.sessionFile(sessionKey))
+		return
+	}
+
+	content, err := encodeClientSession(cs)
+	if err != nil {
+		return
+	}
+
+	// Caching is best effort and should never
+	// stop the request.
+	os.WriteFile(f.sessionFile(sessionKey), content, 0o600)
+}
+
+func encodeClientSession(cs *tls.ClientSessionState) ([]byte, error) {
+	ticket, state, err := cs.ResumptionState()
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, fmt.Errorf("session is not resumable")
+	}
+
+	stateBytes, err := state.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	content := make([]byte, sessionTicketLenBytes, sessionTicketLenBytes+len(ticket)+len(stateBytes))
+	binary.BigEndian.PutUint32(content, uint32(len(ticket)))
+	content = append(content, ticket...)
+	content = append(content, stateBytes...)
+
+	return content, nil
+}
+
+func decodeClientSession(content []byte) (*tls.ClientSessionState, error) {
+	if len(content) < sessionTicketLenBytes {
+		return nil, fmt.Errorf("cached session too short")
+	}
+
+	ticketLen := int(binary.BigEndian.Uint32(content[:sessionTicketLenBytes]))
+	content = content[sessionTicketLenBytes:]
+	if ticketLen > len(content) {
+		return nil, fmt.Errorf("cached session ticket truncated")
+	}
+
+	state, err := tls.ParseSessionState(content[ticketLen:])
+	if err != nil {
+		return nil, err
+	}
+
+	return tls.NewResumptionState(content[:ticketLen], state)
+}
@@ -0,0 +1,140 @@
+package tcp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testServerName = "gurl.test"
+
+// Creates a self-signed certificate for testServerName
+// and the pool that trusts it.
+func createTestCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: testServerName},
+		DNSNames:              []string{testServerName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func startTestTLSServer(t *testing.T, cert tls.Certificate) net.Listener {
+	t.Helper()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("ok"))
+			conn.Close()
+		}
+	}()
+
+	return ln
+}
+
+// Reading the whole response is required since
+// TLS 1.3 tickets arrive after the handshake.
+func dialTestTLSServer(t *testing.T, addr string, pool *x509.CertPool, cache tls.ClientSessionCache) bool {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		RootCAs:            pool,
+		ServerName:         testServerName,
+		ClientSessionCache: cache,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	return conn.ConnectionState().DidResume
+}
+
+func TestFileSessionCacheResumesAcrossCaches(t *testing.T) {
+	cert, pool := createTestCert(t)
+	ln := startTestTLSServer(t, cert)
+	cacheDir := t.TempDir()
+
+	if dialTestTLSServer(t, ln.Addr().String(), pool, NewFileSessionCache(cacheDir)) {
+		t.Fatal("first handshake must not be resumed")
+	}
+
+	if _, err := os.Stat(filepath.Join(cacheDir, testServerName)); err != nil {
+		t.Fatalf("expected cached session file: %v", err)
+	}
+
+	// A new cache over the same directory mimics
+	// a new gURL process.
+	if !dialTestTLSServer(t, ln.Addr().String(), pool, NewFileSessionCache(cacheDir)) {
+		t.Fatal("second handshake must be resumed from file cache")
+	}
+}
+
+func TestFileSessionCacheCorruptedFile(t *testing.T) {
+	cacheDir := t.TempDir()
+	cache := NewFileSessionCache(cacheDir)
+	sessionFile := filepath.Join(cacheDir, testServerName)
+
+	if err := os.WriteFile(sessionFile, []byte{0, 0, 0, 9, 1}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := cache.Get(testServerName); ok {
+		t.Fatal("expected cache miss for corrupted file")
+	}
+
+	if _, err := os.Stat(sessionFile); !os.IsNotExist(err) {
+		t.Fatal("expected corrupted file to be removed")
+	}
+}
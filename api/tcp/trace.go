@@ -0,0 +1,79 @@
+package tcp
+
+import "time"
+
+/*
+Trace records when each phase of a connection ended,
+as the time passed since Start (the same way as the
+-w variables of cURL). Zero means the phase did not
+happen, e.g. TLSHandshake without TLS.
+
+  - DNSLookup: IP of the domain resolved
+  - Connect: TCP connected (and proxy handshake done)
+  - TLSHandshake: TLS handshake done
+  - RequestSent: last write before the response started
+  - FirstByte: first byte of the response received
+  - Done: response fully read
+
+A nil *Trace records nothing.
+*/
+type Trace struct {
+	Start        time.Time
+	DNSLookup    time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	RequestSent  time.Duration
+	FirstByte    time.Duration
+	Done         time.Duration
+}
+
+func NewTrace() *Trace {
+	return &Trace{Start: time.Now()}
+}
+
+func (t *Trace) MarkDNSLookup() {
+	if t != nil {
+		t.DNSLookup = time.Since(t.Start)
+	}
+}
+
+func (t *Trace) MarkDone() {
+	if t != nil {
+		t.Done = time.Since(t.Start)
+	}
+}
+
+// A new connection on the same manager (retry or
+// Digest challenge) starts a new trace. DNS is not
+// resolved again so it stays zero.
+func (t *Trace) restartIfUsed() {
+	if t != nil && t.Connect != 0 {
+		*t = Trace{Start: time.Now()}
+	}
+}
+
+func (t *Trace) markConnect() {
+	if t != nil {
+		t.Connect = time.Since(t.Start)
+	}
+}
+
+func (t *Trace) markTLSHandshake() {
+	if t != nil {
+		t.TLSHandshake = time.Since(t.Start)
+	}
+}
+
+// Writes after the first byte (e.g. HTTP/2 SETTINGS
+// ACK or WINDOW_UPDATE) are not part of the request.
+func (t *Trace) markWrite() {
+	if t != nil && t.FirstByte == 0 {
+		t.RequestSent = time.Since(t.Start)
+	}
+}
+
+func (t *Trace) markRead(n int) {
+	if t != nil && n > 0 && t.FirstByte == 0 {
+		t.FirstByte = time.Since(t.Start)
+	}
+}
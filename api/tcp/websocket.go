@@ -0,0 +1,617 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/api/ws"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+	"github.com/saeidalz13/gurl/internal/wsutils"
+)
+
+// How long to wait for the close frame of the
+// server after sending ours.
+const wsCloseTimeout = 5 * time.Second
+
+// Reason of a close frame must fit in a control
+// frame after the 2-byte code.
+const maxCloseReasonLen = 123
+
+/*
+Settings of the session:
+
+  - Subprotocols: offered in Sec-WebSocket-Protocol in
+    order of preference; the server may select one.
+  - Origin: value of the Origin header, if any.
+  - Header: more headers of the handshake request, in
+    format of "Name: value".
+  - Cookies: sent along with the ones from the jar,
+    e.g. "name1=value1; name2=value2".
+  - BinaryDir: binary messages of the server are saved
+    to files in this directory instead of being printed
+    as a hex dump. It's created if it doesn't exist.
+  - DisableCompression: permessage-deflate is not
+    offered in the handshake.
+  - Script: the session runs without the terminal
+    (see WebSocketScript); nil means interactive.
+  - HistoryFile: lines typed in the prompt are kept
+    in this file for the next sessions, if set.
+  - Record: messages and control frames of both sides
+    are written to it as they happen (see
+    wsutils.RecordedEvent), e.g. to replay them later.
+  - Replay: the client side of a recording is sent
+    instead of the input of the terminal.
+*/
+type WebSocketOptions struct {
+	Subprotocols       []string
+	Origin             string
+	Header             []string
+	Cookies            string
+	BinaryDir          string
+	DisableCompression bool
+	Script             *WebSocketScript
+	HistoryFile        string
+	Record             io.Writer
+	Replay             *WebSocketReplay
+}
+
+/*
+WebSocket connection after a successful handshake.
+Messages are read on one goroutine (ReadMessages)
+while the input is sent from another (SendInput);
+the frame writer keeps their frames apart.
+*/
+type WebSocketConn struct {
+	mr          *wsutils.MessageReader
+	fw          *wsutils.FrameWriter
+	verbose     bool
+	opts        WebSocketOptions
+	handshake   ws.HandshakeResponse
+	subprotocol string
+
+	// Only used by ReadMessages to name the files
+	openedAt    time.Time
+	binaryCount int
+	waiter      *messageWaiter
+	checker     *replayChecker
+
+	recorder *wsutils.Recorder
+
+	mu          sync.Mutex
+	closeSent   bool
+	closeCode   int
+	closeReason string
+	pings       map[string]time.Time
+	pingCount   int
+
+	// For /save
+	lastMessage []byte
+}
+
+/*
+Sends the handshake request and verifies the
+response of the server. The handshake has the
+timeouts of a request (e.g. first byte); the session
+has none since it may stay idle for long.
+*/
+func (tcm TCPConnManager) OpenWebSocket(wsRequest, secWsKey string, verbose bool, opts WebSocketOptions) (*WebSocketConn, error) {
+	conn := tcm.timedConn()
+	if _, err := conn.Write([]byte(wsRequest)); err != nil {
+		return nil, err
+	}
+
+	hbr := bufio.NewReader(conn)
+	header, err := readHTTP1Header(hbr)
+	if err != nil {
+		return nil, wsReadError(err)
+	}
+
+	if err := tcm.conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	// Frames may follow the handshake response in
+	// the same read, so they are read first.
+	buffered, _ := hbr.Peek(hbr.Buffered())
+	br := bufio.NewReader(io.MultiReader(bytes.NewReader(buffered), tcm.conn))
+
+	if verbose {
+		terminalutils.PrintSwitchingProtocols(string(header))
+	}
+
+	resp, err := ws.ParseHandshakeResponse(header)
+	if err != nil {
+		return nil, apperrors.ProtocolError{Protocol: "WebSocket", Err: err}
+	}
+
+	subprotocol, err := ws.ValidateHandshake(resp, secWsKey, opts.Subprotocols)
+	if err != nil {
+		return nil, apperrors.ProtocolError{Protocol: "WebSocket", Err: err}
+	}
+
+	var compressor *wsutils.Compressor
+	var decompressor *wsutils.Decompressor
+
+	deflateParams, deflate, err := negotiatedDeflate(resp, opts.DisableCompression)
+	if err != nil {
+		return nil, apperrors.ProtocolError{Protocol: "WebSocket", Err: err}
+	}
+	if deflate {
+		compressor = wsutils.NewCompressor(deflateParams)
+		decompressor = wsutils.NewDecompressor(deflateParams, wsutils.DefaultMaxMessageSize)
+	}
+	// The session may go on without one; the server
+	// decides whether it can serve the client.
+	if subprotocol == "" && len(opts.Subprotocols) > 0 {
+		terminalutils.PrintAppWarning(fmt.Sprintf("server did not select any of the subprotocols: %s", strings.Join(opts.Subprotocols, ", ")))
+	}
+
+	if verbose {
+		if subprotocol != "" {
+			terminalutils.PrintWsSubprotocol(subprotocol)
+		}
+		terminalutils.PrintWsCompression(deflate, deflateParams.String())
+	}
+
+	terminalutils.PrintWsOpen(tcm.domain, subprotocol)
+
+	// From now on, the session closes with a close
+	// frame when ctx is done instead of dropping the conn.
+	if tcm.stopCancel != nil {
+		tcm.stopCancel()
+	}
+
+	var waiter *messageWaiter
+	if opts.Script != nil && opts.Script.waits() {
+		waiter = newMessageWaiter(opts.Script)
+	}
+	var checker *replayChecker
+	if opts.Replay != nil {
+		checker = newReplayChecker(opts.Replay.expected())
+	}
+	var recorder *wsutils.Recorder
+	if opts.Record != nil {
+		recorder = wsutils.NewRecorder(opts.Record)
+	}
+
+	fr := wsutils.NewFrameReader(br, wsutils.DefaultMaxFrameSize)
+	fr.RejectMaskedFrames()
+	return &WebSocketConn{
+		mr:          wsutils.NewMessageReader(fr, wsutils.DefaultMaxMessageSize, decompressor),
+		fw:          wsutils.NewFrameWriter(tcm.conn, wsutils.DefaultFragmentSize, compressor),
+		verbose:     verbose,
+		opts:        opts,
+		handshake:   resp,
+		subprotocol: subprotocol,
+		openedAt:    time.Now(),
+		waiter:      waiter,
+		checker:     checker,
+		recorder:    recorder,
+		pings:       make(map[string]time.Time),
+	}, nil
+}
+
+// Response of the server to the upgrade request
+// (e.g. for its Set-Cookie headers).
+func (wc *WebSocketConn) Handshake() ws.HandshakeResponse {
+	return wc.handshake
+}
+
+// Empty if the server didn't select one
+func (wc *WebSocketConn) Subprotocol() string {
+	return wc.subprotocol
+}
+
+// The server may only accept what was offered, so
+// with compression disabled, no extension at all.
+func negotiatedDeflate(resp ws.HandshakeResponse, disabled bool) (wsutils.DeflateParams, bool, error) {
+	extensions := resp.Value("Sec-WebSocket-Extensions")
+	if extensions == "" {
+		return wsutils.DeflateParams{}, false, nil
+	}
+	if disabled {
+		return wsutils.DeflateParams{}, false, fmt.Errorf("%w: server accepted %q without an offer", wsutils.ErrInvalidExtension, extensions)
+	}
+
+	return wsutils.ParseDeflateResponse(extensions)
+}
+
+/*
+Prints the messages of the server until the session
+is closed. Pings are answered with pongs. The result
+is nil if it was closed normally (1000 or without a
+code), otherwise WebSocketCloseError with the code.
+*/
+func (wc *WebSocketConn) ReadMessages() error {
+	for {
+		msg, err := wc.mr.ReadMessage()
+		if err != nil {
+			return wc.readFailed(err)
+		}
+		wc.recorder.Record(wsutils.DirectionReceived, msg.Opcode, msg.Payload)
+
+		switch msg.Opcode {
+		case wsutils.OpcodeText:
+			terminalutils.PrintWsServerMsg(msg.Payload, false)
+			wc.received(msg.Opcode, msg.Payload)
+
+		case wsutils.OpcodeBinary:
+			wc.receivedBinary(msg.Payload)
+			wc.received(msg.Opcode, msg.Payload)
+
+		case wsutils.OpcodePing:
+			if wc.verbose {
+				terminalutils.PrintWsPing(string(msg.Payload))
+			}
+			// The pong has the payload of the ping
+			if err := wc.writeControl(wsutils.OpcodePong, msg.Payload); err != nil {
+				return err
+			}
+
+		case wsutils.OpcodePong:
+			wc.receivedPong(string(msg.Payload))
+
+		case wsutils.OpcodeClose:
+			return wc.receivedClose(msg.Payload)
+		}
+	}
+}
+
+func (wc *WebSocketConn) received(opcode byte, payload []byte) {
+	wc.mu.Lock()
+	wc.lastMessage = payload
+	wc.mu.Unlock()
+
+	wc.waiter.receive(payload)
+	wc.checker.receive(opcode, payload)
+}
+
+// The server is told why (e.g. 1002 for a protocol
+// error) before the session ends.
+func (wc *WebSocketConn) readFailed(err error) error {
+	if wsutils.IsProtocolViolation(err) {
+		_ = wc.Close(wsutils.CloseCodeOf(err), "")
+		return apperrors.ProtocolError{Protocol: "WebSocket", Err: err}
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return apperrors.WebSocketCloseError{Code: wsutils.CloseAbnormal, Reason: "server closed connection without close frame"}
+	}
+
+	return wsReadError(err)
+}
+
+// If the server started the closing handshake, its
+// code is sent back to complete it.
+func (wc *WebSocketConn) receivedClose(payload []byte) error {
+	code, reason, err := wsutils.ParseClosePayload(payload)
+	if err != nil {
+		return wc.readFailed(err)
+	}
+	terminalutils.PrintWsCloseFrame(false, code, reason)
+
+	wc.mu.Lock()
+	closeSent := wc.closeSent
+	wc.mu.Unlock()
+
+	if !closeSent {
+		if err := wc.Close(code, ""); err != nil {
+			return err
+		}
+	}
+
+	return closeResult(code, reason)
+}
+
+func closeResult(code int, reason string) error {
+	if code == wsutils.CloseNormal || code == wsutils.CloseNoStatus {
+		return nil
+	}
+	return apperrors.WebSocketCloseError{Code: code, Reason: reason}
+}
+
+// Saved to BinaryDir if set. A failed save doesn't
+// end the session; the message is printed instead.
+func (wc *WebSocketConn) receivedBinary(payload []byte) {
+	if wc.opts.BinaryDir == "" {
+		terminalutils.PrintWsServerMsg(payload, true)
+		return
+	}
+
+	wc.binaryCount++
+	path := filepath.Join(wc.opts.BinaryDir, fmt.Sprintf("ws-%s-%d.bin", wc.openedAt.Format("20060102-150405"), wc.binaryCount))
+
+	if err := os.MkdirAll(wc.opts.BinaryDir, 0o755); err != nil {
+		terminalutils.PrintWsError(fmt.Sprintf("binary message not saved: %v", err))
+		terminalutils.PrintWsServerMsg(payload, true)
+		return
+	}
+	if err := os.WriteFile(path, payload, 0o644); err != nil {
+		terminalutils.PrintWsError(fmt.Sprintf("binary message not saved: %v", err))
+		terminalutils.PrintWsServerMsg(payload, true)
+		return
+	}
+
+	terminalutils.PrintWsBinarySaved(path, len(payload))
+}
+
+func (wc *WebSocketConn) receivedPong(payload string) {
+	wc.mu.Lock()
+	sentAt, found := wc.pings[payload]
+	delete(wc.pings, payload)
+	wc.mu.Unlock()
+
+	switch {
+	case found:
+		terminalutils.PrintWsPong(payload, time.Since(sentAt))
+	case wc.verbose:
+		// Unsolicited pongs are allowed as heartbeats
+		terminalutils.PrintWsPong(payload, 0)
+	}
+}
+
+// Without payload, a numbered one is used to match
+// the pong and show the round trip time.
+func (wc *WebSocketConn) Ping(payload string) error {
+	if len(payload) > 125 {
+		return fmt.Errorf("ping payload of %d bytes is too long, max is 125", len(payload))
+	}
+
+	wc.mu.Lock()
+	if payload == "" {
+		wc.pingCount++
+		payload = "gurl-" + strconv.Itoa(wc.pingCount)
+	}
+	wc.pings[payload] = time.Now()
+	wc.mu.Unlock()
+
+	return wc.writeControl(wsutils.OpcodePing, []byte(payload))
+}
+
+// Sends the close frame (only once). The session
+// ends when the server answers with its own.
+func (wc *WebSocketConn) Close(code int, reason string) error {
+	if len(reason) > maxCloseReasonLen {
+		return fmt.Errorf("close reason of %d bytes is too long, max is %d", len(reason), maxCloseReasonLen)
+	}
+
+	wc.mu.Lock()
+	if wc.closeSent {
+		wc.mu.Unlock()
+		return nil
+	}
+	wc.closeSent, wc.closeCode, wc.closeReason = true, code, reason
+	wc.mu.Unlock()
+
+	terminalutils.PrintWsCloseFrame(true, code, reason)
+	return wc.writeControl(wsutils.OpcodeClose, wsutils.EncodeClosePayload(code, reason))
+}
+
+func (wc *WebSocketConn) writeControl(opcode byte, payload []byte) error {
+	if err := wc.fw.WriteFrame(wsutils.Frame{Fin: true, Opcode: opcode, Payload: payload}); err != nil {
+		return err
+	}
+	wc.recorder.Record(wsutils.DirectionSent, opcode, payload)
+	return nil
+}
+
+/*
+Waits for ReadMessages to end after Close. If the
+server doesn't answer in time, the session ends
+with the code that was sent.
+*/
+func (wc *WebSocketConn) AwaitClose(readDone <-chan error) error {
+	select {
+	case err := <-readDone:
+		return err
+	case <-time.After(wsCloseTimeout):
+		wc.mu.Lock()
+		defer wc.mu.Unlock()
+		return closeResult(wc.closeCode, wc.closeReason)
+	}
+}
+
+/*
+Sends the lines of readLine (e.g. the prompt of the
+terminal) as text messages. Lines starting with '/'
+are commands:
+
+	/ping [payload]         ping the server and show the round trip time
+	/close [code] [reason]  close the session (default 1000)
+	/quit                   close the session with 1000
+	/binary @file           send the file as a binary message
+	/hex 01ff..             send the hex bytes as a binary message
+	/base64 Af8=            send the base64 bytes as a binary message
+	/save file              save the last message of the server to the file
+	/clear                  clear the screen
+
+A line starting with "//" is sent as a message
+starting with '/'. Returns nil once the close
+frame is sent, also at the end of the input
+(e.g. Ctrl-D), which closes with 1000.
+*/
+func (wc *WebSocketConn) SendInput(readLine func() ([]byte, error)) error {
+	for {
+		input, err := readLine()
+		if errors.Is(err, io.EOF) {
+			return wc.Close(wsutils.CloseNormal, "")
+		}
+		if err != nil {
+			return err
+		}
+		line := string(input)
+
+		if command, found := strings.CutPrefix(line, "/"); found && !strings.HasPrefix(command, "/") {
+			closed, err := wc.runCommand(command)
+			if err != nil || closed {
+				return err
+			}
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "/")
+		if err := wc.sendMessage(wsutils.OpcodeText, []byte(line)); err != nil {
+			return err
+		}
+	}
+}
+
+// Messages can't be sent after the close frame
+// (wsutils.ErrCloseSent).
+func (wc *WebSocketConn) sendMessage(opcode byte, payload []byte) error {
+	if wc.fw.CloseSent() {
+		return wsutils.ErrCloseSent
+	}
+
+	terminalutils.PrintWsClientMsg(payload, opcode == wsutils.OpcodeBinary)
+	if err := wc.fw.WriteMessage(opcode, payload); err != nil {
+		return err
+	}
+	wc.recorder.Record(wsutils.DirectionSent, opcode, payload)
+	return nil
+}
+
+// First error of writing Record, if any
+func (wc *WebSocketConn) RecordErr() error {
+	return wc.recorder.Err()
+}
+
+// Mistakes in the command are printed and the
+// session goes on; only failed writes are returned.
+func (wc *WebSocketConn) runCommand(command string) (bool, error) {
+	name, args, _ := strings.Cut(command, " ")
+	args = strings.TrimSpace(args)
+
+	switch name {
+	case "ping":
+		if len(args) > 125 {
+			terminalutils.PrintWsError(fmt.Sprintf("ping payload of %d bytes is too long, max is 125", len(args)))
+			return false, nil
+		}
+		return false, wc.Ping(args)
+
+	case "close":
+		code, reason, err := parseCloseArgs(args)
+		if err != nil {
+			terminalutils.PrintWsError(err.Error())
+			return false, nil
+		}
+		return true, wc.Close(code, reason)
+
+	case "quit":
+		return true, wc.Close(wsutils.CloseNormal, "")
+
+	case "save":
+		if err := wc.saveLastMessage(args); err != nil {
+			terminalutils.PrintWsError(err.Error())
+		}
+		return false, nil
+
+	case "clear":
+		terminalutils.ClearScreen()
+		return false, nil
+
+	case "binary", "hex", "base64":
+		payload, err := binaryInput(name, args)
+		if err != nil {
+			terminalutils.PrintWsError(err.Error())
+			return false, nil
+		}
+		return false, wc.sendMessage(wsutils.OpcodeBinary, payload)
+	}
+
+	terminalutils.PrintWsError(fmt.Sprintf("unknown command: /%s (use // to send a message starting with /)", name))
+	return false, nil
+}
+
+func (wc *WebSocketConn) saveLastMessage(path string) error {
+	if path == "" {
+		return errors.New("usage: /save file")
+	}
+
+	wc.mu.Lock()
+	payload := wc.lastMessage
+	wc.mu.Unlock()
+
+	if payload == nil {
+		return errors.New("no message received yet")
+	}
+	if err := os.WriteFile(path, payload, 0o644); err != nil {
+		return err
+	}
+
+	terminalutils.PrintSavedFile(fmt.Sprintf("%s (%d bytes)", path, len(payload)))
+	return nil
+}
+
+// e.g. "4000 going home" -> 4000, "going home".
+// Without a code, 1000 (normal closure) is used.
+func parseCloseArgs(args string) (int, string, error) {
+	if args == "" {
+		return wsutils.CloseNormal, "", nil
+	}
+
+	codeStr, reason, _ := strings.Cut(args, " ")
+	code, err := strconv.Atoi(codeStr)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid close code: %s", codeStr)
+	}
+	if !wsutils.IsValidCloseCode(code) {
+		return 0, "", fmt.Errorf("close code %d can't be sent, use 1000-1003, 1007-1011 or 3000-4999", code)
+	}
+
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxCloseReasonLen {
+		return 0, "", fmt.Errorf("close reason of %d bytes is too long, max is %d", len(reason), maxCloseReasonLen)
+	}
+
+	return code, reason, nil
+}
+
+// Payload of /binary, /hex and /base64
+func binaryInput(command, args string) ([]byte, error) {
+	switch command {
+	case "hex":
+		return wsutils.DecodeHexInput(args)
+	case "base64":
+		return wsutils.DecodeBase64Input(args)
+	}
+
+	path, found := strings.CutPrefix(args, "@")
+	if !found || path == "" {
+		return nil, errors.New("usage: /binary @file")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > wsutils.DefaultMaxMessageSize {
+		return nil, fmt.Errorf("%s is %d bytes, max is %d", path, info.Size(), wsutils.DefaultMaxMessageSize)
+	}
+
+	return os.ReadFile(path)
+}
+
+// Frames that break RFC 6455 end the session since
+// the rest of the stream can't be trusted.
+func wsReadError(err error) error {
+	switch {
+	case errors.Is(err, io.EOF):
+		return errors.New("server closed connection")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return apperrors.ProtocolError{Protocol: "WebSocket", Err: errors.New("server closed connection in the middle of a frame")}
+	case wsutils.IsProtocolViolation(err):
+		return apperrors.ProtocolError{Protocol: "WebSocket", Err: err}
+	}
+	return err
+}
@@ -0,0 +1,272 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+	"github.com/saeidalz13/gurl/internal/wsutils"
+)
+
+/*
+Client side of a recorded session (see Record of
+WebSocketOptions), sent again to a server:
+
+  - Messages and pings the client sent are sent at
+    the same times since the start of the recording,
+    divided by speed (e.g. 2 for twice as fast). With
+    speed 0, they are sent without waiting.
+  - Messages of the server are compared in order with
+    the ones in the recording.
+  - After the last one is sent, the rest of the
+    messages of the server are waited for up to
+    timeout (zero means no limit).
+*/
+type WebSocketReplay struct {
+	events  []wsutils.RecordedEvent
+	speed   float64
+	timeout time.Duration
+}
+
+func NewWebSocketReplay(recording io.Reader, speed float64, timeout time.Duration) (*WebSocketReplay, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("replay speed must not be negative: %v", speed)
+	}
+
+	events, err := wsutils.ReadRecording(recording)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%w: no events", wsutils.ErrInvalidRecording)
+	}
+
+	return &WebSocketReplay{events: events, speed: speed, timeout: timeout}, nil
+}
+
+// Messages of the server in the recording
+func (r *WebSocketReplay) expected() []wsutils.RecordedEvent {
+	var expected []wsutils.RecordedEvent
+	for _, event := range r.events {
+		if event.Direction == wsutils.DirectionReceived && (event.Opcode == "text" || event.Opcode == "binary") {
+			expected = append(expected, event)
+		}
+	}
+	return expected
+}
+
+// Time to send the event since the replay started
+func (r *WebSocketReplay) offset(event wsutils.RecordedEvent) time.Duration {
+	if r.speed == 0 {
+		return 0
+	}
+	return time.Duration(float64(event.Time.Sub(r.events[0].Time)) / r.speed)
+}
+
+/*
+Compares the messages of the server with the recording
+as ReadMessages receives them. Each one that differs
+(or wasn't in the recording) is printed right away.
+*/
+type replayChecker struct {
+	mu         sync.Mutex
+	expected   []wsutils.RecordedEvent
+	received   int
+	mismatches int
+
+	// Closed once all the expected messages arrived
+	done chan struct{}
+}
+
+func newReplayChecker(expected []wsutils.RecordedEvent) *replayChecker {
+	c := &replayChecker{expected: expected, done: make(chan struct{})}
+	if len(expected) == 0 {
+		close(c.done)
+	}
+	return c
+}
+
+func (c *replayChecker) receive(opcode byte, payload []byte) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.received++
+	if c.received > len(c.expected) {
+		c.mismatches++
+		terminalutils.PrintWsReplayDiff(c.received, "", describeMessage(opcode, payload))
+		return
+	}
+
+	event := c.expected[c.received-1]
+	expectedOpcode, _ := event.OpcodeValue()
+	// Checked when the recording was read
+	expectedPayload, _ := event.Payload()
+
+	if opcode != expectedOpcode || !bytes.Equal(payload, expectedPayload) {
+		c.mismatches++
+		terminalutils.PrintWsReplayDiff(c.received, describeMessage(expectedOpcode, expectedPayload), describeMessage(opcode, payload))
+	}
+
+	if c.received == len(c.expected) {
+		close(c.done)
+	}
+}
+
+/*
+Messages that never arrived are printed as missing,
+then the summary. The result is ExpectationError if
+any message was missing or differed.
+*/
+func (c *replayChecker) finish() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i := c.received; i < len(c.expected); i++ {
+		opcode, _ := c.expected[i].OpcodeValue()
+		payload, _ := c.expected[i].Payload()
+		terminalutils.PrintWsReplayDiff(i+1, describeMessage(opcode, payload), "")
+	}
+
+	missing := max(len(c.expected)-c.received, 0)
+	total := max(len(c.expected), c.received)
+	matched := total - c.mismatches - missing
+	terminalutils.PrintWsReplaySummary(matched, total)
+
+	if matched == total {
+		return nil
+	}
+	return apperrors.ExpectationError{Reason: fmt.Sprintf("%d of %d messages differ from the recording", total-matched, total)}
+}
+
+func describeMessage(opcode byte, payload []byte) string {
+	if opcode == wsutils.OpcodeText {
+		return fmt.Sprintf("%q", expectPreview(payload))
+	}
+	return fmt.Sprintf("binary, %d bytes", len(payload))
+}
+
+/*
+Sends the client side of the recording and compares
+what the server sends, then closes the session with
+1000. readDone is the result of ReadMessages. ctx
+being done (e.g. Ctrl-C) closes the session early.
+*/
+func (wc *WebSocketConn) RunReplay(ctx context.Context, readDone <-chan error) error {
+	replay := wc.opts.Replay
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	sendDone := make(chan error, 1)
+	go func() { sendDone <- wc.sendReplay(replay, stop) }()
+
+	// Only started once everything is sent
+	var timeout <-chan time.Time
+	// Set to nil once closed, since a closed channel
+	// is always ready while the sending goes on.
+	checkerDone := wc.checker.done
+
+	sending, waiting := true, true
+	var result error
+
+	for sending || waiting {
+		select {
+		case err := <-sendDone:
+			sending = false
+			if err != nil {
+				result = err
+				waiting = false
+			} else if replay.timeout > 0 {
+				timer := time.NewTimer(replay.timeout)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+
+		case <-checkerDone:
+			checkerDone = nil
+			waiting = false
+
+		case err := <-readDone:
+			// The server closed the session first
+			if diffErr := wc.checker.finish(); err == nil {
+				err = diffErr
+			}
+			return err
+
+		case <-timeout:
+			waiting = false
+
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				result = ctx.Err()
+			}
+			sending, waiting = false, false
+		}
+	}
+
+	if err := wc.Close(wsutils.CloseNormal, ""); err != nil {
+		return err
+	}
+	closeErr := wc.AwaitClose(readDone)
+
+	if diffErr := wc.checker.finish(); result == nil {
+		result = diffErr
+	}
+	if result != nil {
+		return result
+	}
+	return closeErr
+}
+
+// Close frames of the recording aren't sent; the
+// session is closed once the replay is over.
+func (wc *WebSocketConn) sendReplay(replay *WebSocketReplay, stop <-chan struct{}) error {
+	start := time.Now()
+
+	for _, event := range replay.events {
+		if event.Direction != wsutils.DirectionSent {
+			continue
+		}
+		opcode, _ := event.OpcodeValue()
+		if opcode != wsutils.OpcodeText && opcode != wsutils.OpcodeBinary && opcode != wsutils.OpcodePing {
+			continue
+		}
+
+		if wait := time.Until(start.Add(replay.offset(event))); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-stop:
+				timer.Stop()
+				return nil
+			}
+		}
+
+		payload, _ := event.Payload()
+		var err error
+		if opcode == wsutils.OpcodePing {
+			err = wc.Ping(string(payload))
+		} else {
+			err = wc.sendMessage(opcode, payload)
+		}
+
+		if errors.Is(err, wsutils.ErrCloseSent) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
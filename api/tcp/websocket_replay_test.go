@@ -0,0 +1,87 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+)
+
+// Session where the server echoed "one" and "two"
+const echoRecording = `{"time":"2024-01-01T00:00:00Z","direction":"sent","opcode":"text","data":"one"}
+{"time":"2024-01-01T00:00:00.010Z","direction":"received","opcode":"text","data":"one"}
+{"time":"2024-01-01T00:00:00.100Z","direction":"sent","opcode":"text","data":"two"}
+{"time":"2024-01-01T00:00:00.110Z","direction":"received","opcode":"text","data":"two"}
+{"time":"2024-01-01T00:00:00.200Z","direction":"sent","opcode":"close","data":"A+g=","encoding":"base64"}
+`
+
+func TestReplayOffset(t *testing.T) {
+	tests := []struct {
+		name     string
+		speed    float64
+		expected time.Duration
+	}{
+		{name: "original", speed: 1, expected: 100 * time.Millisecond},
+		{name: "twice_as_fast", speed: 2, expected: 50 * time.Millisecond},
+		{name: "slower", speed: 0.5, expected: 200 * time.Millisecond},
+		{name: "without_waiting", speed: 0, expected: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replay, err := NewWebSocketReplay(strings.NewReader(echoRecording), test.speed, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := replay.offset(replay.events[2]); got != test.expected {
+				t.Fatalf("expected: %s\tgot: %s", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunReplay(t *testing.T) {
+	tests := []struct {
+		name          string
+		reply         func(string) string
+		closeAfter    int
+		expectedError bool
+	}{
+		{name: "same", reply: func(s string) string { return s }},
+		{name: "different", reply: strings.ToUpper, expectedError: true},
+		{name: "missing", reply: func(s string) string { return strings.TrimPrefix(s, "two") }, expectedError: true},
+		{name: "server_closed_first", reply: func(s string) string { return s }, closeAfter: 1, expectedError: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replay, err := NewWebSocketReplay(strings.NewReader(echoRecording), 10, 100*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go serveScript(server, test.reply, test.closeAfter)
+
+			wc := newTestWebSocketConn(client)
+			wc.opts.Replay = replay
+			wc.checker = newReplayChecker(replay.expected())
+
+			readDone := make(chan error, 1)
+			go func() { readDone <- wc.ReadMessages() }()
+
+			err = wc.RunReplay(context.Background(), readDone)
+
+			var expectErr apperrors.ExpectationError
+			if test.expectedError != errors.As(err, &expectErr) {
+				t.Fatalf("expected: expectation error %v\tgot: %v", test.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+//go:build linux || darwin || freebsd
+
+package tcp
+
+import (
+	"context"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// The server answers "one" right away, long before the
+// client sends "two", which the server doesn't answer.
+const delayedSendRecording = `{"time":"2024-01-01T00:00:00Z","direction":"sent","opcode":"text","data":"one"}
+{"time":"2024-01-01T00:00:00.010Z","direction":"received","opcode":"text","data":"one"}
+{"time":"2024-01-01T00:00:00.300Z","direction":"sent","opcode":"text","data":"two"}
+`
+
+func cpuTime(t *testing.T) time.Duration {
+	t.Helper()
+
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		t.Fatal(err)
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+func TestRunReplayWaitsForDelayedSend(t *testing.T) {
+	replay, err := NewWebSocketReplay(strings.NewReader(delayedSendRecording), 1, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	received := make(chan string, 2)
+	go serveScript(server, func(s string) string {
+		received <- s
+		if s == "one" {
+			return s
+		}
+		return ""
+	}, 0)
+
+	wc := newTestWebSocketConn(client)
+	wc.opts.Replay = replay
+	wc.checker = newReplayChecker(replay.expected())
+
+	readDone := make(chan error, 1)
+	go func() { readDone <- wc.ReadMessages() }()
+
+	start, startCPU := time.Now(), cpuTime(t)
+	if err := wc.RunReplay(context.Background(), readDone); err != nil {
+		t.Fatal(err)
+	}
+	elapsed, usedCPU := time.Since(start), cpuTime(t)-startCPU
+
+	if got := []string{<-received, <-received}; got[0] != "one" || got[1] != "two" {
+		t.Fatalf("expected: [one two]\tgot: %q", got)
+	}
+	if elapsed < 300*time.Millisecond {
+		t.Fatalf("expected the replay to wait for the last send\tgot: %s", elapsed)
+	}
+	// Waiting for the last send mustn't busy-loop
+	if usedCPU > elapsed/2 {
+		t.Fatalf("expected: CPU time under %s\tgot: %s", elapsed/2, usedCPU)
+	}
+}
@@ -0,0 +1,236 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/internal/wsutils"
+)
+
+// Long messages are cut in the errors of -expect
+const maxExpectPreviewLen = 200
+
+/*
+Non-interactive session, e.g. for tests:
+
+  - Input: messages sent as they are, one per line.
+    Nil sends nothing (e.g. to only receive).
+  - NDJSON: each line of Input is a JSON value. Strings
+    are sent decoded (so they may have new lines), other
+    values as the JSON text.
+  - Count: messages of the server to wait for after
+    sending.
+  - Match: wait until a message of the server matches.
+  - Expect: each of the Count messages must match,
+    otherwise the session ends with ExpectationError.
+  - Timeout: max time for sending and waiting; zero
+    means no limit.
+
+The session is closed with 1000 once the messages
+are sent and the ones waited for arrived.
+*/
+type WebSocketScript struct {
+	Input   io.Reader
+	NDJSON  bool
+	Count   int
+	Match   *regexp.Regexp
+	Expect  *regexp.Regexp
+	Timeout time.Duration
+}
+
+func (s *WebSocketScript) waits() bool {
+	return s.Count > 0 || s.Match != nil
+}
+
+/*
+Counts the messages of the server for the script.
+It's only used by ReadMessages; the result is sent
+on done once.
+*/
+type messageWaiter struct {
+	script   *WebSocketScript
+	received int
+	finished bool
+	done     chan error
+}
+
+func newMessageWaiter(script *WebSocketScript) *messageWaiter {
+	return &messageWaiter{script: script, done: make(chan error, 1)}
+}
+
+func (w *messageWaiter) receive(payload []byte) {
+	if w == nil || w.finished {
+		return
+	}
+	w.received++
+
+	switch {
+	case w.script.Match != nil:
+		if w.script.Match.Match(payload) {
+			w.finish(nil)
+		}
+
+	case w.script.Expect != nil && !w.script.Expect.Match(payload):
+		w.finish(apperrors.ExpectationError{
+			Reason: fmt.Sprintf("message %d %q does not match %q", w.received, expectPreview(payload), w.script.Expect),
+		})
+
+	case w.received >= w.script.Count:
+		w.finish(nil)
+	}
+}
+
+func (w *messageWaiter) finish(err error) {
+	w.finished = true
+	w.done <- err
+}
+
+func expectPreview(payload []byte) string {
+	if len(payload) > maxExpectPreviewLen {
+		return string(payload[:maxExpectPreviewLen]) + "..."
+	}
+	return string(payload)
+}
+
+/*
+Sends the input of the script and waits for the
+messages of the server, then closes the session.
+readDone is the result of ReadMessages. ctx being
+done (e.g. Ctrl-C) closes the session early.
+*/
+func (wc *WebSocketConn) RunScript(ctx context.Context, readDone <-chan error) error {
+	script := wc.opts.Script
+
+	sendDone := make(chan error, 1)
+	go func() { sendDone <- wc.sendScript(script) }()
+
+	var waitDone <-chan error
+	if wc.waiter != nil {
+		waitDone = wc.waiter.done
+	}
+
+	var timeout <-chan time.Time
+	if script.Timeout > 0 {
+		timer := time.NewTimer(script.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	sending, waiting := true, script.waits()
+	var result error
+
+	for sending || waiting {
+		select {
+		case err := <-sendDone:
+			sending = false
+			// e.g. invalid JSON; the session is still
+			// closed cleanly.
+			if err != nil {
+				result = err
+				waiting = false
+			}
+
+		case result = <-waitDone:
+			waiting = false
+
+		case err := <-readDone:
+			// The server closed the session first
+			if err == nil && waiting {
+				err = apperrors.ExpectationError{Reason: wc.waitedFor()}
+			}
+			return err
+
+		case <-timeout:
+			result = apperrors.TimeoutError{Phase: "websocket script", After: script.Timeout}
+			sending, waiting = false, false
+
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				result = ctx.Err()
+			}
+			sending, waiting = false, false
+		}
+	}
+
+	if err := wc.Close(wsutils.CloseNormal, ""); err != nil {
+		return err
+	}
+	closeErr := wc.AwaitClose(readDone)
+
+	if result != nil {
+		return result
+	}
+	return closeErr
+}
+
+// e.g. "session closed after 1 of 3 messages"
+func (wc *WebSocketConn) waitedFor() string {
+	if wc.opts.Script.Match != nil {
+		return fmt.Sprintf("session closed before a message matched %q", wc.opts.Script.Match)
+	}
+	return fmt.Sprintf("session closed after %d of %d messages", wc.waiter.received, wc.opts.Script.Count)
+}
+
+func (wc *WebSocketConn) sendScript(script *WebSocketScript) error {
+	if script.Input == nil {
+		return nil
+	}
+
+	br := bufio.NewReader(script.Input)
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		// Only the line ending is removed
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) != "" {
+			payload, parseErr := scriptMessage(line, script.NDJSON)
+			if parseErr != nil {
+				return fmt.Errorf("line %d of websocket input: %w", lineNum, parseErr)
+			}
+
+			if err := wc.sendMessage(wsutils.OpcodeText, payload); err != nil {
+				// e.g. timeout while sending
+				if errors.Is(err, wsutils.ErrCloseSent) {
+					return nil
+				}
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func scriptMessage(line string, ndjson bool) ([]byte, error) {
+	if !ndjson {
+		return []byte(line), nil
+	}
+
+	line = strings.TrimSpace(line)
+	if !json.Valid([]byte(line)) {
+		return nil, errors.New("not valid JSON")
+	}
+
+	var s string
+	if strings.HasPrefix(line, `"`) {
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			return nil, err
+		}
+		return []byte(s), nil
+	}
+
+	return []byte(line), nil
+}
@@ -0,0 +1,176 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/internal/wsutils"
+)
+
+func TestScriptMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		ndjson      bool
+		expected    string
+		expectedErr bool
+	}{
+		{name: "verbatim", line: ` {"a": 1} `, expected: ` {"a": 1} `},
+		{name: "ndjson_string", line: `"line\nbreak"`, ndjson: true, expected: "line\nbreak"},
+		{name: "ndjson_object", line: ` {"a": 1}`, ndjson: true, expected: `{"a": 1}`},
+		{name: "ndjson_number", line: `42`, ndjson: true, expected: `42`},
+		{name: "ndjson_invalid", line: `{"a":`, ndjson: true, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := scriptMessage(test.line, test.ndjson)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", test.line)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+/*
+Server side of the script tests: each text message is
+answered with reply (nothing if it returns ""), and
+closeAfter messages (if not 0) it starts the closing
+handshake itself.
+*/
+func serveScript(server net.Conn, reply func(string) string, closeAfter int) {
+	sfw := serverFrameWriter{w: server}
+	sfr := wsutils.NewFrameReader(bufio.NewReader(server), wsutils.DefaultMaxFrameSize)
+
+	for received := 0; ; {
+		frame, err := sfr.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		switch frame.Opcode {
+		case wsutils.OpcodeText:
+			received++
+			if r := reply(string(frame.Payload)); r != "" {
+				_ = sfw.WriteMessage(wsutils.OpcodeText, []byte(r))
+			}
+			if received == closeAfter {
+				_ = sfw.WriteFrame(wsutils.Frame{Fin: true, Opcode: wsutils.OpcodeClose, Payload: wsutils.EncodeClosePayload(wsutils.CloseNormal, "")})
+			}
+
+		case wsutils.OpcodeClose:
+			_ = sfw.WriteFrame(wsutils.Frame{Fin: true, Opcode: wsutils.OpcodeClose, Payload: frame.Payload})
+			return
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	echo := func(s string) string { return s }
+
+	tests := []struct {
+		name       string
+		script     WebSocketScript
+		reply      func(string) string
+		closeAfter int
+		check      func(error) bool
+	}{
+		{
+			name:   "count",
+			script: WebSocketScript{Input: strings.NewReader("a\n\nb\n"), Count: 2},
+			reply:  echo,
+			check:  func(err error) bool { return err == nil },
+		},
+		{
+			name:   "send_only",
+			script: WebSocketScript{Input: strings.NewReader("a\nb")},
+			reply:  echo,
+			check:  func(err error) bool { return err == nil },
+		},
+		{
+			name:   "match",
+			script: WebSocketScript{Input: strings.NewReader("a\nb\nc\n"), Match: regexp.MustCompile("^B$")},
+			reply:  strings.ToUpper,
+			check:  func(err error) bool { return err == nil },
+		},
+		{
+			name:   "expect_match",
+			script: WebSocketScript{Input: strings.NewReader("ok 1\nok 2\n"), Count: 2, Expect: regexp.MustCompile("^ok")},
+			reply:  echo,
+			check:  func(err error) bool { return err == nil },
+		},
+		{
+			name:   "expect_mismatch",
+			script: WebSocketScript{Input: strings.NewReader("ok\nfail\n"), Count: 2, Expect: regexp.MustCompile("^ok")},
+			reply:  echo,
+			check: func(err error) bool {
+				var expectErr apperrors.ExpectationError
+				return errors.As(err, &expectErr) && strings.Contains(expectErr.Reason, "message 2")
+			},
+		},
+		{
+			name:       "server_closed_first",
+			script:     WebSocketScript{Input: strings.NewReader("a\n"), Count: 3},
+			reply:      echo,
+			closeAfter: 1,
+			check: func(err error) bool {
+				var expectErr apperrors.ExpectationError
+				return errors.As(err, &expectErr) && strings.Contains(expectErr.Reason, "after 1 of 3")
+			},
+		},
+		{
+			name:   "timeout",
+			script: WebSocketScript{Input: strings.NewReader("a\n"), Count: 1, Timeout: 50 * time.Millisecond},
+			reply:  func(string) string { return "" },
+			check: func(err error) bool {
+				var timeoutErr apperrors.TimeoutError
+				return errors.As(err, &timeoutErr)
+			},
+		},
+		{
+			name:   "invalid_ndjson",
+			script: WebSocketScript{Input: strings.NewReader("\"a\"\n{bad\n"), NDJSON: true, Count: 5},
+			reply:  echo,
+			check:  func(err error) bool { return err != nil && strings.Contains(err.Error(), "line 2") },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+			go serveScript(server, test.reply, test.closeAfter)
+
+			wc := newTestWebSocketConn(client)
+			wc.opts.Script = &test.script
+			if test.script.waits() {
+				wc.waiter = newMessageWaiter(wc.opts.Script)
+			}
+
+			readDone := make(chan error, 1)
+			go func() { readDone <- wc.ReadMessages() }()
+
+			if err := wc.RunScript(context.Background(), readDone); !test.check(err) {
+				t.Fatalf("unexpected result: %v", err)
+			}
+		})
+	}
+}
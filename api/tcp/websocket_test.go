@@ -0,0 +1,334 @@
+package tcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/api/ws"
+	"github.com/saeidalz13/gurl/internal/wsutils"
+)
+
+// Client side of a session over conn, as returned
+// by OpenWebSocket after the handshake.
+func newTestWebSocketConn(conn net.Conn) *WebSocketConn {
+	fr := wsutils.NewFrameReader(bufio.NewReader(conn), wsutils.DefaultMaxFrameSize)
+	fr.RejectMaskedFrames()
+	return &WebSocketConn{
+		mr:    wsutils.NewMessageReader(fr, wsutils.DefaultMaxMessageSize, nil),
+		fw:    wsutils.NewFrameWriter(conn, wsutils.DefaultFragmentSize, nil),
+		pings: make(map[string]time.Time),
+	}
+}
+
+// Frames of the server side of the tests, which
+// unlike the ones of the client aren't masked.
+type serverFrameWriter struct {
+	w io.Writer
+}
+
+func (sfw serverFrameWriter) WriteFrame(f wsutils.Frame) error {
+	_, err := sfw.w.Write(wsutils.EncodeFrame(f, nil))
+	return err
+}
+
+func (sfw serverFrameWriter) WriteMessage(opcode byte, payload []byte) error {
+	return sfw.WriteFrame(wsutils.Frame{Fin: true, Opcode: opcode, Payload: payload})
+}
+
+func TestParseCloseArgs(t *testing.T) {
+	tests := []struct {
+		name           string
+		args           string
+		expectedCode   int
+		expectedReason string
+		expectedErr    bool
+	}{
+		{name: "default", args: "", expectedCode: wsutils.CloseNormal},
+		{name: "code", args: "1001", expectedCode: wsutils.CloseGoingAway},
+		{name: "code_and_reason", args: "4000 going  home ", expectedCode: 4000, expectedReason: "going  home"},
+		{name: "not_a_number", args: "bye", expectedErr: true},
+		{name: "reserved_code", args: "1005", expectedErr: true},
+		{name: "out_of_range", args: "5000", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, reason, err := parseCloseArgs(test.args)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", test.args)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != test.expectedCode || reason != test.expectedReason {
+				t.Fatalf("expected: %d %q\tgot: %d %q", test.expectedCode, test.expectedReason, code, reason)
+			}
+		})
+	}
+}
+
+/*
+The server pings, then starts the closing handshake.
+The client must answer with a pong, echo the close
+code and end with the matching error.
+*/
+func TestReadMessagesServerClose(t *testing.T) {
+	tests := []struct {
+		name         string
+		closePayload []byte
+		expectedErr  error
+		expectedCode int
+	}{
+		{name: "normal", closePayload: wsutils.EncodeClosePayload(wsutils.CloseNormal, "bye"), expectedCode: wsutils.CloseNormal},
+		{name: "no_status", closePayload: nil, expectedCode: wsutils.CloseNoStatus},
+		{
+			name:         "going_away",
+			closePayload: wsutils.EncodeClosePayload(wsutils.CloseGoingAway, "restart"),
+			expectedErr:  apperrors.WebSocketCloseError{Code: wsutils.CloseGoingAway, Reason: "restart"},
+			expectedCode: wsutils.CloseGoingAway,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			wc := newTestWebSocketConn(client)
+			readDone := make(chan error, 1)
+			go func() { readDone <- wc.ReadMessages() }()
+
+			sfw := serverFrameWriter{w: server}
+			sfr := wsutils.NewFrameReader(bufio.NewReader(server), wsutils.DefaultMaxFrameSize)
+
+			if err := sfw.WriteFrame(wsutils.Frame{Fin: true, Opcode: wsutils.OpcodePing, Payload: []byte("hb")}); err != nil {
+				t.Fatal(err)
+			}
+			pong, err := sfr.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pong.Opcode != wsutils.OpcodePong || string(pong.Payload) != "hb" {
+				t.Fatalf("expected: pong %q\tgot: 0x%x %q", "hb", pong.Opcode, pong.Payload)
+			}
+
+			if err := sfw.WriteFrame(wsutils.Frame{Fin: true, Opcode: wsutils.OpcodeClose, Payload: test.closePayload}); err != nil {
+				t.Fatal(err)
+			}
+			echo, err := sfr.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, _, err := wsutils.ParseClosePayload(echo.Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if echo.Opcode != wsutils.OpcodeClose || code != test.expectedCode {
+				t.Fatalf("expected: close %d\tgot: 0x%x %d", test.expectedCode, echo.Opcode, code)
+			}
+
+			if err := <-readDone; err != test.expectedErr {
+				t.Fatalf("expected: %v\tgot: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestReadMessagesWithoutCloseFrame(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	wc := newTestWebSocketConn(client)
+	readDone := make(chan error, 1)
+	go func() { readDone <- wc.ReadMessages() }()
+
+	server.Close()
+
+	var closeErr apperrors.WebSocketCloseError
+	if err := <-readDone; !errors.As(err, &closeErr) || closeErr.Code != wsutils.CloseAbnormal {
+		t.Fatalf("expected: close %d\tgot: %v", wsutils.CloseAbnormal, err)
+	}
+}
+
+func TestBinaryInput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "payload.bin")
+	if err := os.WriteFile(path, []byte{0x00, 0x01, 0xff}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		command     string
+		args        string
+		expected    []byte
+		expectedErr bool
+	}{
+		{name: "file", command: "binary", args: "@" + path, expected: []byte{0x00, 0x01, 0xff}},
+		{name: "file_without_at", command: "binary", args: path, expectedErr: true},
+		{name: "missing_file", command: "binary", args: "@" + filepath.Join(dir, "missing"), expectedErr: true},
+		{name: "hex", command: "hex", args: "00 01 ff", expected: []byte{0x00, 0x01, 0xff}},
+		{name: "base64", command: "base64", args: "AAH/", expected: []byte{0x00, 0x01, 0xff}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := binaryInput(test.command, test.args)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for /%s %s", test.command, test.args)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.expected) {
+				t.Fatalf("expected: %x\tgot: %x", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestReceivedBinarySaved(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "messages")
+	wc := &WebSocketConn{opts: WebSocketOptions{BinaryDir: dir}}
+
+	payloads := [][]byte{{0x01, 0x02}, {0xff}}
+	for _, payload := range payloads {
+		wc.receivedBinary(payload)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "ws-*.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(payloads) {
+		t.Fatalf("expected: %d files\tgot: %d", len(payloads), len(files))
+	}
+
+	for i, payload := range payloads {
+		got, err := os.ReadFile(files[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("expected: %x\tgot: %x", payload, got)
+		}
+	}
+}
+
+// Answers the handshake request, then serve has the
+// connection.
+func startTestWebSocketServer(t *testing.T, serve func(conn net.Conn)) *net.TCPAddr {
+	t.Helper()
+
+	return startTestH2CServer(t, func(conn net.Conn) {
+		header, err := readHTTP1Header(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+
+		var key string
+		for _, line := range strings.Split(string(header), "\r\n") {
+			if name, value, found := strings.Cut(line, ":"); found && strings.EqualFold(name, "Sec-WebSocket-Key") {
+				key = strings.TrimSpace(value)
+			}
+		}
+
+		io.WriteString(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: "+ws.AcceptKey(key)+"\r\n\r\n")
+		serve(conn)
+	})
+}
+
+func TestOpenWebSocketTimeouts(t *testing.T) {
+	// Never answers the handshake
+	addr := startTestH2CServer(t, func(conn net.Conn) {
+		if _, err := readHTTP1Header(bufio.NewReader(conn)); err != nil {
+			return
+		}
+		time.Sleep(time.Second)
+	})
+
+	tcm := connectTestServer(t, addr)
+	defer tcm.Close()
+	tcm.SetTimeouts(Timeouts{FirstByte: 50 * time.Millisecond, IdleRead: time.Second})
+
+	secWsKey, err := ws.GenerateSecWebSocketKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := ws.GenerateWebSocketRequest(addr.String(), "/", secWsKey, nil)
+
+	_, err = tcm.OpenWebSocket(request, secWsKey, false, WebSocketOptions{})
+	var timeoutErr apperrors.TimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Phase != "first byte" {
+		t.Fatalf("expected first byte timeout\tgot: %v", err)
+	}
+}
+
+func TestWebSocketSessionFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame wsutils.Frame
+		// The server stays quiet longer than the idle
+		// timeout of the handshake first.
+		delay       time.Duration
+		masked      bool
+		expectedErr bool
+	}{
+		{name: "idle_session", frame: wsutils.Frame{Fin: true, Opcode: wsutils.OpcodeClose}, delay: 200 * time.Millisecond},
+		{name: "masked", frame: wsutils.Frame{Fin: true, Opcode: wsutils.OpcodeText, Payload: []byte("hi")}, masked: true, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			addr := startTestWebSocketServer(t, func(conn net.Conn) {
+				time.Sleep(test.delay)
+
+				var maskKey *[4]byte
+				if test.masked {
+					maskKey = &[4]byte{1, 2, 3, 4}
+				}
+				conn.Write(wsutils.EncodeFrame(test.frame, maskKey))
+				io.Copy(io.Discard, conn)
+			})
+
+			tcm := connectTestServer(t, addr)
+			defer tcm.Close()
+			tcm.SetTimeouts(Timeouts{FirstByte: time.Second, IdleRead: 50 * time.Millisecond})
+
+			secWsKey, err := ws.GenerateSecWebSocketKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := ws.GenerateWebSocketRequest(addr.String(), "/", secWsKey, nil)
+
+			wc, err := tcm.OpenWebSocket(request, secWsKey, false, WebSocketOptions{DisableCompression: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = wc.ReadMessages()
+			var protocolErr apperrors.ProtocolError
+			if test.expectedErr != errors.As(err, &protocolErr) {
+				t.Fatalf("expected: protocol error %v\tgot: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/gurl"
+	"github.com/saeidalz13/gurl/api/apperrors"
+)
+
+// Times are in seconds with microseconds,
+// the same as cURL.
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.6f", d.Seconds())
+}
+
+// Variables of -w; names are the same as cURL
+var writeOutVariables = map[string]func(resp *gurl.Response) string{
+	"time_namelookup":    func(resp *gurl.Response) string { return seconds(resp.Timing.DNSLookup) },
+	"time_connect":       func(resp *gurl.Response) string { return seconds(resp.Timing.Connect) },
+	"time_appconnect":    func(resp *gurl.Response) string { return seconds(resp.Timing.TLSHandshake) },
+	"time_pretransfer":   func(resp *gurl.Response) string { return seconds(resp.Timing.RequestSent) },
+	"time_starttransfer": func(resp *gurl.Response) string { return seconds(resp.Timing.FirstByte) },
+	"time_total":         func(resp *gurl.Response) string { return seconds(resp.Timing.Total) },
+	"http_code":          func(resp *gurl.Response) string { return resp.StatusCode },
+	"http_version":       func(resp *gurl.Response) string { return strings.TrimPrefix(resp.Proto, "HTTP/") },
+	"size_download":      func(resp *gurl.Response) string { return strconv.FormatInt(resp.BodySize, 10) },
+	"size_header":        func(resp *gurl.Response) string { return strconv.Itoa(resp.HeaderSize()) },
+	"remote_ip":          func(resp *gurl.Response) string { return resp.RemoteIP },
+	"remote_port":        func(resp *gurl.Response) string { return strconv.Itoa(resp.RemotePort) },
+	"num_redirects":      func(resp *gurl.Response) string { return strconv.Itoa(resp.Redirects) },
+	"url_effective":      func(resp *gurl.Response) string { return resp.URL },
+}
+
+var writeOutEscapes = map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\'}
+
+/*
+Replaces %{variable} in the format with its value from
+the response, e.g. "%{http_code} %{time_total}\n".
+"%%" is a literal '%', and "\n", "\t" and "\r" are
+unescaped since shells pass them as they are.
+*/
+func formatWriteOut(format string, resp *gurl.Response) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+
+		switch {
+		case c == '%' && strings.HasPrefix(format[i:], "%%"):
+			sb.WriteByte('%')
+			i++
+
+		case c == '%' && strings.HasPrefix(format[i:], "%{"):
+			end := strings.IndexByte(format[i:], '}')
+			if end == -1 {
+				return "", apperrors.UsageError{Reason: "-w variable is missing '}'"}
+			}
+
+			name := format[i+2 : i+end]
+			value, ok := writeOutVariables[name]
+			if !ok {
+				return "", apperrors.UsageError{Reason: fmt.Sprintf("unknown -w variable: %s", name)}
+			}
+			sb.WriteString(value(resp))
+			i += end
+
+		case c == '\\' && i+1 < len(format) && writeOutEscapes[format[i+1]] != 0:
+			sb.WriteByte(writeOutEscapes[format[i+1]])
+			i++
+
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), nil
+}
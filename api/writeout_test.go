@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl"
+)
+
+func TestFormatWriteOut(t *testing.T) {
+	resp := &gurl.Response{
+		Proto:      "HTTP/2",
+		StatusCode: "200",
+		Header:     []string{"Content-Type: text/plain"},
+		Body:       "hello",
+		BodySize:   5,
+		URL:        "https://example.com/",
+		Redirects:  1,
+		RemoteIP:   "93.184.216.34",
+		RemotePort: 443,
+		Timing:     gurl.Timing{Connect: 20 * time.Millisecond, Total: 1500 * time.Millisecond},
+	}
+
+	tests := []struct {
+		name        string
+		format      string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "status", format: "%{http_code} %{http_version}", expected: "200 2"},
+		{name: "times", format: "%{time_connect} %{time_total}", expected: "0.020000 1.500000"},
+		{name: "sizes", format: "%{size_download} %{size_header}", expected: "5 40"},
+		{name: "remote", format: "%{remote_ip}:%{remote_port}", expected: "93.184.216.34:443"},
+		{name: "redirects", format: "%{num_redirects} %{url_effective}", expected: "1 https://example.com/"},
+		{name: "escapes", format: `100%% done\n\t`, expected: "100% done\n\t"},
+		{name: "plain_percent", format: "50%", expected: "50%"},
+		{name: "unknown_variable", format: "%{nope}", expectedErr: true},
+		{name: "unclosed_variable", format: "%{http_code", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out, err := formatWriteOut(test.format, resp)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error\tgot: %q", out)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, out)
+			}
+		})
+	}
+}
+
+// -w with -o: the body goes to the file
+// but size_download still counts it.
+func TestFormatWriteOutDownload(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Read(make([]byte, 1024))
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello")
+	}()
+
+	url := "http://" + ln.Addr().String() + "/out.bin"
+	d, err := newDownload(filepath.Join(t.TempDir(), "out.bin"), false, url, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := gurl.NewRequest(context.Background(), "get", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.BodyWriter = d.bodyWriter(url)
+
+	resp, err := (&gurl.Client{}).Do(req)
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := formatWriteOut("%{size_download}", resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Body != "" || out != "5" {
+		t.Fatalf("expected: empty body and 5\tgot: %q and %q", resp.Body, out)
+	}
+}
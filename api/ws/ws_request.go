@@ -29,7 +29,12 @@ func GenerateSecWebSocketKey() (string, error) {
 	return base64.StdEncoding.EncodeToString(key[:n]), nil
 }
 
-func GenerateWebSocketRequest(domain, path, secWsKey string) string {
+/*
+Upgrade request of the handshake. headers (in format
+of "Name: value") come after the ones of the handshake,
+e.g. Origin, Cookie or Sec-WebSocket-Protocol.
+*/
+func GenerateWebSocketRequest(domain, path, secWsKey string, headers []string) string {
 	sb := strings.Builder{}
 	sb.Grow(50)
 
@@ -61,6 +66,11 @@ func GenerateWebSocketRequest(domain, path, secWsKey string) string {
 
 	sb.WriteString("Sec-WebSocket-Version: 13\r\n")
 
+	for _, header := range headers {
+		sb.WriteString(header)
+		sb.WriteString("\r\n")
+	}
+
 	// Ending of request based on HTTP
 	sb.WriteString("\r\n")
 
@@ -6,7 +6,7 @@ import (
 	"testing"
 )
 
-func createExpectedRequest(key string) string {
+func createExpectedRequest(key string, headers []string) string {
 	sb := strings.Builder{}
 	sb.Grow(50)
 
@@ -14,7 +14,11 @@ func createExpectedRequest(key string) string {
 	sb.WriteString("Host: echo.websocket.org\r\nUser-Agent: gurl/1.2.0\r\nConnection: Upgrade\r\n")
 	sb.WriteString("Upgrade: websocket\r\n")
 	sb.WriteString(fmt.Sprintf("Sec-Websocket-Key: %s\r\n", key))
-	sb.WriteString("Sec-WebSocket-Version: 13\r\n\r\n")
+	sb.WriteString("Sec-WebSocket-Version: 13\r\n")
+	for _, header := range headers {
+		sb.WriteString(header + "\r\n")
+	}
+	sb.WriteString("\r\n")
 
 	return sb.String()
 }
@@ -25,13 +29,13 @@ func TestCreateWsRequest(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expectedRequest := createExpectedRequest(key)
+	for _, headers := range [][]string{nil, {"Sec-WebSocket-Extensions: permessage-deflate", "Origin: https://example.com"}} {
+		expectedRequest := createExpectedRequest(key, headers)
 
-	gotRequest := GenerateWebSocketRequest("echo.websocket.org", "/", key)
+		gotRequest := GenerateWebSocketRequest("echo.websocket.org", "/", key, headers)
 
-	if expectedRequest != gotRequest {
-		t.Fatal("expected request did not match got request")
-		fmt.Printf("Expected:\n----\n%s\n\n", expectedRequest)
-		fmt.Printf("Got:\n----\n%s\n", gotRequest)
+		if expectedRequest != gotRequest {
+			t.Fatalf("expected request did not match got request\nExpected:\n----\n%s\nGot:\n----\n%s", expectedRequest, gotRequest)
+		}
 	}
 }
@@ -0,0 +1,158 @@
+package ws
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Appended to the key of the client before hashing
+// it for Sec-WebSocket-Accept (RFC 6455 section 4.2.2).
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Each failure of the handshake has its own error so
+// the caller can tell them apart with errors.Is.
+var (
+	ErrInvalidStatusLine  = errors.New("invalid status line")
+	ErrNotSwitching       = errors.New("server did not switch to WebSocket")
+	ErrInvalidUpgrade     = errors.New("invalid Upgrade header")
+	ErrInvalidConnection  = errors.New("invalid Connection header")
+	ErrInvalidAccept      = errors.New("invalid Sec-WebSocket-Accept header")
+	ErrInvalidSubprotocol = errors.New("invalid Sec-WebSocket-Protocol header")
+)
+
+/*
+Response of the server to the upgrade request. Only
+the status line and headers are read; a 101 response
+has no body.
+*/
+type HandshakeResponse struct {
+	StatusCode int
+	Reason     string
+
+	// Lines in format of "Name: value"
+	Header []string
+}
+
+// Value of Sec-WebSocket-Accept for the key
+func AcceptKey(secWsKey string) string {
+	hashed := sha1.Sum([]byte(secWsKey + acceptGUID))
+	return base64.StdEncoding.EncodeToString(hashed[:])
+}
+
+/*
+Parses the status line and headers, e.g.
+
+	HTTP/1.1 101 Switching Protocols
+	Upgrade: websocket
+
+Header values may have ':' (e.g. URLs), so only the
+first one separates the name from the value.
+*/
+func ParseHandshakeResponse(header []byte) (HandshakeResponse, error) {
+	lines := strings.Split(strings.TrimRight(string(header), "\r\n"), "\r\n")
+
+	version, status, _ := strings.Cut(lines[0], " ")
+	codeStr, reason, _ := strings.Cut(status, " ")
+	code, err := strconv.Atoi(codeStr)
+	if !strings.HasPrefix(version, "HTTP/1.") || err != nil || len(codeStr) != 3 {
+		return HandshakeResponse{}, fmt.Errorf("%w: %q", ErrInvalidStatusLine, lines[0])
+	}
+
+	resp := HandshakeResponse{StatusCode: code, Reason: reason, Header: make([]string, 0, len(lines)-1)}
+	for _, line := range lines[1:] {
+		name, value, found := strings.Cut(line, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			return HandshakeResponse{}, fmt.Errorf("%w: malformed header line %q", ErrInvalidStatusLine, line)
+		}
+		resp.Header = append(resp.Header, strings.TrimSpace(name)+": "+strings.TrimSpace(value))
+	}
+
+	return resp, nil
+}
+
+// Values of the header; names are case-insensitive
+func (r HandshakeResponse) Values(name string) []string {
+	var values []string
+	for _, line := range r.Header {
+		key, value, _ := strings.Cut(line, ": ")
+		if strings.EqualFold(key, name) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Values joined with ", " if the header was sent
+// more than once, which means the same in HTTP.
+func (r HandshakeResponse) Value(name string) string {
+	return strings.Join(r.Values(name), ", ")
+}
+
+// e.g. "Upgrade" in "keep-alive, Upgrade"
+func hasToken(value, token string) bool {
+	for _, t := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+Checks the response as RFC 6455 section 4.1 requires:
+101 status, Upgrade: websocket, Connection: Upgrade and
+the accept value of the key. The subprotocol chosen by
+the server (empty if none) must be one of subprotocols.
+*/
+func ValidateHandshake(resp HandshakeResponse, secWsKey string, subprotocols []string) (string, error) {
+	if resp.StatusCode != 101 {
+		err := fmt.Errorf("%w: %d %s", ErrNotSwitching, resp.StatusCode, resp.Reason)
+		if location := resp.Value("Location"); location != "" {
+			err = fmt.Errorf("%w (redirected to %s)", err, location)
+		}
+		return "", err
+	}
+
+	if upgrade := resp.Value("Upgrade"); !strings.EqualFold(strings.TrimSpace(upgrade), "websocket") {
+		return "", fmt.Errorf("%w: expected websocket, got %q", ErrInvalidUpgrade, upgrade)
+	}
+
+	if connection := resp.Value("Connection"); !hasToken(connection, "Upgrade") {
+		return "", fmt.Errorf("%w: expected Upgrade, got %q", ErrInvalidConnection, connection)
+	}
+
+	switch accept := resp.Value("Sec-WebSocket-Accept"); accept {
+	case "":
+		return "", fmt.Errorf("%w: missing", ErrInvalidAccept)
+	case AcceptKey(secWsKey):
+	default:
+		return "", fmt.Errorf("%w: %q does not match the key (expected %q)", ErrInvalidAccept, accept, AcceptKey(secWsKey))
+	}
+
+	return selectedSubprotocol(resp, subprotocols)
+}
+
+func selectedSubprotocol(resp HandshakeResponse, subprotocols []string) (string, error) {
+	values := resp.Values("Sec-WebSocket-Protocol")
+	switch {
+	case len(values) == 0:
+		return "", nil
+	case len(values) > 1 || strings.Contains(values[0], ","):
+		return "", fmt.Errorf("%w: server must select one subprotocol, got %q", ErrInvalidSubprotocol, resp.Value("Sec-WebSocket-Protocol"))
+	}
+
+	for _, subprotocol := range subprotocols {
+		if subprotocol == values[0] {
+			return subprotocol, nil
+		}
+	}
+
+	if len(subprotocols) == 0 {
+		return "", fmt.Errorf("%w: server selected %q but none was requested", ErrInvalidSubprotocol, values[0])
+	}
+	return "", fmt.Errorf("%w: server selected %q, requested %s", ErrInvalidSubprotocol, values[0], strings.Join(subprotocols, ", "))
+}
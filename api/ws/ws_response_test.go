@@ -0,0 +1,135 @@
+package ws
+
+import (
+	"errors"
+	"testing"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+// Example of RFC 6455 section 1.3
+func TestAcceptKey(t *testing.T) {
+	expected := "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="
+	if got := AcceptKey(testKey); got != expected {
+		t.Fatalf("expected: %s\tgot: %s", expected, got)
+	}
+}
+
+func TestParseHandshakeResponse(t *testing.T) {
+	header := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"upgrade: websocket\r\n" +
+		"Connection:Upgrade\r\n" +
+		"Set-Cookie: a=1\r\n" +
+		"Set-Cookie: b=2\r\n" +
+		"Link: <http://example.com/>\r\n\r\n"
+
+	resp, err := ParseHandshakeResponse([]byte(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 101 || resp.Reason != "Switching Protocols" {
+		t.Fatalf("expected: 101 Switching Protocols\tgot: %d %s", resp.StatusCode, resp.Reason)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{name: "Upgrade", expected: "websocket"},
+		{name: "connection", expected: "Upgrade"},
+		{name: "Set-Cookie", expected: "a=1, b=2"},
+		// Only the first ':' separates the name
+		{name: "Link", expected: "<http://example.com/>"},
+		{name: "Missing", expected: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := resp.Value(test.name); got != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"HTTP/1.1 1O1 Switching\r\n\r\n", "SSH-2.0-OpenSSH\r\n\r\n", "HTTP/1.1 101 OK\r\nno colon\r\n\r\n"} {
+		if _, err := ParseHandshakeResponse([]byte(invalid)); !errors.Is(err, ErrInvalidStatusLine) {
+			t.Fatalf("expected: %v\tgot: %v", ErrInvalidStatusLine, err)
+		}
+	}
+}
+
+func TestValidateHandshake(t *testing.T) {
+	validHeader := []string{
+		"Upgrade: WebSocket",
+		"Connection: keep-alive, Upgrade",
+		"Sec-WebSocket-Accept: " + AcceptKey(testKey),
+	}
+
+	tests := []struct {
+		name                string
+		statusCode          int
+		header              []string
+		subprotocols        []string
+		expectedSubprotocol string
+		expectedErr         error
+	}{
+		{name: "valid", statusCode: 101, header: validHeader},
+		{
+			name:                "subprotocol",
+			statusCode:          101,
+			header:              append([]string{"Sec-WebSocket-Protocol: chat"}, validHeader...),
+			subprotocols:        []string{"superchat", "chat"},
+			expectedSubprotocol: "chat",
+		},
+		{name: "no_subprotocol_selected", statusCode: 101, header: validHeader, subprotocols: []string{"chat"}},
+		{name: "not_switching", statusCode: 403, header: validHeader, expectedErr: ErrNotSwitching},
+		{name: "redirect", statusCode: 301, header: []string{"Location: wss://example.com/"}, expectedErr: ErrNotSwitching},
+		{name: "missing_upgrade", statusCode: 101, header: validHeader[1:], expectedErr: ErrInvalidUpgrade},
+		{name: "wrong_upgrade", statusCode: 101, header: []string{"Upgrade: h2c", validHeader[1], validHeader[2]}, expectedErr: ErrInvalidUpgrade},
+		{name: "missing_connection", statusCode: 101, header: []string{validHeader[0], validHeader[2]}, expectedErr: ErrInvalidConnection},
+		{name: "missing_accept", statusCode: 101, header: validHeader[:2], expectedErr: ErrInvalidAccept},
+		{name: "wrong_accept", statusCode: 101, header: []string{validHeader[0], validHeader[1], "Sec-WebSocket-Accept: " + AcceptKey("other")}, expectedErr: ErrInvalidAccept},
+		{
+			name:         "subprotocol_not_requested",
+			statusCode:   101,
+			header:       append([]string{"Sec-WebSocket-Protocol: chat"}, validHeader...),
+			subprotocols: []string{"superchat"},
+			expectedErr:  ErrInvalidSubprotocol,
+		},
+		{
+			name:        "subprotocol_without_request",
+			statusCode:  101,
+			header:      append([]string{"Sec-WebSocket-Protocol: chat"}, validHeader...),
+			expectedErr: ErrInvalidSubprotocol,
+		},
+		{
+			name:         "several_subprotocols",
+			statusCode:   101,
+			header:       append([]string{"Sec-WebSocket-Protocol: chat, superchat"}, validHeader...),
+			subprotocols: []string{"superchat", "chat"},
+			expectedErr:  ErrInvalidSubprotocol,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := HandshakeResponse{StatusCode: test.statusCode, Header: test.header}
+
+			subprotocol, err := ValidateHandshake(resp, testKey, test.subprotocols)
+			if test.expectedErr != nil {
+				if !errors.Is(err, test.expectedErr) {
+					t.Fatalf("expected: %v\tgot: %v", test.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subprotocol != test.expectedSubprotocol {
+				t.Fatalf("expected: %q\tgot: %q", test.expectedSubprotocol, subprotocol)
+			}
+		})
+	}
+}
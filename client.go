@@ -0,0 +1,447 @@
+/*
+Package gurl is the client behind the gURL command line
+tool. It sends HTTP/1.1 and HTTP/2 requests over its own
+DNS resolver, TCP and TLS connections:
+
+	client := gurl.NewClient()
+	req, err := gurl.NewRequest(ctx, "GET", "https://example.com/")
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+
+Errors are of the types in api/apperrors so the cause
+(e.g. DNS, connect, TLS or timeout) can be checked with
+errors.As.
+*/
+package gurl
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/api/conninfo"
+	"github.com/saeidalz13/gurl/api/dns"
+	"github.com/saeidalz13/gurl/api/http"
+	"github.com/saeidalz13/gurl/api/proxy"
+	"github.com/saeidalz13/gurl/api/tcp"
+	"github.com/saeidalz13/gurl/internal/domainparser"
+	"github.com/saeidalz13/gurl/internal/httpconstants"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+	"github.com/saeidalz13/gurl/models"
+)
+
+// HTTPVersionNegotiate lets the server pick with
+// ALPN (h2 preferred, falling back to HTTP/1.1).
+//
+// Without TLS, HTTPVersion2 upgrades from HTTP/1.1
+// (Upgrade: h2c) while HTTPVersion2PriorKnowledge
+// starts with HTTP/2 right away.
+const (
+	HTTPVersionNegotiate       = httpconstants.HTTPVersionNegotiate
+	HTTPVersion1_1             = httpconstants.HTTPVersion1_1
+	HTTPVersion2               = httpconstants.HTTPVersion2
+	HTTPVersion2PriorKnowledge = httpconstants.HTTPVersion2PriorKnowledge
+)
+
+/*
+Each phase of a request has its own timeout:
+
+  - Connect: TCP connection (and proxy handshake)
+  - TLSHandshake: TLS handshake after connecting
+  - FirstByte: waiting for the first byte of the response
+  - IdleRead: waiting between two reads (and for writes)
+
+Total limits the whole Do call, including redirects
+and retries. Zero means no limit.
+*/
+type Timeouts struct {
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	FirstByte    time.Duration
+	IdleRead     time.Duration
+	Total        time.Duration
+}
+
+// Same defaults as the command line
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Connect:      10 * time.Second,
+		TLSHandshake: 10 * time.Second,
+		FirstByte:    30 * time.Second,
+		IdleRead:     30 * time.Second,
+	}
+}
+
+// The deadline of the operation starts now
+func (t Timeouts) start() tcp.Timeouts {
+	timeouts := tcp.Timeouts{
+		Connect:      t.Connect,
+		TLSHandshake: t.TLSHandshake,
+		FirstByte:    t.FirstByte,
+		IdleRead:     t.IdleRead,
+		Total:        t.Total,
+	}
+	if t.Total > 0 {
+		timeouts.Deadline = time.Now().Add(t.Total)
+	}
+	return timeouts
+}
+
+/*
+Client sends requests with its settings. All fields
+are optional; the zero value is a client without
+timeouts, proxy, cookies or retries.
+
+  - Resolver: nil uses DNSResolver without cache
+  - TLSConfig: copied for each connection with the
+    server name and ALPN set. Without RootCAs, the
+    system and the bundled CA certificates are used.
+  - Proxy: nil means direct connections
+  - Jar: nil means cookies are not stored
+  - Verbose: prints the exchanged requests, responses
+    and connection details to stdout
+*/
+type Client struct {
+	Resolver        Resolver
+	TLSConfig       *tls.Config
+	Timeouts        Timeouts
+	Proxy           ProxyFunc
+	Jar             *http.CookieJar
+	Retry           http.RetryPolicy
+	FollowRedirects bool
+	HTTPVersion     uint8
+	Verbose         bool
+}
+
+// Client with the default timeouts and the
+// proxy from the environment variables.
+func NewClient() *Client {
+	return &Client{
+		Timeouts: DefaultTimeouts(),
+		Proxy:    ProxyFromEnvironment,
+	}
+}
+
+func (c *Client) resolver() Resolver {
+	if c.Resolver == nil {
+		return DNSResolver{}
+	}
+	return c.Resolver
+}
+
+// WebSocket handshake is an HTTP/1.1 upgrade, so
+// h2 is only offered for HTTP requests.
+func determineALPNProtocols(protocol, httpVersion uint8) []string {
+	if domainparser.IsWebSocket(protocol) {
+		return []string{httpconstants.ALPNHTTP1_1}
+	}
+
+	switch httpVersion {
+	case httpconstants.HTTPVersion1_1:
+		return []string{httpconstants.ALPNHTTP1_1}
+	case httpconstants.HTTPVersion2, httpconstants.HTTPVersion2PriorKnowledge:
+		return []string{httpconstants.ALPNHTTP2}
+	default:
+		return []string{httpconstants.ALPNHTTP2, httpconstants.ALPNHTTP1_1}
+	}
+}
+
+/*
+A CONNECT tunnel is needed unless the request is plain
+HTTP/1.1, which an HTTP proxy can forward by itself.
+TLS, WebSocket and h2c need the raw TCP connection.
+*/
+func needsProxyTunnel(protocol uint8, isTls bool, httpVersion uint8) bool {
+	if isTls || domainparser.IsWebSocket(protocol) {
+		return true
+	}
+	return httpVersion == httpconstants.HTTPVersion2 || httpVersion == httpconstants.HTTPVersion2PriorKnowledge
+}
+
+func requestScheme(connInfo models.ConnInfo) string {
+	if connInfo.IsTls {
+		return "https"
+	}
+	return "http"
+}
+
+// Counts the bytes of a body streamed
+// to the writer of Request.BodyWriter.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+/*
+Sink of the request that remembers the writer of the
+last response, so the size of a streamed body is known.
+Nil without BodyWriter.
+*/
+func countingBodySink(bodyWriter BodyWriterFunc, last **countingWriter) tcp.BodySink {
+	if bodyWriter == nil {
+		return nil
+	}
+
+	return func(statusCode string, headers []string) (io.Writer, error) {
+		*last = nil
+		w, err := bodyWriter(statusCode, headers)
+		if w == nil || err != nil {
+			return w, err
+		}
+
+		*last = &countingWriter{w: w}
+		return *last, nil
+	}
+}
+
+// Shown in verbose mode. Behind a proxy the
+// IP is not known since the proxy resolves it.
+func serverIP(connInfo models.ConnInfo) string {
+	if connInfo.IP == nil {
+		return "resolved by proxy"
+	}
+	return connInfo.IP.String()
+}
+
+// Resolves the IP of the domain (unless a proxy does it)
+// and prepares the connection manager without dialing.
+// The timing of the connection starts with the lookup.
+func (c *Client) prepareConn(ctx context.Context, dp domainparser.DomainParser, timeouts tcp.Timeouts) (models.ConnInfo, tcp.TCPConnManager, *proxy.Proxy, error) {
+	trace := tcp.NewTrace()
+
+	connInfo, err := conninfo.NewConnInfoResolver("", dp.Domain, dp.DomainSegment, dp.Protocol).ResolveWithoutIP()
+	if err != nil {
+		return models.ConnInfo{}, tcp.TCPConnManager{}, nil, err
+	}
+
+	var p *proxy.Proxy
+	if c.Proxy != nil {
+		p, err = c.Proxy(domainparser.Host(dp.Domain), connInfo.Port, connInfo.IsTls)
+		if err != nil {
+			return models.ConnInfo{}, tcp.TCPConnManager{}, nil, apperrors.UsageError{Reason: err.Error()}
+		}
+	}
+
+	if p == nil {
+		ip, err := c.resolver().LookupIP(ctx, domainparser.Host(dp.Domain))
+		if err != nil {
+			return models.ConnInfo{}, tcp.TCPConnManager{}, nil, err
+		}
+
+		connInfo.IP = ip
+		connInfo.IPType = dns.IpTypeV6
+		if ip.To4() != nil {
+			connInfo.IPType = dns.IpTypeV4
+		}
+		trace.MarkDNSLookup()
+	}
+
+	tcm := tcp.NewTCPConnManager(
+		connInfo,
+		dp.Domain,
+		c.TLSConfig,
+		determineALPNProtocols(dp.Protocol, c.HTTPVersion),
+	)
+	tcm.SetTimeouts(timeouts)
+	tcm.SetTrace(trace)
+
+	if p != nil {
+		tunnel := p.Protocol == proxy.ProtocolSOCKS5 || needsProxyTunnel(dp.Protocol, connInfo.IsTls, c.HTTPVersion)
+		tcm.SetProxy(p, tunnel)
+
+		if c.Verbose {
+			terminalutils.PrintProxyInfo(p.String(), tunnel)
+		}
+	}
+
+	return connInfo, tcm, p, nil
+}
+
+/*
+Sends the request and returns the final response:
+after the Digest challenge (if any), retries of the
+retry policy and redirects (with FollowRedirects).
+
+Cancelling the context of the request stops DNS
+resolution, dialing and reading, and its error
+(e.g. context.Canceled) is returned.
+*/
+func (c *Client) Do(req Request) (*Response, error) {
+	ctx := req.Context()
+
+	resp, err := c.do(ctx, req)
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	return resp, err
+}
+
+func (c *Client) do(ctx context.Context, req Request) (*Response, error) {
+	method, dp, err := req.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if domainparser.IsWebSocket(dp.Protocol) {
+		return nil, apperrors.URLError{URL: req.URL, Reason: "use WebSocketSession for ws:// and wss://"}
+	}
+
+	start := time.Now()
+	timeouts := c.Timeouts.start()
+
+	connInfo, tcm, p, err := c.prepareConn(ctx, dp, timeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	ex := httpExchange{
+		ctx:      ctx,
+		tcm:      tcm,
+		connInfo: connInfo,
+		reqGenerator: http.NewHTTPRequestGenerator(
+			dp.Domain,
+			dp.Path,
+			req.Cookies,
+			method,
+			req.Body,
+			req.DataType,
+		),
+		method:      method,
+		httpVersion: c.HTTPVersion,
+		verbose:     c.Verbose,
+	}
+
+	for _, header := range req.Header {
+		ex.reqGenerator.AddHeader(header)
+	}
+	var streamed *countingWriter
+	ex.tcm.SetBodySink(countingBodySink(req.BodyWriter, &streamed))
+
+	switch req.authScheme {
+	case httpconstants.AuthSchemeBasic:
+		ex.reqGenerator.SetAuthorization(http.BasicAuthorization(req.user, req.password))
+	case httpconstants.AuthSchemeBearer:
+		ex.reqGenerator.SetAuthorization(http.BearerAuthorization(req.bearerToken))
+	case httpconstants.AuthSchemeDigest:
+		ex.digestAuth = http.NewDigestAuth(req.user, req.password)
+	}
+
+	var resp http.HTTPResponseParser
+	redirects := 0
+	for ; ; redirects++ {
+		if c.Jar != nil {
+			ex.reqGenerator.SetCookies(joinCookies(req.Cookies, c.Jar.CookieHeader(dp.Domain, dp.Path, ex.connInfo.IsTls)))
+		}
+
+		if p != nil && p.Protocol == proxy.ProtocolHTTP && !needsProxyTunnel(dp.Protocol, ex.connInfo.IsTls, c.HTTPVersion) {
+			ex.reqGenerator.UseAbsoluteForm(requestScheme(ex.connInfo), p.Authorization())
+		} else {
+			ex.reqGenerator.UseAbsoluteForm("", "")
+		}
+
+		resp, err = ex.sendWithRetry(c.Retry, timeouts.Deadline)
+		if err != nil {
+			return nil, err
+		}
+		ex.tcm.Trace().MarkDone()
+
+		if c.Jar != nil {
+			storeResponseCookies(c.Jar, resp.HeaderValues("Set-Cookie"), dp.Domain, dp.Path, ex.connInfo.IsTls, c.Verbose)
+		}
+
+		locations := resp.HeaderValues("Location")
+		if !c.FollowRedirects || !http.IsRedirectStatus(resp.StatusCode()) || len(locations) == 0 {
+			break
+		}
+
+		if redirects == http.MaxRedirects {
+			return nil, apperrors.TooManyRedirectsError{Max: http.MaxRedirects}
+		}
+
+		if c.Verbose {
+			resp.Print(c.Verbose, false)
+		}
+
+		redirectDp := domainparser.NewDomainParser(http.RedirectTarget(locations[0], requestScheme(ex.connInfo), dp.Domain, dp.Path))
+		if err := redirectDp.Parse(); err != nil {
+			return nil, err
+		}
+
+		keepMethod := http.RedirectKeepsMethod(resp.StatusCode(), ex.method)
+		if !keepMethod {
+			ex.method = httpconstants.MethodGET
+		}
+		ex.reqGenerator.Redirect(redirectDp.Domain, redirectDp.Path, keepMethod)
+
+		previousScheme := requestScheme(ex.connInfo)
+		hostChanged := redirectDp.Domain != dp.Domain
+		dp = redirectDp
+		ex.connInfo, ex.tcm, p, err = c.prepareConn(ctx, dp, timeouts)
+		if err != nil {
+			return nil, err
+		}
+
+		// Credentials are not sent to other hosts or over
+		// another scheme (e.g. https downgraded to http)
+		if hostChanged || requestScheme(ex.connInfo) != previousScheme {
+			ex.reqGenerator.SetAuthorization("")
+			ex.reqGenerator.DropCredentialHeaders()
+			ex.digestAuth = nil
+		}
+		ex.tcm.SetBodySink(countingBodySink(req.BodyWriter, &streamed))
+	}
+
+	response := newResponse(resp)
+	response.URL = requestScheme(ex.connInfo) + "://" + dp.Domain + dp.Path
+	response.Redirects = redirects
+	if streamed != nil {
+		response.BodySize = streamed.n
+	}
+	response.RemotePort = ex.connInfo.Port
+	if ex.connInfo.IP != nil {
+		response.RemoteIP = ex.connInfo.IP.String()
+	}
+	response.Timing = newTiming(ex.tcm.Trace(), time.Since(start))
+	response.TLS = ex.tlsState
+	response.Request = sentRequest(ex.reqGenerator, response.Proto, requestScheme(ex.connInfo))
+
+	return response, nil
+}
+
+// Cookies of the request are sent along
+// with the ones from the jar.
+func joinCookies(cookies ...string) string {
+	nonEmpty := make([]string, 0, len(cookies))
+	for _, c := range cookies {
+		if c != "" {
+			nonEmpty = append(nonEmpty, c)
+		}
+	}
+	return strings.Join(nonEmpty, "; ")
+}
+
+// Also used for the Set-Cookie headers of the
+// WebSocket handshake.
+func storeResponseCookies(jar *http.CookieJar, setCookieValues []string, domain, path string, isSecure, verbose bool) {
+	errs := jar.SetCookies(domain, path, isSecure, setCookieValues)
+
+	if verbose {
+		for _, err := range errs {
+			terminalutils.PrintAppWarning(fmt.Sprintf("rejected cookie: %v", err))
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package gurl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/proxy"
+)
+
+// Accepts one connection, passes the request line
+// to serve and closes the connection after it.
+func startTestServer(t *testing.T, serve func(conn net.Conn, requestLine string)) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		requestLine, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return
+		}
+		serve(conn, strings.TrimSpace(requestLine))
+	}()
+
+	return ln.Addr().String()
+}
+
+func TestClientDo(t *testing.T) {
+	addr := startTestServer(t, func(conn net.Conn, requestLine string) {
+		if requestLine != "GET /items?id=1 HTTP/1.1" {
+			io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n")
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello")
+	})
+
+	req, err := NewRequest(context.Background(), "get", "http://"+addr+"/items?id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := (&Client{}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Proto != "HTTP/1.1" || resp.StatusCode != "200" || resp.Status != "OK" {
+		t.Fatalf("expected: HTTP/1.1 200 OK\tgot: %s %s %s", resp.Proto, resp.StatusCode, resp.Status)
+	}
+
+	if values := resp.HeaderValues("content-type"); len(values) != 1 || values[0] != "text/plain" {
+		t.Fatalf("expected content type: text/plain\tgot: %v", values)
+	}
+
+	if resp.Body != "hello" {
+		t.Fatalf("expected body: hello\tgot: %q", resp.Body)
+	}
+
+	if resp.URL != "http://"+addr+"/items?id=1" || resp.RemoteIP != "127.0.0.1" {
+		t.Fatalf("expected: http://%s/items?id=1 from 127.0.0.1\tgot: %s from %s", addr, resp.URL, resp.RemoteIP)
+	}
+
+	// Phases end in order
+	timing := resp.Timing
+	ends := []time.Duration{timing.DNSLookup, timing.Connect, timing.RequestSent, timing.FirstByte, timing.Done, timing.Total}
+	for i := 1; i < len(ends); i++ {
+		if ends[i] == 0 || ends[i] < ends[i-1] {
+			t.Fatalf("expected increasing phase ends\tgot: %+v", timing)
+		}
+	}
+	if timing.TLSHandshake != 0 {
+		t.Fatalf("expected no TLS handshake\tgot: %v", timing.TLSHandshake)
+	}
+}
+
+func TestClientDoCancel(t *testing.T) {
+	// Never responds
+	addr := startTestServer(t, func(conn net.Conn, requestLine string) {
+		io.Copy(io.Discard, conn)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	req, err := NewRequest(ctx, "GET", "http://"+addr+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := (&Client{}).Do(req)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected: %v\tgot: %v", context.Canceled, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request was not cancelled")
+	}
+}
+
+func TestClientDoResolver(t *testing.T) {
+	errNotFound := errors.New("not found")
+
+	var lookedUp string
+	client := &Client{
+		Resolver: ResolverFunc(func(ctx context.Context, host string) (net.IP, error) {
+			lookedUp = host
+			return nil, errNotFound
+		}),
+	}
+
+	req, err := NewRequest(context.Background(), "GET", "https://api.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.Do(req); !errors.Is(err, errNotFound) {
+		t.Fatalf("expected: %v\tgot: %v", errNotFound, err)
+	}
+
+	if lookedUp != "api.example.com" {
+		t.Fatalf("expected lookup of: api.example.com\tgot: %s", lookedUp)
+	}
+}
+
+func TestNewRequestInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+	}{
+		{name: "invalid_method", method: "FETCH", url: "https://example.com"},
+		{name: "no_domain", method: "GET", url: "https://"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewRequest(context.Background(), test.method, test.url); err == nil {
+				t.Fatalf("expected error for %s %s", test.method, test.url)
+			}
+		})
+	}
+}
+
+/*
+HTTP proxy answering the first request with a Digest
+challenge. The uri of the answer must be the target
+of the request line, which is absolute-form through
+the proxy.
+*/
+func TestClientDoDigestThroughProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// Request line and Authorization of each request
+	requests := make(chan [2]string, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+
+			br := bufio.NewReader(conn)
+			requestLine, _ := br.ReadString('\n')
+			var authorization string
+			for {
+				line, err := br.ReadString('\n')
+				if err != nil || line == "\r\n" {
+					break
+				}
+				if name, value, found := strings.Cut(line, ":"); found && strings.EqualFold(name, "Authorization") {
+					authorization = strings.TrimSpace(value)
+				}
+			}
+			requests <- [2]string{strings.TrimSpace(requestLine), authorization}
+
+			if i == 0 {
+				io.WriteString(conn, "HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Digest realm=\"r\", nonce=\"n\", qop=\"auth\"\r\nContent-Length: 0\r\n\r\n")
+			} else {
+				io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+			}
+			conn.Close()
+		}
+	}()
+
+	client := &Client{
+		Proxy: func(host string, port int, isSecure bool) (*proxy.Proxy, error) {
+			return &proxy.Proxy{Protocol: proxy.ProtocolHTTP, Addr: ln.Addr().String()}, nil
+		},
+	}
+
+	req, err := NewRequest(context.Background(), "get", "http://example.com/items?id=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetDigestAuth(`us"er`, "pass")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != "200" {
+		t.Fatalf("expected: 200\tgot: %s", resp.StatusCode)
+	}
+
+	<-requests
+	second := <-requests
+	target := "http://example.com/items?id=1"
+	if second[0] != "GET "+target+" HTTP/1.1" {
+		t.Fatalf("expected: absolute-form request line\tgot: %s", second[0])
+	}
+	for _, part := range []string{`username="us\"er"`, `uri="` + target + `"`} {
+		if !strings.Contains(second[1], part) {
+			t.Fatalf("expected %s in:\n%s", part, second[1])
+		}
+	}
+}
+
+func TestClientDoRedirectDropsCredentials(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// Header lines received by the redirect target
+	headers := make(chan []string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		br := bufio.NewReader(conn)
+		br.ReadString('\n')
+		var lines []string
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil || line == "\r\n" {
+				break
+			}
+			lines = append(lines, strings.TrimSpace(line))
+		}
+		headers <- lines
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+	}()
+
+	addr := startTestServer(t, func(conn net.Conn, requestLine string) {
+		io.WriteString(conn, "HTTP/1.1 302 Found\r\nLocation: http://"+ln.Addr().String()+"/next\r\nContent-Length: 0\r\n\r\n")
+	})
+
+	req, err := NewRequest(context.Background(), "get", "http://"+addr+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = []string{"Authorization: Bearer secret", "Proxy-Authorization: Basic cDpx", "Cookie: session=1", "X-Trace: 1"}
+	req.SetBasicAuth("user", "pass")
+
+	resp, err := (&Client{FollowRedirects: true}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != "200" || resp.Redirects != 1 {
+		t.Fatalf("expected: 200 after 1 redirect\tgot: %s after %d", resp.StatusCode, resp.Redirects)
+	}
+
+	received := <-headers
+	for _, line := range received {
+		name, _, _ := strings.Cut(line, ":")
+		if strings.EqualFold(name, "Authorization") || strings.EqualFold(name, "Proxy-Authorization") || strings.EqualFold(name, "Cookie") {
+			t.Fatalf("expected: no credentials sent to another host\tgot: %s", line)
+		}
+	}
+	if !strings.Contains(strings.Join(received, "\n"), "X-Trace: 1") {
+		t.Fatalf("expected: X-Trace: 1 to be kept\tgot: %v", received)
+	}
+}
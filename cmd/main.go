@@ -1,10 +1,94 @@
 package main
 
 import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"os"
+
 	"github.com/saeidalz13/gurl/api"
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+)
+
+// Same exit codes as cURL where there is an
+// equivalent, so scripts can tell failures apart.
+const (
+	exitOK               = 0
+	exitGeneric          = 1
+	exitUsage            = 2
+	exitMalformedURL     = 3
+	exitDNS              = 6
+	exitConnect          = 7
+	exitProtocol         = 8
+	exitHTTP2            = 16
+	exitTimeout          = 28
+	exitTLS              = 35
+	exitTooManyRedirects = 47
+	exitWebSocketClosed  = 56
+	exitCertificate      = 60
+	exitProxy            = 97
+
+	// No equivalent in cURL
+	exitExpectationFailed = 100
 )
 
+func exitCode(err error) int {
+	var (
+		usageErr     apperrors.UsageError
+		urlErr       apperrors.URLError
+		dnsErr       apperrors.DNSError
+		timeoutErr   apperrors.TimeoutError
+		proxyErr     apperrors.ProxyError
+		connectErr   apperrors.ConnectError
+		tlsErr       apperrors.TLSError
+		certErr      *tls.CertificateVerificationError
+		redirectsErr apperrors.TooManyRedirectsError
+		protocolErr  apperrors.ProtocolError
+		wsCloseErr   apperrors.WebSocketCloseError
+		expectErr    apperrors.ExpectationError
+	)
+
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &urlErr):
+		return exitMalformedURL
+	case errors.As(err, &timeoutErr):
+		return exitTimeout
+	case errors.As(err, &dnsErr):
+		return exitDNS
+	case errors.As(err, &proxyErr):
+		return exitProxy
+	case errors.As(err, &connectErr):
+		return exitConnect
+	case errors.As(err, &tlsErr) && errors.As(err, &certErr):
+		return exitCertificate
+	case errors.As(err, &tlsErr):
+		return exitTLS
+	case errors.As(err, &redirectsErr):
+		return exitTooManyRedirects
+	case errors.As(err, &protocolErr) && protocolErr.Protocol == "HTTP/2":
+		return exitHTTP2
+	case errors.As(err, &protocolErr):
+		return exitProtocol
+	case errors.As(err, &wsCloseErr):
+		return exitWebSocketClosed
+	case errors.As(err, &expectErr):
+		return exitExpectationFailed
+	default:
+		return exitGeneric
+	}
+}
+
 func main() {
 	// Entering point of the app.
-	api.ExecGurl()
+	err := api.ExecGurl()
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		terminalutils.PrintAppError(err.Error())
+	}
+
+	os.Exit(exitCode(err))
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "success", err: nil, expected: exitOK},
+		{name: "help", err: flag.ErrHelp, expected: exitOK},
+		{name: "generic", err: io.ErrUnexpectedEOF, expected: exitGeneric},
+		{name: "usage", err: apperrors.UsageError{Reason: "bad flag"}, expected: exitUsage},
+		{name: "malformed_url", err: apperrors.URLError{URL: "ws://", Reason: "no domain"}, expected: exitMalformedURL},
+		{name: "dns", err: apperrors.DNSError{Domain: "x.invalid", RCode: apperrors.RCodeNXDomain}, expected: exitDNS},
+		{name: "dns_timeout", err: apperrors.TimeoutError{Phase: "DNS", After: time.Second}, expected: exitTimeout},
+		{name: "connect", err: apperrors.ConnectError{Addr: "127.0.0.1:1", Err: errors.New("refused")}, expected: exitConnect},
+		{name: "proxy", err: apperrors.ProxyError{Proxy: "127.0.0.1:3128", Err: errors.New("407")}, expected: exitProxy},
+		{name: "tls", err: apperrors.TLSError{ServerName: "example.com", Err: errors.New("handshake failure")}, expected: exitTLS},
+		{name: "certificate", err: apperrors.TLSError{ServerName: "example.com", Err: &tls.CertificateVerificationError{Err: errors.New("unknown authority")}}, expected: exitCertificate},
+		{name: "http2", err: apperrors.ProtocolError{Protocol: "HTTP/2", Err: errors.New("GOAWAY")}, expected: exitHTTP2},
+		{name: "http1", err: apperrors.ProtocolError{Protocol: "HTTP/1.1", Err: errors.New("bad status line")}, expected: exitProtocol},
+		{name: "redirects", err: apperrors.TooManyRedirectsError{Max: 10}, expected: exitTooManyRedirects},
+		{name: "websocket_closed", err: apperrors.WebSocketCloseError{Code: 1011, Reason: "oops"}, expected: exitWebSocketClosed},
+		{name: "expectation", err: apperrors.ExpectationError{Reason: "message 1 does not match"}, expected: exitExpectationFailed},
+		{name: "wrapped", err: fmt.Errorf("request: %w", apperrors.ConnectError{Addr: "x", Err: io.EOF}), expected: exitConnect},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := exitCode(test.err); got != test.expected {
+				t.Fatalf("expected: %d\tgot: %d", test.expected, got)
+			}
+		})
+	}
+}
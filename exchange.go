@@ -0,0 +1,267 @@
+package gurl
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/api/http"
+	"github.com/saeidalz13/gurl/api/http2"
+	"github.com/saeidalz13/gurl/api/tcp"
+	"github.com/saeidalz13/gurl/internal/httpconstants"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+	"github.com/saeidalz13/gurl/models"
+)
+
+func dispatchHTTP2(tcm tcp.TCPConnManager, reqGenerator http.HTTPRequestGenerator, scheme, ip string, verbose bool) (http.HTTPResponseParser, error) {
+	fields, body := reqGenerator.GenerateHTTP2(scheme)
+
+	if verbose {
+		terminalutils.PrintHTTPClientInfo(ip, http.FormatHTTP2Request(fields, body))
+	}
+
+	resp, err := tcm.DispatchHTTP2Request(fields, body, verbose)
+	if err != nil {
+		return http.HTTPResponseParser{}, err
+	}
+
+	return http.NewHTTP2ResponseParser(resp), nil
+}
+
+// The request is sent as HTTP/1.1 asking the server
+// to switch to h2c. The server may ignore it and
+// respond with HTTP/1.1.
+func dispatchHTTP2Upgrade(tcm tcp.TCPConnManager, reqGenerator http.HTTPRequestGenerator, ip string, verbose bool) (http.HTTPResponseParser, error) {
+	reqGenerator.AddHeader("Connection: Upgrade, HTTP2-Settings")
+	reqGenerator.AddHeader("Upgrade: h2c")
+	reqGenerator.AddHeader("HTTP2-Settings: " + http2.UpgradeSettingsHeaderValue())
+	httpRequest := reqGenerator.Generate()
+
+	if verbose {
+		terminalutils.PrintHTTPClientInfo(ip, http.MaskCredentials(httpRequest))
+	}
+
+	resp, respBytes, upgraded, err := tcm.DispatchHTTP2UpgradeRequest(httpRequest, verbose)
+	if err != nil {
+		return http.HTTPResponseParser{}, err
+	}
+
+	if !upgraded {
+		if verbose {
+			terminalutils.PrintAppWarning("server did not upgrade to h2c, continuing with HTTP/1.1")
+		}
+		return http.NewHTTPResponseParser(respBytes).Parse()
+	}
+
+	return http.NewHTTP2ResponseParser(resp), nil
+}
+
+func dispatchHTTP1(tcm tcp.TCPConnManager, reqGenerator http.HTTPRequestGenerator, ip string, verbose bool) (http.HTTPResponseParser, error) {
+	httpRequest := reqGenerator.Generate()
+
+	if verbose {
+		terminalutils.PrintHTTPClientInfo(ip, http.MaskCredentials(httpRequest))
+	}
+
+	respBytes, err := tcm.DispatchHTTPRequest(httpRequest)
+	if err != nil {
+		return http.HTTPResponseParser{}, err
+	}
+
+	return http.NewHTTPResponseParser(respBytes).Parse()
+}
+
+// Picks the HTTP version based on what was negotiated
+// with ALPN (TLS) or requested by the user (cleartext).
+func dispatchHTTPRequest(tcm tcp.TCPConnManager, reqGenerator http.HTTPRequestGenerator, connInfo models.ConnInfo, httpVersion uint8, verbose bool) (http.HTTPResponseParser, error) {
+	ip := serverIP(connInfo)
+
+	if connInfo.IsTls {
+		if tcm.NegotiatedProtocol() == httpconstants.ALPNHTTP2 {
+			return dispatchHTTP2(tcm, reqGenerator, "https", ip, verbose)
+		}
+		return dispatchHTTP1(tcm, reqGenerator, ip, verbose)
+	}
+
+	switch httpVersion {
+	case httpconstants.HTTPVersion2PriorKnowledge:
+		return dispatchHTTP2(tcm, reqGenerator, "http", ip, verbose)
+	case httpconstants.HTTPVersion2:
+		return dispatchHTTP2Upgrade(tcm, reqGenerator, ip, verbose)
+	default:
+		return dispatchHTTP1(tcm, reqGenerator, ip, verbose)
+	}
+}
+
+// Servers may answer again with 401 and stale=true if
+// the nonce expired in between, so one more attempt
+// is made with the new nonce.
+const maxDigestAttempts = 2
+
+/*
+State of an HTTP request that is sent more than once:
+after a Digest challenge, on retries and on redirects
+(where it points to the new target).
+*/
+type httpExchange struct {
+	ctx          context.Context
+	tcm          tcp.TCPConnManager
+	connInfo     models.ConnInfo
+	reqGenerator http.HTTPRequestGenerator
+	digestAuth   *http.DigestAuth
+	method       string
+	httpVersion  uint8
+	verbose      bool
+
+	// Of the last connection; nil without TLS
+	tlsState *tls.ConnectionState
+}
+
+// Opens the connection (with TLS handshake if needed)
+// and checks HTTP/2 was negotiated if required.
+func (ex *httpExchange) connect() error {
+	if err := ex.tcm.InitTCPConn(ex.ctx); err != nil {
+		return err
+	}
+	ex.tlsState = ex.tcm.ConnectionState()
+
+	isHTTP2 := ex.tcm.NegotiatedProtocol() == httpconstants.ALPNHTTP2
+	requiresHTTP2 := ex.httpVersion == httpconstants.HTTPVersion2 || ex.httpVersion == httpconstants.HTTPVersion2PriorKnowledge
+	if ex.connInfo.IsTls && requiresHTTP2 && !isHTTP2 {
+		return apperrors.ProtocolError{Protocol: "HTTP/2", Err: errors.New("server did not negotiate HTTP/2 with ALPN")}
+	}
+
+	if ex.verbose && ex.connInfo.IsTls {
+		terminalutils.PrintTLSSessionInfo(ex.tcm.IsTLSSessionResumed())
+	}
+
+	return nil
+}
+
+/*
+Digest needs a challenge (nonce) from the server first.
+The request is sent without credentials, and if the
+server responds with 401, it's sent again on a new
+connection with the answer to the challenge.
+*/
+func (ex *httpExchange) authenticateDigest(resp http.HTTPResponseParser) (http.HTTPResponseParser, error) {
+	for attempt := 0; attempt < maxDigestAttempts && resp.StatusCode() == "401"; attempt++ {
+		challenge, err := http.ParseDigestChallenge(resp.HeaderValues("WWW-Authenticate"))
+		if err != nil {
+			return resp, err
+		}
+
+		if attempt > 0 && !challenge.Stale {
+			break
+		}
+
+		if ex.verbose {
+			resp.Print(ex.verbose, false)
+		}
+
+		ex.digestAuth.SetChallenge(challenge)
+		// uri must be the target of the request line
+		authorization, err := ex.digestAuth.Authorization(ex.method, ex.reqGenerator.RequestTarget())
+		if err != nil {
+			return resp, err
+		}
+		ex.reqGenerator.SetAuthorization(authorization)
+
+		ex.tcm.Close()
+		if err := ex.connect(); err != nil {
+			return resp, err
+		}
+
+		resp, err = dispatchHTTPRequest(ex.tcm, ex.reqGenerator, ex.connInfo, ex.httpVersion, ex.verbose)
+		if err != nil {
+			return resp, err
+		}
+	}
+
+	return resp, nil
+}
+
+// A single attempt on a new connection
+func (ex *httpExchange) send() (http.HTTPResponseParser, error) {
+	defer ex.tcm.Close()
+
+	if err := ex.connect(); err != nil {
+		return http.HTTPResponseParser{}, err
+	}
+
+	resp, err := dispatchHTTPRequest(ex.tcm, ex.reqGenerator, ex.connInfo, ex.httpVersion, ex.verbose)
+	if err != nil || ex.digestAuth == nil {
+		return resp, err
+	}
+
+	return ex.authenticateDigest(resp)
+}
+
+/*
+Sends the request and retries it on connection errors,
+timeouts and the retry status codes of the policy.
+No retry is made if the wait would pass the deadline
+of the whole operation (zero deadline means no limit).
+*/
+func (ex *httpExchange) sendWithRetry(policy http.RetryPolicy, deadline time.Time) (http.HTTPResponseParser, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := ex.send()
+
+		retriesLeft := policy.Retries - attempt
+		if retriesLeft <= 0 || ex.ctx.Err() != nil {
+			return resp, err
+		}
+
+		var reason, retryAfter string
+		switch {
+		case err != nil && policy.ShouldRetryError(err):
+			reason = err.Error()
+		case err == nil && policy.ShouldRetryStatus(resp.StatusCode()):
+			reason = "status " + resp.StatusCode()
+			if values := resp.HeaderValues("Retry-After"); len(values) > 0 {
+				retryAfter = values[0]
+			}
+		default:
+			return resp, err
+		}
+
+		wait := policy.Backoff(attempt, retryAfter, time.Now())
+		if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+
+		terminalutils.PrintAppWarning(fmt.Sprintf("%s, retrying in %s (%d retries left)", reason, wait.Round(time.Millisecond), retriesLeft))
+		select {
+		case <-time.After(wait):
+		case <-ex.ctx.Done():
+			return resp, ex.ctx.Err()
+		}
+	}
+}
+
+// The request of the final response as it was sent,
+// with the credentials masked. HTTP/2 has no request
+// line so the pseudo headers are listed instead.
+func sentRequest(reqGenerator http.HTTPRequestGenerator, proto, scheme string) SentRequest {
+	var text string
+	if proto == "HTTP/2" {
+		text = http.FormatHTTP2Request(reqGenerator.GenerateHTTP2(scheme))
+	} else {
+		text = http.MaskCredentials(reqGenerator.Generate())
+	}
+
+	head, body, _ := strings.Cut(text, "\r\n\r\n")
+	lines := strings.Split(head, "\r\n")
+
+	req := SentRequest{Proto: proto, Body: body}
+	if proto != "HTTP/2" {
+		req.Line, lines = lines[0], lines[1:]
+	}
+	req.Header = lines
+
+	return req
+}
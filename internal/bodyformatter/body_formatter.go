@@ -0,0 +1,130 @@
+package bodyformatter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	kindText uint8 = iota
+	kindJSON
+	kindXML
+	kindHTML
+	kindForm
+	kindBinary
+)
+
+/*
+Picks the formatting from the media type of the
+Content-Type header (parameters such as charset are
+not part of it). Types ending with "+json" or "+xml"
+(e.g. application/problem+json) are JSON and XML.
+
+Without Content-Type, JSON is detected by parsing and
+bodies that aren't UTF-8 text are treated as binary.
+*/
+func determineKind(mediaType string, body []byte) uint8 {
+	switch {
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"):
+		return kindJSON
+	case mediaType == "text/html", mediaType == "application/xhtml+xml":
+		return kindHTML
+	case mediaType == "application/xml", mediaType == "text/xml", strings.HasSuffix(mediaType, "+xml"):
+		return kindXML
+	case mediaType == "application/x-www-form-urlencoded":
+		return kindForm
+	case strings.HasPrefix(mediaType, "text/"), isTextApplication(mediaType):
+		return kindText
+	case mediaType != "":
+		return kindBinary
+	}
+
+	if json.Valid(body) {
+		return kindJSON
+	}
+	if isText(body) {
+		return kindText
+	}
+	return kindBinary
+}
+
+// Types that are text even though they aren't "text/*"
+func isTextApplication(mediaType string) bool {
+	switch mediaType {
+	case "application/javascript", "application/ecmascript", "application/x-javascript", "application/graphql", "application/yaml", "application/x-yaml", "application/toml", "application/sql":
+		return true
+	}
+	return false
+}
+
+// Valid UTF-8 without control characters other
+// than whitespace (e.g. NUL bytes of binary files).
+func isText(body []byte) bool {
+	if !utf8.Valid(body) {
+		return false
+	}
+
+	for _, b := range body {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+Formats the body for the terminal based on its
+Content-Type (e.g. "application/json; charset=utf-8"):
+
+  - JSON: indented and colorized
+  - XML and HTML: indented
+  - Forms: one decoded "key = value" per line
+  - Binary (e.g. images): hex dump, so the raw bytes
+    don't mess up the terminal
+
+Text is decoded from its charset first. If the body
+can't be formatted (e.g. invalid JSON), it's returned
+as text as it is.
+*/
+func Format(body, contentType string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = ""
+	}
+
+	raw := []byte(body)
+	kind := determineKind(mediaType, raw)
+	if kind == kindBinary {
+		return hex.Dump(raw)
+	}
+
+	text, err := decodeCharset(raw, params["charset"])
+	if err != nil {
+		// Unknown charset; shown as it is
+		text = body
+	}
+
+	switch kind {
+	case kindJSON:
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(text), "", "  "); err != nil {
+			return text
+		}
+		return colorizeJSON(indented.String())
+
+	case kindXML:
+		return indentMarkup(text, false)
+
+	case kindHTML:
+		return indentMarkup(text, true)
+
+	case kindForm:
+		return formatForm(text)
+	}
+
+	return text
+}
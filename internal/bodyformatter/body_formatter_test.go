@@ -0,0 +1,166 @@
+package bodyformatter
+
+import (
+	"testing"
+
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+)
+
+func TestDetermineKind(t *testing.T) {
+	tests := []struct {
+		name      string
+		mediaType string
+		body      string
+		expected  uint8
+	}{
+		{name: "json", mediaType: "application/json", expected: kindJSON},
+		{name: "json_suffix", mediaType: "application/problem+json", expected: kindJSON},
+		{name: "html", mediaType: "text/html", expected: kindHTML},
+		{name: "xml", mediaType: "application/xml", expected: kindXML},
+		{name: "xml_suffix", mediaType: "image/svg+xml", expected: kindXML},
+		{name: "form", mediaType: "application/x-www-form-urlencoded", expected: kindForm},
+		{name: "text", mediaType: "text/csv", expected: kindText},
+		{name: "javascript", mediaType: "application/javascript", expected: kindText},
+		{name: "binary", mediaType: "image/png", body: "text", expected: kindBinary},
+		{name: "sniff_json", body: `{"a":1}`, expected: kindJSON},
+		{name: "sniff_text", body: "hello\n", expected: kindText},
+		{name: "sniff_binary", body: "a\x00b", expected: kindBinary},
+		{name: "sniff_invalid_utf8", body: "\xff\xfe", expected: kindBinary},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind := determineKind(test.mediaType, []byte(test.body))
+			if kind != test.expected {
+				t.Fatalf("expected: %d\tgot: %d", test.expected, kind)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	terminalutils.DisableColors()
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		expected    string
+	}{
+		{
+			name:        "json",
+			body:        `{"a":[1,true],"b":"x"}`,
+			contentType: "application/json; charset=utf-8",
+			expected:    "{\n  \"a\": [\n    1,\n    true\n  ],\n  \"b\": \"x\"\n}",
+		},
+		{
+			name:        "invalid_json",
+			body:        `{"a":`,
+			contentType: "application/json",
+			expected:    `{"a":`,
+		},
+		{
+			name:        "xml",
+			body:        `<?xml version="1.0"?><root><item id="1">one</item><empty/></root>`,
+			contentType: "application/xml",
+			expected:    "<?xml version=\"1.0\"?>\n<root>\n  <item id=\"1\">one</item>\n  <empty/>\n</root>\n",
+		},
+		{
+			name:        "form",
+			body:        "name=gurl&tags=a%2Cb&msg=hello+world",
+			contentType: "application/x-www-form-urlencoded",
+			expected:    "name = gurl\ntags = a,b\nmsg = hello world\n",
+		},
+		{
+			name:        "binary",
+			body:        "\x89PNG",
+			contentType: "image/png",
+			expected:    "00000000  89 50 4e 47                                       |.PNG|\n",
+		},
+		{
+			name:        "latin1",
+			body:        "caf\xe9",
+			contentType: "text/plain; charset=ISO-8859-1",
+			expected:    "café",
+		},
+		{
+			name:        "unknown_charset",
+			body:        "abc",
+			contentType: "text/plain; charset=koi8-r",
+			expected:    "abc",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatted := Format(test.body, test.contentType)
+			if formatted != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, formatted)
+			}
+		})
+	}
+}
+
+func TestIndentMarkupHTML(t *testing.T) {
+	html := `<!DOCTYPE html><html><head><meta charset=utf-8><title>Hi</title>` +
+		`<script>if (a<b) {x()}</script></head><body><div class="a>b"><p>Hello <b>world</b></p><br></div></body></html>`
+
+	expected := `<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset=utf-8>
+    <title>Hi</title>
+    <script>if (a<b) {x()}</script>
+  </head>
+  <body>
+    <div class="a>b">
+      <p>
+        Hello
+        <b>world</b>
+      </p>
+      <br>
+    </div>
+  </body>
+</html>
+`
+
+	if formatted := indentMarkup(html, true); formatted != expected {
+		t.Fatalf("expected: %s\tgot: %s", expected, formatted)
+	}
+}
+
+func TestDecodeCharset(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		charset     string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "utf8", body: "café", charset: "UTF-8", expected: "café"},
+		{name: "windows1252", body: "\x80 \x93quoted\x94", charset: "windows-1252", expected: "€ “quoted”"},
+		{name: "utf16_bom_le", body: "\xff\xfeh\x00i\x00", charset: "utf-16", expected: "hi"},
+		{name: "utf16be", body: "\x00h\x00i", charset: "utf-16be", expected: "hi"},
+		{name: "utf16_odd_length", body: "\x00h\x00", charset: "utf-16be", expectedErr: true},
+		{name: "unsupported", body: "abc", charset: "shift_jis", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := decodeCharset([]byte(test.body), test.charset)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error\tgot: %q", decoded)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, decoded)
+			}
+		})
+	}
+}
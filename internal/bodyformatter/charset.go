@@ -0,0 +1,81 @@
+package bodyformatter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Windows-1252 is Latin-1 except for 0x80-0x9F,
+// which are printable characters instead of
+// control codes. Zero means undefined.
+var windows1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+/*
+Decodes the body to UTF-8 from the charset parameter
+of Content-Type. Empty charset is treated as UTF-8
+(the default of JSON and the common case on the web).
+
+Only the charsets that can be decoded with the
+standard library are supported.
+*/
+func decodeCharset(body []byte, charset string) (string, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return string(body), nil
+
+	case "iso-8859-1", "latin1", "l1":
+		runes := make([]rune, len(body))
+		for i, b := range body {
+			// Latin-1 bytes are the first 256 code points
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+
+	case "windows-1252", "cp1252":
+		runes := make([]rune, len(body))
+		for i, b := range body {
+			runes[i] = rune(b)
+			if b >= 0x80 && b <= 0x9F && windows1252[b-0x80] != 0 {
+				runes[i] = windows1252[b-0x80]
+			}
+		}
+		return string(runes), nil
+
+	case "utf-16", "utf-16be", "utf-16le":
+		return decodeUTF16(body, strings.ToLower(charset))
+
+	default:
+		return "", fmt.Errorf("unsupported charset: %s", charset)
+	}
+}
+
+// "utf-16" has a byte order mark (big endian if
+// it's missing), the others have a fixed order.
+func decodeUTF16(body []byte, charset string) (string, error) {
+	if len(body)%2 != 0 {
+		return "", fmt.Errorf("utf-16 body has odd length: %d", len(body))
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+	switch {
+	case charset == "utf-16le":
+		order = binary.LittleEndian
+	case charset == "utf-16" && len(body) >= 2 && body[0] == 0xFF && body[1] == 0xFE:
+		order = binary.LittleEndian
+		body = body[2:]
+	case charset == "utf-16" && len(body) >= 2 && body[0] == 0xFE && body[1] == 0xFF:
+		body = body[2:]
+	}
+
+	units := make([]uint16, len(body)/2)
+	for i := range units {
+		units[i] = order.Uint16(body[2*i:])
+	}
+
+	return string(utf16.Decode(units)), nil
+}
@@ -0,0 +1,41 @@
+package bodyformatter
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+)
+
+/*
+Decodes application/x-www-form-urlencoded bodies
+(e.g. "name=gurl&tags=a%2Cb") into one pair per line
+in the order they were sent:
+
+	name = gurl
+	tags = a,b
+
+Pairs that can't be unescaped are shown as they are.
+*/
+func formatForm(s string) string {
+	t := terminalutils.StdoutTheme()
+	var sb strings.Builder
+
+	for _, pair := range strings.Split(strings.TrimSpace(s), "&") {
+		if pair == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+
+		sb.WriteString(t.BodyKey + key + t.Reset() + " = " + value + "\n")
+	}
+
+	return sb.String()
+}
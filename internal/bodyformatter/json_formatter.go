@@ -0,0 +1,75 @@
+package bodyformatter
+
+import (
+	"strings"
+
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+)
+
+// Index of the closing quote of the string
+// starting at start (escaped quotes are skipped).
+func stringEnd(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return len(s) - 1
+}
+
+// Keys are followed by ':' (after optional spaces)
+func isJSONKey(s string, end int) bool {
+	rest := strings.TrimLeft(s[end+1:], " \t\r\n")
+	return strings.HasPrefix(rest, ":")
+}
+
+/*
+Colors the tokens of valid JSON: keys, strings,
+numbers and literals (true, false, null) each have
+their own color. Punctuation and whitespace are
+kept as they are.
+*/
+func colorizeJSON(s string) string {
+	t := terminalutils.StdoutTheme()
+	var sb strings.Builder
+	sb.Grow(len(s) * 2)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case c == '"':
+			end := stringEnd(s, i)
+			color := t.BodyString
+			if isJSONKey(s, end) {
+				color = t.BodyKey
+			}
+			sb.WriteString(color + s[i:end+1] + t.Reset())
+			i = end
+
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i
+			for end+1 < len(s) && strings.IndexByte("+-.eE0123456789", s[end+1]) != -1 {
+				end++
+			}
+			sb.WriteString(t.BodyNumber + s[i:end+1] + t.Reset())
+			i = end
+
+		case c == 't' || c == 'f' || c == 'n':
+			end := i
+			for end+1 < len(s) && s[end+1] >= 'a' && s[end+1] <= 'z' {
+				end++
+			}
+			sb.WriteString(t.BodyLiteral + s[i:end+1] + t.Reset())
+			i = end
+
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,157 @@
+package bodyformatter
+
+import (
+	"strings"
+)
+
+const markupIndent = "  "
+
+// HTML elements that never have a closing tag
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// Their content is not markup (or whitespace matters)
+// so it's kept as it is.
+var htmlRawTextElements = map[string]bool{
+	"script": true, "style": true, "pre": true, "textarea": true,
+}
+
+// Index of the '>' ending the tag that starts at
+// start. '>' inside quoted attribute values is skipped.
+func tagEnd(s string, start int) int {
+	var quote byte
+	for i := start + 1; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote != 0:
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// e.g. "<a href='x'>" -> "a"
+func tagName(tag string) string {
+	name := strings.TrimLeft(tag, "</")
+	if i := strings.IndexAny(name, " \t\r\n/>"); i != -1 {
+		name = name[:i]
+	}
+	return name
+}
+
+type markupWriter struct {
+	sb    strings.Builder
+	depth int
+}
+
+func (mw *markupWriter) line(s string) {
+	mw.sb.WriteString(strings.Repeat(markupIndent, mw.depth))
+	mw.sb.WriteString(s)
+	mw.sb.WriteByte('\n')
+}
+
+/*
+Puts each tag and text on its own line, indented by
+how deep it is. An element with only text stays on a
+single line, e.g. <title>Example</title>.
+
+It doesn't validate the markup; a missing closing tag
+only affects the indentation of what comes after it.
+*/
+func indentMarkup(s string, isHTML bool) string {
+	mw := &markupWriter{}
+
+	for i := 0; i < len(s); {
+		if s[i] != '<' {
+			next := strings.IndexByte(s[i:], '<')
+			if next == -1 {
+				next = len(s) - i
+			}
+			if text := strings.Join(strings.Fields(s[i:i+next]), " "); text != "" {
+				mw.line(text)
+			}
+			i += next
+			continue
+		}
+
+		var end int
+		if strings.HasPrefix(s[i:], "<!--") {
+			end = strings.Index(s[i:], "-->")
+			if end != -1 {
+				end += i + len("-->") - 1
+			}
+		} else {
+			end = tagEnd(s, i)
+		}
+
+		if end == -1 {
+			// Not closed, shown as text
+			mw.line(strings.TrimSpace(s[i:]))
+			break
+		}
+
+		tag := s[i : end+1]
+		i = end + 1
+		name := tagName(tag)
+		if isHTML {
+			name = strings.ToLower(name)
+		}
+
+		switch {
+		case strings.HasPrefix(tag, "<!"), strings.HasPrefix(tag, "<?"):
+			mw.line(tag)
+
+		case strings.HasPrefix(tag, "</"):
+			mw.depth = max(mw.depth-1, 0)
+			mw.line(tag)
+
+		case strings.HasSuffix(tag, "/>"), isHTML && htmlVoidElements[name]:
+			mw.line(tag)
+
+		case isHTML && htmlRawTextElements[name]:
+			closing := strings.Index(strings.ToLower(s[i:]), "</"+name)
+			if closing == -1 {
+				closing = len(s) - i
+			}
+			content := strings.Trim(s[i:i+closing], "\r\n")
+			i += closing
+
+			if content == "" || !strings.Contains(content, "\n") {
+				// The closing tag is written on the same line
+				closingEnd := tagEnd(s, i)
+				if closingEnd == -1 {
+					closingEnd = len(s) - 1
+				}
+				mw.line(tag + content + s[i:closingEnd+1])
+				i = closingEnd + 1
+				continue
+			}
+
+			mw.line(tag)
+			mw.sb.WriteString(content + "\n")
+			mw.depth++
+
+		default:
+			// Only text until the closing tag
+			next := strings.IndexByte(s[i:], '<')
+			closing := "</" + tagName(tag) + ">"
+			if next != -1 && strings.HasPrefix(s[i+next:], closing) {
+				text := strings.Join(strings.Fields(s[i:i+next]), " ")
+				mw.line(tag + text + closing)
+				i += next + len(closing)
+				continue
+			}
+
+			mw.line(tag)
+			mw.depth++
+		}
+	}
+
+	return mw.sb.String()
+}
@@ -3,15 +3,34 @@ package domainparser
 import (
 	"errors"
 	"fmt"
+	"net"
 	"strings"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
 )
 
 const (
 	ProtocolHTTP uint8 = iota + 1
 	ProtocolHTTPS
 	ProtocolWS
+	ProtocolWSS
 )
 
+// ws:// or wss://
+func IsWebSocket(protocol uint8) bool {
+	return protocol == ProtocolWS || protocol == ProtocolWSS
+}
+
+// Domain without the port, e.g. "example.com:8080"
+// -> "example.com" and "[::1]:8080" -> "::1"
+func Host(domain string) string {
+	host, _, err := net.SplitHostPort(domain)
+	if err != nil {
+		host = domain
+	}
+	return strings.Trim(host, "[]")
+}
+
 type DomainParser struct {
 	IsLocalHost   bool
 	Protocol      uint8
@@ -73,8 +92,10 @@ func (d *DomainParser) trimProtocolFromWebSocketDomain() error {
 }
 
 func (d *DomainParser) determineProtocol() {
-	if strings.HasPrefix(d.Domain, "ws://") || strings.HasPrefix(d.Domain, "wss://") {
+	if strings.HasPrefix(d.Domain, "ws://") {
 		d.Protocol = ProtocolWS
+	} else if strings.HasPrefix(d.Domain, "wss://") {
+		d.Protocol = ProtocolWSS
 	} else if strings.HasPrefix(d.Domain, "http://") {
 		d.Protocol = ProtocolHTTP
 	} else {
@@ -94,14 +115,14 @@ func (d *DomainParser) Parse() error {
 	d.determineIfLocalhost()
 
 	switch d.Protocol {
-	case ProtocolWS:
+	case ProtocolWS, ProtocolWSS:
 		if err := d.trimProtocolFromWebSocketDomain(); err != nil {
-			return err
+			return apperrors.URLError{URL: d.Domain, Reason: err.Error()}
 		}
 
 	case ProtocolHTTP, ProtocolHTTPS:
 		if err := d.trimProtocolFromHTTPDomain(); err != nil {
-			return err
+			return apperrors.URLError{URL: d.Domain, Reason: err.Error()}
 		}
 
 	default:
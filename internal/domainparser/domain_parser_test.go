@@ -0,0 +1,57 @@
+package domainparser
+
+import "testing"
+
+func TestParseProtocol(t *testing.T) {
+	tests := []struct {
+		name             string
+		domain           string
+		expectedProtocol uint8
+		expectedDomain   string
+		expectedPath     string
+	}{
+		{name: "http", domain: "http://example.com/a", expectedProtocol: ProtocolHTTP, expectedDomain: "example.com", expectedPath: "/a"},
+		{name: "https", domain: "https://example.com", expectedProtocol: ProtocolHTTPS, expectedDomain: "example.com", expectedPath: "/"},
+		{name: "no_protocol", domain: "example.com", expectedProtocol: ProtocolHTTPS, expectedDomain: "example.com", expectedPath: "/"},
+		{name: "ws", domain: "ws://example.com/chat", expectedProtocol: ProtocolWS, expectedDomain: "example.com", expectedPath: "/chat"},
+		{name: "wss", domain: "wss://example.com/chat", expectedProtocol: ProtocolWSS, expectedDomain: "example.com", expectedPath: "/chat"},
+		{name: "wss_port", domain: "wss://Example.com:8443", expectedProtocol: ProtocolWSS, expectedDomain: "example.com:8443", expectedPath: "/"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dp := NewDomainParser(test.domain)
+			if err := dp.Parse(); err != nil {
+				t.Fatal(err)
+			}
+
+			if dp.Protocol != test.expectedProtocol {
+				t.Fatalf("expected: %d\tgot: %d", test.expectedProtocol, dp.Protocol)
+			}
+			if dp.Domain != test.expectedDomain || dp.Path != test.expectedPath {
+				t.Fatalf("expected: %s%s\tgot: %s%s", test.expectedDomain, test.expectedPath, dp.Domain, dp.Path)
+			}
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		expected string
+	}{
+		{name: "no_port", domain: "Example.com", expected: "Example.com"},
+		{name: "port", domain: "example.com:8080", expected: "example.com"},
+		{name: "ipv6", domain: "[::1]:8080", expected: "::1"},
+		{name: "ipv6_no_port", domain: "[::1]", expected: "::1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Host(test.domain); got != test.expected {
+				t.Fatalf("expected: %s\tgot: %s", test.expected, got)
+			}
+		})
+	}
+}
@@ -1,13 +0,0 @@
-package errutils
-
-import (
-	"fmt"
-	"os"
-)
-
-func CheckErr(err error) {
-	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
-}
@@ -0,0 +1,393 @@
+package hpack
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Default size of the dynamic table (SETTINGS_HEADER_TABLE_SIZE)
+// before any SETTINGS frame is exchanged.
+const DefaultDynamicTableSize = 4096
+
+// Each dynamic table entry costs its name and
+// value length plus this overhead (RFC 7541 4.1)
+const entryOverhead = 32
+
+var (
+	errIntegerOverflow = errors.New("hpack: integer overflow")
+	errTruncated       = errors.New("hpack: truncated header block")
+
+	// Decoded fields are over SetMaxHeaderListSize
+	ErrHeaderListTooLarge = errors.New("hpack: header list too large")
+)
+
+// Sensitive fields (e.g. authorization) are encoded
+// as "never indexed" so intermediaries do not
+// compress them into a shared table.
+type HeaderField struct {
+	Name      string
+	Value     string
+	Sensitive bool
+}
+
+func (hf HeaderField) size() uint32 {
+	return uint32(len(hf.Name) + len(hf.Value) + entryOverhead)
+}
+
+/*
+The dynamic table is a FIFO. New entries are
+inserted at the beginning (lowest index) and the
+oldest entries are evicted from the end when the
+size exceeds the maximum.
+*/
+type dynamicTable struct {
+	size    uint32
+	maxSize uint32
+	entries []HeaderField
+}
+
+func (dt *dynamicTable) evict() {
+	for dt.size > dt.maxSize && len(dt.entries) > 0 {
+		last := dt.entries[len(dt.entries)-1]
+		dt.size -= last.size()
+		dt.entries = dt.entries[:len(dt.entries)-1]
+	}
+}
+
+func (dt *dynamicTable) add(hf HeaderField) {
+	dt.entries = append([]HeaderField{hf}, dt.entries...)
+	dt.size += hf.size()
+	dt.evict()
+}
+
+func (dt *dynamicTable) setMaxSize(maxSize uint32) {
+	dt.maxSize = maxSize
+	dt.evict()
+}
+
+type Decoder struct {
+	// Upper bound set by our SETTINGS_HEADER_TABLE_SIZE.
+	// The encoder may only update the table size
+	// within this limit.
+	allowedMaxSize uint32
+	table          dynamicTable
+
+	// Zero means no limit
+	maxHeaderListSize uint32
+}
+
+func NewDecoder(maxTableSize uint32) *Decoder {
+	return &Decoder{
+		allowedMaxSize: maxTableSize,
+		table:          dynamicTable{maxSize: maxTableSize},
+	}
+}
+
+/*
+Limit of the header list of a block, as advertised in
+SETTINGS_MAX_HEADER_LIST_SIZE: the sum of the name and
+value lengths of the fields plus 32 for each field.
+*/
+func (d *Decoder) SetMaxHeaderListSize(size uint32) {
+	d.maxHeaderListSize = size
+}
+
+func (d *Decoder) field(index uint64) (HeaderField, error) {
+	if index == 0 {
+		return HeaderField{}, fmt.Errorf("hpack: index 0 is invalid")
+	}
+
+	if index <= uint64(len(staticTable)) {
+		return staticTable[index-1], nil
+	}
+
+	dynIndex := index - uint64(len(staticTable)) - 1
+	if dynIndex >= uint64(len(d.table.entries)) {
+		return HeaderField{}, fmt.Errorf("hpack: index %d out of range", index)
+	}
+
+	return d.table.entries[dynIndex], nil
+}
+
+/*
+Each header field representation is identified
+by the most significant bits of its first byte:
+  - 1xxxxxxx: Indexed header field
+  - 01xxxxxx: Literal with incremental indexing
+  - 001xxxxx: Dynamic table size update
+  - 0001xxxx: Literal never indexed
+  - 0000xxxx: Literal without indexing
+
+Table size updates are only allowed at the start of
+a block (RFC 7541 4.2).
+*/
+func (d *Decoder) Decode(block []byte) ([]HeaderField, error) {
+	fields := make([]HeaderField, 0, 10)
+
+	var listSize uint64
+	addField := func(hf HeaderField) error {
+		listSize += uint64(hf.size())
+		if d.maxHeaderListSize > 0 && listSize > uint64(d.maxHeaderListSize) {
+			return fmt.Errorf("%w: over %d bytes", ErrHeaderListTooLarge, d.maxHeaderListSize)
+		}
+		fields = append(fields, hf)
+		return nil
+	}
+
+	for len(block) > 0 {
+		first := block[0]
+
+		switch {
+		case first&0x80 != 0:
+			index, rest, err := readInteger(block, 7)
+			if err != nil {
+				return nil, err
+			}
+			block = rest
+
+			hf, err := d.field(index)
+			if err != nil {
+				return nil, err
+			}
+			if err := addField(hf); err != nil {
+				return nil, err
+			}
+
+		case first&0xc0 == 0x40:
+			hf, rest, err := d.readLiteral(block, 6)
+			if err != nil {
+				return nil, err
+			}
+			block = rest
+
+			d.table.add(hf)
+			if err := addField(hf); err != nil {
+				return nil, err
+			}
+
+		case first&0xe0 == 0x20:
+			if len(fields) > 0 {
+				return nil, fmt.Errorf("hpack: table size update after a header field")
+			}
+
+			size, rest, err := readInteger(block, 5)
+			if err != nil {
+				return nil, err
+			}
+			block = rest
+
+			if size > uint64(d.allowedMaxSize) {
+				return nil, fmt.Errorf("hpack: table size update %d exceeds limit %d", size, d.allowedMaxSize)
+			}
+			d.table.setMaxSize(uint32(size))
+
+		default:
+			// Both "never indexed" (0001) and "without
+			// indexing" (0000) use a 4-bit prefix.
+			hf, rest, err := d.readLiteral(block, 4)
+			if err != nil {
+				return nil, err
+			}
+			block = rest
+
+			hf.Sensitive = first&0xf0 == 0x10
+			if err := addField(hf); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+// A literal either refers to the name by an index
+// (non-zero prefix) or carries the name as a string.
+func (d *Decoder) readLiteral(block []byte, prefixBits uint8) (HeaderField, []byte, error) {
+	var hf HeaderField
+
+	nameIndex, rest, err := readInteger(block, prefixBits)
+	if err != nil {
+		return hf, nil, err
+	}
+
+	if nameIndex == 0 {
+		hf.Name, rest, err = readString(rest)
+		if err != nil {
+			return hf, nil, err
+		}
+	} else {
+		indexed, err := d.field(nameIndex)
+		if err != nil {
+			return hf, nil, err
+		}
+		hf.Name = indexed.Name
+	}
+
+	hf.Value, rest, err = readString(rest)
+	if err != nil {
+		return hf, nil, err
+	}
+
+	return hf, rest, nil
+}
+
+/*
+Integers are encoded with an N-bit prefix (RFC 7541 5.1).
+If the value fits in the prefix, it's the value.
+Otherwise the prefix is all ones and the rest of the
+value follows in 7-bit groups, least significant first,
+with the MSB of each byte showing if more bytes follow.
+*/
+func readInteger(block []byte, prefixBits uint8) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, errTruncated
+	}
+
+	maxPrefix := uint64(1)<<prefixBits - 1
+	value := uint64(block[0]) & maxPrefix
+	block = block[1:]
+
+	if value < maxPrefix {
+		return value, block, nil
+	}
+
+	var shift uint
+	for {
+		if len(block) == 0 {
+			return 0, nil, errTruncated
+		}
+		if shift > 56 {
+			return 0, nil, errIntegerOverflow
+		}
+
+		b := block[0]
+		block = block[1:]
+
+		value += uint64(b&0x7f) << shift
+		shift += 7
+
+		if b&0x80 == 0 {
+			return value, block, nil
+		}
+	}
+}
+
+func appendInteger(dst []byte, firstByteFlags byte, prefixBits uint8, value uint64) []byte {
+	maxPrefix := uint64(1)<<prefixBits - 1
+
+	if value < maxPrefix {
+		return append(dst, firstByteFlags|byte(value))
+	}
+
+	dst = append(dst, firstByteFlags|byte(maxPrefix))
+	value -= maxPrefix
+
+	for value >= 0x80 {
+		dst = append(dst, byte(value&0x7f)|0x80)
+		value >>= 7
+	}
+
+	return append(dst, byte(value))
+}
+
+// String literals have 1 bit for Huffman (H) and
+// a 7-bit prefix integer for the length.
+func readString(block []byte) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, errTruncated
+	}
+
+	isHuffman := block[0]&0x80 != 0
+	strLen, rest, err := readInteger(block, 7)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if uint64(len(rest)) < strLen {
+		return "", nil, errTruncated
+	}
+
+	raw := rest[:strLen]
+	rest = rest[strLen:]
+
+	if !isHuffman {
+		return string(raw), rest, nil
+	}
+
+	decoded, err := huffmanDecode(raw)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return decoded, rest, nil
+}
+
+// Huffman is only used when it actually makes
+// the string shorter.
+func appendString(dst []byte, s string) []byte {
+	huffmanLen := huffmanEncodedLen(s)
+
+	if huffmanLen < len(s) {
+		dst = appendInteger(dst, 0x80, 7, uint64(huffmanLen))
+		return huffmanEncode(dst, s)
+	}
+
+	dst = appendInteger(dst, 0, 7, uint64(len(s)))
+	return append(dst, s...)
+}
+
+/*
+The encoder never inserts into the dynamic table,
+so the server never needs to keep any state for
+our requests. Since a client sends very few requests
+per connection, this only costs a few bytes.
+*/
+type Encoder struct{}
+
+func NewEncoder() Encoder {
+	return Encoder{}
+}
+
+func staticIndex(hf HeaderField) (nameIndex, fieldIndex uint64) {
+	for i, entry := range staticTable {
+		if entry.Name != hf.Name {
+			continue
+		}
+
+		if nameIndex == 0 {
+			nameIndex = uint64(i + 1)
+		}
+
+		if entry.Value == hf.Value {
+			return nameIndex, uint64(i + 1)
+		}
+	}
+
+	return nameIndex, 0
+}
+
+func (e Encoder) Encode(fields []HeaderField) []byte {
+	block := make([]byte, 0, 64)
+
+	for _, hf := range fields {
+		nameIndex, fieldIndex := staticIndex(hf)
+
+		if fieldIndex != 0 && !hf.Sensitive {
+			block = appendInteger(block, 0x80, 7, fieldIndex)
+			continue
+		}
+
+		flags := byte(0x00)
+		if hf.Sensitive {
+			flags = 0x10
+		}
+
+		block = appendInteger(block, flags, 4, nameIndex)
+		if nameIndex == 0 {
+			block = appendString(block, hf.Name)
+		}
+		block = appendString(block, hf.Value)
+	}
+
+	return block
+}
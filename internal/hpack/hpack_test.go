@@ -0,0 +1,159 @@
+package hpack
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func assertFields(t *testing.T, expected, got []HeaderField) {
+	t.Helper()
+
+	if len(expected) != len(got) {
+		t.Fatalf("expected %d fields\tgot: %d (%v)", len(expected), len(got), got)
+	}
+
+	for i := range expected {
+		if expected[i].Name != got[i].Name || expected[i].Value != got[i].Value {
+			t.Fatalf("field %d expected: %v\tgot: %v", i, expected[i], got[i])
+		}
+	}
+}
+
+// Examples of RFC 7541 Appendix C.4 (requests with Huffman)
+func TestDecodeRFCRequestExamples(t *testing.T) {
+	d := NewDecoder(DefaultDynamicTableSize)
+
+	tests := []struct {
+		name     string
+		block    string
+		expected []HeaderField
+	}{
+		{
+			name:  "first_request",
+			block: "8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff",
+			expected: []HeaderField{
+				{Name: ":method", Value: "GET"},
+				{Name: ":scheme", Value: "http"},
+				{Name: ":path", Value: "/"},
+				{Name: ":authority", Value: "www.example.com"},
+			},
+		},
+		{
+			name:  "second_request_uses_dynamic_table",
+			block: "8286 84be 5886 a8eb 1064 9cbf",
+			expected: []HeaderField{
+				{Name: ":method", Value: "GET"},
+				{Name: ":scheme", Value: "http"},
+				{Name: ":path", Value: "/"},
+				{Name: ":authority", Value: "www.example.com"},
+				{Name: "cache-control", Value: "no-cache"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := d.Decode(mustDecodeHex(t, test.block))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertFields(t, test.expected, fields)
+		})
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	fields := []HeaderField{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":path", Value: "/api/people/1?q=a%20b"},
+		{Name: ":authority", Value: "swapi.dev"},
+		{Name: "user-agent", Value: "gurl/1.0.0"},
+		{Name: "authorization", Value: "Bearer secret", Sensitive: true},
+		{Name: "x-custom-header", Value: strings.Repeat("z", 200)},
+	}
+
+	block := NewEncoder().Encode(fields)
+
+	got, err := NewDecoder(DefaultDynamicTableSize).Decode(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertFields(t, fields, got)
+
+	if !got[5].Sensitive {
+		t.Fatal("expected authorization to stay never indexed")
+	}
+}
+
+func TestDecodeInvalidBlocks(t *testing.T) {
+	tests := []struct {
+		name  string
+		block string
+	}{
+		{name: "index_zero", block: "80"},
+		{name: "index_out_of_range", block: "ff00"},
+		{name: "truncated_string", block: "4088"},
+		{name: "table_size_over_limit", block: "3fe21f"},
+		// :method GET, then a size update
+		{name: "table_size_update_after_field", block: "8220"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewDecoder(DefaultDynamicTableSize).Decode(mustDecodeHex(t, test.block)); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestDecodeTableSizeUpdateAtStart(t *testing.T) {
+	// Two updates (0 then 4096) before :method GET
+	got, err := NewDecoder(DefaultDynamicTableSize).Decode(mustDecodeHex(t, "203fe11f82"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != ":method" || got[0].Value != "GET" {
+		t.Fatalf("expected: [:method GET]\tgot: %v", got)
+	}
+}
+
+func TestDecodeMaxHeaderListSize(t *testing.T) {
+	// :method GET and :path / are 42 and 38 bytes
+	block := mustDecodeHex(t, "8284")
+
+	tests := []struct {
+		name        string
+		maxSize     uint32
+		expectedErr bool
+	}{
+		{name: "no_limit", maxSize: 0},
+		{name: "exact", maxSize: 80},
+		{name: "over", maxSize: 79, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := NewDecoder(DefaultDynamicTableSize)
+			d.SetMaxHeaderListSize(test.maxSize)
+
+			_, err := d.Decode(block)
+			if test.expectedErr != errors.Is(err, ErrHeaderListTooLarge) {
+				t.Fatalf("expected: %v\tgot: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
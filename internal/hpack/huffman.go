@@ -0,0 +1,114 @@
+package hpack
+
+import (
+	"errors"
+	"strings"
+)
+
+var errInvalidHuffman = errors.New("hpack: invalid huffman encoded string")
+
+type huffmanNode struct {
+	children [2]*huffmanNode
+	isLeaf   bool
+	sym      byte
+}
+
+var huffmanRoot = buildHuffmanTree()
+
+// Each code is inserted bit by bit (most significant
+// first) so walking the tree with the encoded bits
+// lands on the leaf holding the octet.
+func buildHuffmanTree() *huffmanNode {
+	root := &huffmanNode{}
+
+	for sym, code := range huffmanCodes {
+		node := root
+		codeLen := huffmanCodeLen[sym]
+
+		for i := int(codeLen) - 1; i >= 0; i-- {
+			bit := (code >> uint(i)) & 1
+			if node.children[bit] == nil {
+				node.children[bit] = &huffmanNode{}
+			}
+			node = node.children[bit]
+		}
+
+		node.isLeaf = true
+		node.sym = byte(sym)
+	}
+
+	return root
+}
+
+func huffmanDecode(encoded []byte) (string, error) {
+	sb := strings.Builder{}
+	sb.Grow(len(encoded) * 8 / 5)
+
+	node := huffmanRoot
+	// Bits consumed since the last decoded octet. Those
+	// must be the padding at the end of the string.
+	var pendingBits int
+	paddingAllOnes := true
+
+	for _, b := range encoded {
+		for i := 7; i >= 0; i-- {
+			bit := (b >> uint(i)) & 1
+			node = node.children[bit]
+			if node == nil {
+				return "", errInvalidHuffman
+			}
+
+			pendingBits++
+			if bit == 0 {
+				paddingAllOnes = false
+			}
+
+			if node.isLeaf {
+				sb.WriteByte(node.sym)
+				node = huffmanRoot
+				pendingBits = 0
+				paddingAllOnes = true
+			}
+		}
+	}
+
+	// Padding is the most significant bits of EOS
+	// (all ones) and strictly shorter than 8 bits.
+	if pendingBits > 7 || !paddingAllOnes {
+		return "", errInvalidHuffman
+	}
+
+	return sb.String(), nil
+}
+
+func huffmanEncodedLen(s string) int {
+	var bits int
+	for i := 0; i < len(s); i++ {
+		bits += int(huffmanCodeLen[s[i]])
+	}
+	return (bits + 7) / 8
+}
+
+func huffmanEncode(dst []byte, s string) []byte {
+	var acc uint64
+	var accBits uint
+
+	for i := 0; i < len(s); i++ {
+		codeLen := uint(huffmanCodeLen[s[i]])
+		acc = acc<<codeLen | uint64(huffmanCodes[s[i]])
+		accBits += codeLen
+
+		for accBits >= 8 {
+			accBits -= 8
+			dst = append(dst, byte(acc>>accBits))
+		}
+	}
+
+	// Pad the last octet with the prefix of EOS (ones)
+	if accBits > 0 {
+		acc = acc<<(8-accBits) | (1<<(8-accBits) - 1)
+		dst = append(dst, byte(acc))
+	}
+
+	return dst
+}
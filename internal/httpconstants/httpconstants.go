@@ -26,3 +26,30 @@ const (
 	DataTypeText
 	DataTypeImage
 )
+
+// HTTPVersionNegotiate lets the server pick with
+// ALPN (h2 preferred, falling back to HTTP/1.1).
+//
+// Without TLS, HTTPVersion2 upgrades from HTTP/1.1
+// (Upgrade: h2c) while HTTPVersion2PriorKnowledge
+// starts with HTTP/2 right away.
+const (
+	HTTPVersionNegotiate uint8 = iota
+	HTTPVersion1_1
+	HTTPVersion2
+	HTTPVersion2PriorKnowledge
+)
+
+const (
+	ALPNHTTP1_1 = "http/1.1"
+	ALPNHTTP2   = "h2"
+)
+
+const (
+	AuthSchemeBasic  = "Basic"
+	AuthSchemeDigest = "Digest"
+	AuthSchemeBearer = "Bearer"
+)
+
+// Transient status codes retried by default
+var DefaultRetryStatusCodes = []string{"408", "429", "500", "502", "503", "504"}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/saeidalz13/gurl/api/apperrors"
 	"github.com/saeidalz13/gurl/internal/httpconstants"
 )
 
@@ -13,7 +14,7 @@ func ParseMethod(rawMethod string) (string, error) {
 
 	_, ok := httpconstants.ValidHttpMethods[method]
 	if !ok {
-		return "", fmt.Errorf("invalid method: %s", method)
+		return "", apperrors.UsageError{Reason: fmt.Sprintf("invalid method: %s", method)}
 	}
 
 	return method, nil
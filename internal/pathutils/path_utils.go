@@ -3,17 +3,60 @@ package pathutils
 import (
 	"os"
 	"path/filepath"
-
-	"github.com/saeidalz13/gurl/internal/errutils"
 )
 
-func MustMakeIpCacheDir() string {
+// Creates the directory under ~/.gurl if
+// it doesn't exist and returns its path.
+func makeGurlDir(elem ...string) (string, error) {
 	homeDir, err := os.UserHomeDir()
-	errutils.CheckErr(err)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(append([]string{homeDir, ".gurl"}, elem...)...)
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func MakeIpCacheDir() (string, error) {
+	return makeGurlDir("ipcache")
+}
 
-	ipCacheDir := filepath.Join(homeDir, ".gurl", "ipcache")
+// TLS session tickets are secrets (they allow
+// resuming a session), so the directory is only
+// accessible by the owner.
+func MakeTLSSessionCacheDir() (string, error) {
+	return makeGurlDir("tlssessions")
+}
+
+func MakeCookieJarPath() (string, error) {
+	gurlDir, err := makeGurlDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(gurlDir, "cookies.txt"), nil
+}
+
+func MakeConfigPath() (string, error) {
+	gurlDir, err := makeGurlDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(gurlDir, "config"), nil
+}
 
-	os.MkdirAll(ipCacheDir, 0o700)
+// Lines typed in the WebSocket prompt
+func MakeWsHistoryPath() (string, error) {
+	gurlDir, err := makeGurlDir()
+	if err != nil {
+		return "", err
+	}
 
-	return ipCacheDir
+	return filepath.Join(gurlDir, "ws_history"), nil
 }
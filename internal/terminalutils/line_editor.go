@@ -0,0 +1,404 @@
+package terminalutils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// Older lines of the history file are dropped
+const maxHistoryLines = 1000
+
+// Key codes of the terminal in raw mode
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyCtrlH     = 0x08
+	keyCtrlK     = 0x0b
+	keyCtrlL     = 0x0c
+	keyEnter     = 0x0d
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+)
+
+// ANSI sequences for drawing the input line
+const (
+	eraseLine   = "\r\033[K"
+	clearScreen = "\033[H\033[2J"
+)
+
+/*
+Reads the lines of the WebSocket prompt with editing
+like readline:
+
+	Left/Right, Ctrl-B/Ctrl-F    move the cursor
+	Home/End, Ctrl-A/Ctrl-E      start and end of the line
+	Up/Down, Ctrl-P/Ctrl-N       previous and next line of the history
+	Backspace, Delete            delete a character
+	Ctrl-U/Ctrl-K                delete before and after the cursor
+	Ctrl-W                       delete the word before the cursor
+	Ctrl-L                       clear the screen
+	Ctrl-D                       end of input on an empty line
+
+Entered lines are appended to historyFile (if set),
+so they are available in the next session too.
+*/
+type LineEditor struct {
+	in          *bufio.Reader
+	out         io.Writer
+	prompt      string
+	historyFile string
+	history     []string
+
+	// Drawing of the line is shared with the output
+	// of the session (see aboveInput).
+	mu      sync.Mutex
+	buf     []rune
+	cursor  int
+	reading bool
+	restore func() error
+}
+
+func NewLineEditor(in io.Reader, out io.Writer, prompt, historyFile string) *LineEditor {
+	return &LineEditor{
+		in:          bufio.NewReader(in),
+		out:         out,
+		prompt:      prompt,
+		historyFile: historyFile,
+		history:     loadHistory(historyFile),
+	}
+}
+
+// Set while the prompt is shown in the terminal
+var activeEditor atomic.Pointer[LineEditor]
+
+// Stdin and stderr must both be terminals, since the
+// line is typed in one and drawn on the other.
+func CanEditLines() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stderr) && os.Getenv("TERM") != "dumb"
+}
+
+/*
+Puts the terminal in raw mode for the prompt and
+shows the output of the session above the line.
+Close must be called to restore the terminal.
+*/
+func StartLineEditor(historyFile string) (*LineEditor, error) {
+	restore, err := makeRaw(os.Stdin.Fd())
+	if err != nil {
+		return nil, err
+	}
+
+	t := StderrTheme()
+	e := NewLineEditor(os.Stdin, os.Stderr, t.WsClient+">"+t.Reset()+" ", historyFile)
+	e.restore = restore
+	activeEditor.Store(e)
+	return e, nil
+}
+
+// The line being typed is removed from the terminal
+func (e *LineEditor) Close() error {
+	activeEditor.CompareAndSwap(e, nil)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.reading {
+		fmt.Fprint(e.out, eraseLine)
+		e.reading = false
+	}
+	if e.restore == nil {
+		return nil
+	}
+	return e.restore()
+}
+
+/*
+Output printed while the line is shown goes above
+it: the line is erased, print runs and the line is
+drawn again with the cursor where it was.
+*/
+func aboveInput(print func()) {
+	e := activeEditor.Load()
+	if e == nil {
+		print()
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.reading {
+		print()
+		return
+	}
+	fmt.Fprint(e.out, eraseLine)
+	print()
+	e.redraw()
+}
+
+// Lines printed during a WebSocket session
+func wsPrintf(w io.Writer, format string, a ...any) {
+	aboveInput(func() { fmt.Fprintf(w, format, a...) })
+}
+
+// Clears the terminal, e.g. for /clear
+func ClearScreen() {
+	if !isTerminal(os.Stderr) {
+		return
+	}
+	aboveInput(func() { fmt.Fprint(os.Stderr, clearScreen) })
+}
+
+/*
+Returns the next line that isn't empty, without the
+line ending. The line is erased from the terminal once
+entered, since the session prints it as sent. io.EOF
+is returned for Ctrl-D on an empty line.
+*/
+func (e *LineEditor) ReadLine() ([]byte, error) {
+	e.mu.Lock()
+	e.buf, e.cursor, e.reading = e.buf[:0], 0, true
+	e.redraw()
+	e.mu.Unlock()
+
+	historyIdx := len(e.history)
+	// The line being typed when going up the history
+	var draft []rune
+
+	for {
+		// Read without the lock, so the session can
+		// print while waiting for a key.
+		r, seq, err := e.readKey()
+		if err != nil {
+			e.stopReading()
+			return nil, err
+		}
+
+		e.mu.Lock()
+		switch r {
+		case keyEnter, '\n':
+			line := string(e.buf)
+			if strings.TrimSpace(line) == "" {
+				e.buf, e.cursor = e.buf[:0], 0
+				break
+			}
+			e.mu.Unlock()
+			e.stopReading()
+			e.addHistory(line)
+			return []byte(line), nil
+
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				e.mu.Unlock()
+				e.stopReading()
+				return nil, io.EOF
+			}
+			e.deleteAt(e.cursor)
+
+		case keyBackspace, keyCtrlH:
+			if e.cursor > 0 {
+				e.cursor--
+				e.deleteAt(e.cursor)
+			}
+
+		case keyCtrlA:
+			e.cursor = 0
+		case keyCtrlE:
+			e.cursor = len(e.buf)
+		case keyCtrlB:
+			e.cursor = max(e.cursor-1, 0)
+		case keyCtrlF:
+			e.cursor = min(e.cursor+1, len(e.buf))
+		case keyCtrlK:
+			e.buf = e.buf[:e.cursor]
+		case keyCtrlU:
+			e.buf = append(e.buf[:0], e.buf[e.cursor:]...)
+			e.cursor = 0
+		case keyCtrlW:
+			e.deleteWord()
+		case keyCtrlL:
+			fmt.Fprint(e.out, clearScreen)
+
+		case keyCtrlP, keyCtrlN:
+			historyIdx, draft = e.moveHistory(historyIdx, r == keyCtrlP, draft)
+
+		case keyEscape:
+			historyIdx, draft = e.escapeSequence(seq, historyIdx, draft)
+
+		default:
+			if unicode.IsPrint(r) || r == '\t' {
+				e.buf = append(e.buf[:e.cursor], append([]rune{r}, e.buf[e.cursor:]...)...)
+				e.cursor++
+			}
+		}
+		e.redraw()
+		e.mu.Unlock()
+	}
+}
+
+/*
+Arrows and the navigation keys send ESC [ or ESC O
+followed by a letter, or by a number and '~', e.g.
+ESC [ A for Up and ESC [ 3 ~ for Delete. seq is what
+follows ESC, e.g. "[3~".
+*/
+func (e *LineEditor) readKey() (rune, string, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, "", err
+	}
+
+	var seq strings.Builder
+	for {
+		b, err := e.in.ReadByte()
+		if err != nil {
+			return r, "", err
+		}
+		seq.WriteByte(b)
+
+		switch {
+		case seq.Len() == 1 && b != '[' && b != 'O':
+			// e.g. Alt with a key, which is ignored
+			return r, "", nil
+		case seq.Len() > 1 && (b < '0' || b > '9') && b != ';':
+			return r, seq.String(), nil
+		}
+	}
+}
+
+func (e *LineEditor) escapeSequence(seq string, historyIdx int, draft []rune) (int, []rune) {
+	if len(seq) < 2 {
+		return historyIdx, draft
+	}
+
+	switch seq[1:] {
+	case "A":
+		return e.moveHistory(historyIdx, true, draft)
+	case "B":
+		return e.moveHistory(historyIdx, false, draft)
+	case "C":
+		e.cursor = min(e.cursor+1, len(e.buf))
+	case "D":
+		e.cursor = max(e.cursor-1, 0)
+	case "H", "1~", "7~":
+		e.cursor = 0
+	case "F", "4~", "8~":
+		e.cursor = len(e.buf)
+	case "3~":
+		e.deleteAt(e.cursor)
+	}
+	return historyIdx, draft
+}
+
+// The typed line is kept as draft so coming back
+// down the history shows it again.
+func (e *LineEditor) moveHistory(historyIdx int, up bool, draft []rune) (int, []rune) {
+	switch {
+	case up && historyIdx > 0:
+		if historyIdx == len(e.history) {
+			draft = append([]rune(nil), e.buf...)
+		}
+		historyIdx--
+		e.buf = []rune(e.history[historyIdx])
+	case !up && historyIdx < len(e.history)-1:
+		historyIdx++
+		e.buf = []rune(e.history[historyIdx])
+	case !up && historyIdx == len(e.history)-1:
+		historyIdx++
+		e.buf = append(e.buf[:0], draft...)
+	}
+	e.cursor = len(e.buf)
+	return historyIdx, draft
+}
+
+func (e *LineEditor) deleteAt(i int) {
+	if i < len(e.buf) {
+		e.buf = append(e.buf[:i], e.buf[i+1:]...)
+	}
+}
+
+// Spaces before the cursor go with the word
+func (e *LineEditor) deleteWord() {
+	start := e.cursor
+	for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	e.buf = append(e.buf[:start], e.buf[e.cursor:]...)
+	e.cursor = start
+}
+
+// Must be called with mu held
+func (e *LineEditor) redraw() {
+	fmt.Fprint(e.out, eraseLine+e.prompt+string(e.buf))
+	if back := len(e.buf) - e.cursor; back > 0 {
+		fmt.Fprintf(e.out, "\033[%dD", back)
+	}
+}
+
+func (e *LineEditor) stopReading() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	fmt.Fprint(e.out, eraseLine)
+	e.reading = false
+}
+
+// The same line twice in a row is kept once
+func (e *LineEditor) addHistory(line string) {
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+
+	if e.historyFile == "" {
+		return
+	}
+	// Messages may have tokens, so only the owner
+	// can read the file.
+	f, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// A missing or unreadable file means no history.
+// The file is cut to the last maxHistoryLines.
+func loadHistory(historyFile string) []string {
+	if historyFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(historyFile)
+	if err != nil {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	if len(lines) > maxHistoryLines {
+		lines = lines[len(lines)-maxHistoryLines:]
+		_ = os.WriteFile(historyFile, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+	}
+	return lines
+}
+
+// The terminal can't be put in raw mode on this OS
+var errRawModeUnsupported = errors.New("line editing is not supported on this platform")
@@ -0,0 +1,115 @@
+package terminalutils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineEditorReadLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		history  string
+		keys     string
+		expected string
+	}{
+		{name: "plain", keys: "hello world\r", expected: "hello world"},
+		{name: "new_line", keys: "hello\n", expected: "hello"},
+		{name: "empty_lines_skipped", keys: "\r  \rhi\r", expected: "hi"},
+		{name: "backspace", keys: "helxx\x7f\x7flo\r", expected: "hello"},
+		{name: "arrows", keys: "hlo\x1b[D\x1b[Del\r", expected: "hello"},
+		{name: "home_end", keys: "ello\x1b[Hh\x1b[F!\r", expected: "hello!"},
+		{name: "ctrl_a_ctrl_e", keys: "b\x01a\x05c\r", expected: "abc"},
+		{name: "delete", keys: "hxello\x01\x1b[C\x1b[3~\r", expected: "hello"},
+		{name: "ctrl_k", keys: "hello world\x01\x06\x06\x06\x06\x06\x0b\r", expected: "hello"},
+		{name: "ctrl_u", keys: "junk hello\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x15\x05\r", expected: "hello"},
+		{name: "ctrl_w", keys: "hello big  world  \x17\x17world\r", expected: "hello world"},
+		{name: "unicode", keys: "héllo\x7f\x7f\x7f\x7fi\r", expected: "hi"},
+		{name: "history_up", history: "first\nsecond\n", keys: "\x1b[A\x1b[A\r", expected: "first"},
+		{name: "history_down_to_draft", history: "first\n", keys: "dra\x1b[A\x1b[Bft\r", expected: "draft"},
+		{name: "history_ctrl_p", history: "first\nsecond\n", keys: "\x10!\r", expected: "second!"},
+		{name: "history_edit", history: "hello\n", keys: "\x1b[A\x7f\x7fp\r", expected: "help"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			historyFile := filepath.Join(t.TempDir(), "ws_history")
+			if test.history != "" {
+				if err := os.WriteFile(historyFile, []byte(test.history), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			e := NewLineEditor(strings.NewReader(test.keys), io.Discard, "> ", historyFile)
+			got, err := e.ReadLine()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestLineEditorEOF(t *testing.T) {
+	e := NewLineEditor(strings.NewReader("ab\x04\x04\x7f\x04"), io.Discard, "> ", "")
+
+	// Ctrl-D deletes while the line isn't empty
+	if _, err := e.ReadLine(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected: %v\tgot: %v", io.EOF, err)
+	}
+}
+
+func TestLineEditorHistoryFile(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "ws_history")
+
+	e := NewLineEditor(strings.NewReader("one\rtwo\rtwo\r"), io.Discard, "> ", historyFile)
+	for i := 0; i < 3; i++ {
+		if _, err := e.ReadLine(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The repeated line is kept once
+	if expected := "one\ntwo\n"; string(data) != expected {
+		t.Fatalf("expected: %q\tgot: %q", expected, data)
+	}
+
+	// The next session starts with the history
+	next := NewLineEditor(strings.NewReader("\x1b[A\x1b[A\r"), io.Discard, "> ", historyFile)
+	if got, err := next.ReadLine(); err != nil || string(got) != "one" {
+		t.Fatalf("expected: %q\tgot: %q %v", "one", got, err)
+	}
+}
+
+func TestLoadHistoryLimit(t *testing.T) {
+	historyFile := filepath.Join(t.TempDir(), "ws_history")
+
+	lines := make([]string, maxHistoryLines+10)
+	for i := range lines {
+		lines[i] = strings.Repeat("x", i%7+1)
+	}
+	if err := os.WriteFile(historyFile, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if history := loadHistory(historyFile); len(history) != maxHistoryLines || history[0] != lines[10] {
+		t.Fatalf("expected: %d lines from %q\tgot: %d lines", maxHistoryLines, lines[10], len(history))
+	}
+
+	data, err := os.ReadFile(historyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "\n"); got != maxHistoryLines {
+		t.Fatalf("expected: %d lines in the file\tgot: %d", maxHistoryLines, got)
+	}
+}
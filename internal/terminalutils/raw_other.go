@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package terminalutils
+
+// Lines are read without editing instead
+func makeRaw(fd uintptr) (func() error, error) {
+	return nil, errRawModeUnsupported
+}
@@ -0,0 +1,47 @@
+//go:build linux || darwin || freebsd
+
+package terminalutils
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func getTermios(fd uintptr) (syscall.Termios, error) {
+	var termios syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return termios, errno
+	}
+	return termios, nil
+}
+
+func setTermios(fd uintptr, termios syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&termios))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+/*
+Keys are read one by one without echo, so the line
+editor draws the line itself. ISIG is kept so Ctrl-C
+still closes the session, and OPOST so '\n' of the
+output still starts a new line.
+*/
+func makeRaw(fd uintptr) (func() error, error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := setTermios(fd, raw); err != nil {
+		return nil, err
+	}
+	return func() error { return setTermios(fd, old) }, nil
+}
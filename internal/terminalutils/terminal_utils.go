@@ -2,12 +2,20 @@ package terminalutils
 
 import (
 	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 )
 
-const (
+// Used by the decorations (banners, details of the
+// connection) on stderr. Variables so they can be
+// turned off (e.g. with -no-color) with DisableColors.
+var (
 	// Reset
 	FormatReset = "\033[0m"
 
@@ -82,97 +90,546 @@ const (
 	BackgroundIntenseWhite  = "\033[0;107m" // High Intensity Background White
 )
 
+var colors = []*string{
+	&FormatReset,
+	&RegularBlack,
+	&RegularRed,
+	&RegularGreen,
+	&RegularYellow,
+	&RegularBlue,
+	&RegularPurple,
+	&RegularCyan,
+	&RegularWhite,
+	&BoldBlack,
+	&BoldRed,
+	&BoldGreen,
+	&BoldYellow,
+	&BoldBlue,
+	&BoldPurple,
+	&BoldCyan,
+	&BoldWhite,
+	&UnderlineBlack,
+	&UnderlineRed,
+	&UnderlineGreen,
+	&UnderlineYellow,
+	&UnderlineBlue,
+	&UnderlinePurple,
+	&UnderlineCyan,
+	&UnderlineWhite,
+	&BackgroundBlack,
+	&BackgroundRed,
+	&BackgroundGreen,
+	&BackgroundYellow,
+	&BackgroundBlue,
+	&BackgroundPurple,
+	&BackgroundCyan,
+	&BackgroundWhite,
+	&IntenseBlack,
+	&IntenseRed,
+	&IntenseGreen,
+	&IntenseYellow,
+	&IntenseBlue,
+	&IntensePurple,
+	&IntenseCyan,
+	&IntenseWhite,
+	&BoldIntenseBlack,
+	&BoldIntenseRed,
+	&BoldIntenseGreen,
+	&BoldIntenseYellow,
+	&BoldIntenseBlue,
+	&BoldIntensePurple,
+	&BoldIntenseCyan,
+	&BoldIntenseWhite,
+	&BackgroundIntenseBlack,
+	&BackgroundIntenseRed,
+	&BackgroundIntenseGreen,
+	&BackgroundIntenseYellow,
+	&BackgroundIntenseBlue,
+	&BackgroundIntensePurple,
+	&BackgroundIntenseCyan,
+	&BackgroundIntenseWhite,
+}
+
+// Printing goes on without the ANSI codes
+func DisableColors() {
+	stdoutColors = false
+	disableStderrColors()
+}
+
+func disableStderrColors() {
+	for _, color := range colors {
+		*color = ""
+	}
+	stderrColors = false
+}
+
+var silent, showErrors bool
+
+// Warnings and progress are not printed, nor
+// errors unless showError (-s and -show-error).
+func SetSilent(showError bool) {
+	silent = true
+	showErrors = showError
+}
+
+func IsSilent() bool {
+	return silent
+}
+
+var jsonOutput bool
+
+// WebSocket sessions are printed as newline-delimited
+// JSON events (one per line) instead of colored lines.
+func EnableJSONOutput() {
+	jsonOutput = true
+	stdoutColors = false
+}
+
+type wsEvent struct {
+	Time     string  `json:"time"`
+	Type     string  `json:"type"`
+	Opcode   string  `json:"opcode,omitempty"`
+	Data     string  `json:"data,omitempty"`
+	Encoding string  `json:"encoding,omitempty"`
+	Size     int     `json:"size,omitempty"`
+	Protocol string  `json:"protocol,omitempty"`
+	File     string  `json:"file,omitempty"`
+	Code     int     `json:"code,omitempty"`
+	RTTMs    float64 `json:"rtt_ms,omitempty"`
+	Message  int     `json:"message,omitempty"`
+	Expected string  `json:"expected,omitempty"`
+	Got      string  `json:"got,omitempty"`
+}
+
+func printWsEvent(event wsEvent) {
+	event.Time = time.Now().Format(time.RFC3339Nano)
+	encoded, _ := json.Marshal(event)
+	aboveInput(func() { fmt.Println(string(encoded)) })
+}
+
 func PrintWsError(errMsg string) {
-	fmt.Printf("%s[ERROR]:%s %s", BoldRed, FormatReset, errMsg)
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: "error", Data: errMsg})
+		return
+	}
+	PrintAppError(errMsg)
+}
+
+// Binary messages longer than this are cut in
+// the hex dump of the terminal.
+const maxWsHexDumpLen = 256
+
+// Text is data as it is, binary is base64 in
+// data with "encoding": "base64".
+func wsMsgEvent(eventType string, payload []byte, isBinary bool) wsEvent {
+	if !isBinary {
+		return wsEvent{Type: eventType, Opcode: "text", Data: string(payload)}
+	}
+	return wsEvent{
+		Type:     eventType,
+		Opcode:   "binary",
+		Data:     base64.StdEncoding.EncodeToString(payload),
+		Encoding: "base64",
+		Size:     len(payload),
+	}
+}
+
+/*
+Text is printed on the same line as the label, while
+binary is shown as a hex dump (offset, hex bytes and
+the printable characters) below it, e.g.
+
+	[SERVER]: binary, 4 bytes
+	00000000  01 ff 68 69                                       |..hi|
+*/
+func printWsMsg(label, color string, payload []byte, isBinary bool) {
+	aboveInput(func() {
+		t := StdoutTheme()
+		if !isBinary {
+			fmt.Printf("%s[%s]:%s %s\n", color, label, t.Reset(), payload)
+			return
+		}
+
+		fmt.Printf("%s[%s]:%s binary, %d bytes\n", color, label, t.Reset(), len(payload))
+		if len(payload) > maxWsHexDumpLen {
+			fmt.Print(hex.Dump(payload[:maxWsHexDumpLen]))
+			fmt.Printf("... %d more bytes\n", len(payload)-maxWsHexDumpLen)
+			return
+		}
+		fmt.Print(hex.Dump(payload))
+	})
+}
+
+func PrintWsServerMsg(payload []byte, isBinary bool) {
+	if jsonOutput {
+		printWsEvent(wsMsgEvent("received", payload, isBinary))
+		return
+	}
+	printWsMsg("SERVER", StdoutTheme().WsServer, payload, isBinary)
+}
+
+func PrintWsClientMsg(payload []byte, isBinary bool) {
+	if jsonOutput {
+		printWsEvent(wsMsgEvent("sent", payload, isBinary))
+		return
+	}
+	printWsMsg("CLIENT", StdoutTheme().WsClient, payload, isBinary)
+}
+
+// Binary message of the server saved to a file
+// instead of being printed.
+func PrintWsBinarySaved(path string, size int) {
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: "received", Opcode: "binary", Size: size, File: path})
+		return
+	}
+	t := StdoutTheme()
+	wsPrintf(os.Stdout, "%s[SERVER]:%s binary, %d bytes saved to %s\n", t.WsServer, t.Reset(), size, path)
+}
+
+// Open and close are only events of the JSON output;
+// the terminal shows them by the prompt and the error.
+func PrintWsOpen(url, subprotocol string) {
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: "open", Data: url, Protocol: subprotocol})
+	}
+}
+
+func PrintWsClose(reason string) {
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: "close", Data: reason})
+	}
+}
+
+// Subprotocol selected by the server in the handshake
+func PrintWsSubprotocol(subprotocol string) {
+	t := StderrTheme()
+	fmt.Fprintf(os.Stderr, "%s[PROTOCOL]:%s %s\n", t.WsServer, t.Reset(), subprotocol)
+}
+
+// permessage-deflate parameters agreed in the handshake
+func PrintWsCompression(negotiated bool, params string) {
+	t := StderrTheme()
+	if !negotiated {
+		fmt.Fprintf(os.Stderr, "%s[DEFLATE]:%s not negotiated, messages are not compressed\n", t.WsServer, t.Reset())
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s[DEFLATE]:%s permessage-deflate; %s\n", t.WsServer, t.Reset(), params)
+}
+
+// Ping received from the server
+func PrintWsPing(payload string) {
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: "ping", Data: payload})
+		return
+	}
+	t := StderrTheme()
+	wsPrintf(os.Stderr, "%s[PING]:%s %s\n", t.WsServer, t.Reset(), payload)
+}
+
+// Round trip time is zero for pongs that don't
+// answer a ping of the client.
+func PrintWsPong(payload string, rtt time.Duration) {
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: "pong", Data: payload, RTTMs: float64(rtt) / float64(time.Millisecond)})
+		return
+	}
+
+	t := StderrTheme()
+	if rtt == 0 {
+		wsPrintf(os.Stderr, "%s[PONG]:%s %s\n", t.WsServer, t.Reset(), payload)
+		return
+	}
+	wsPrintf(os.Stderr, "%s[PONG]:%s %s in %s\n", t.WsServer, t.Reset(), payload, formatMillis(rtt))
+}
+
+// Close frame sent by the client or the server
+func PrintWsCloseFrame(sent bool, code int, reason string) {
+	eventType, role, color := "close_received", "server", StderrTheme().WsServer
+	if sent {
+		eventType, role, color = "close_sent", "client", StderrTheme().WsClient
+	}
+
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: eventType, Code: code, Data: reason})
+		return
+	}
+	wsPrintf(os.Stderr, "%s[CLOSE]:%s %s sent %s\n", color, StderrTheme().Reset(), role, strings.TrimSpace(fmt.Sprintf("%d %s", code, reason)))
 }
 
-func PrintWsServerMsg(msg string) {
-	fmt.Printf("%s[SERVER]:%s %s\n", BoldCyan, FormatReset, msg)
+/*
+Message of the server that differs from the recording
+being replayed, e.g.
+
+	[DIFF]: message 2
+	  - "expected"
+	  + "got"
+
+expected is empty for a message that wasn't in the
+recording, got for one that never arrived.
+*/
+func PrintWsReplayDiff(message int, expected, got string) {
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: "diff", Message: message, Expected: expected, Got: got})
+		return
+	}
+
+	t := StdoutTheme()
+	aboveInput(func() {
+		fmt.Printf("%s[DIFF]:%s message %d\n", t.Warning, t.Reset(), message)
+		if expected != "" {
+			fmt.Printf("  %s- %s%s\n", t.Error, expected, t.Reset())
+		} else {
+			fmt.Println("  - (not in the recording)")
+		}
+		if got != "" {
+			fmt.Printf("  %s+ %s%s\n", t.WsServer, got, t.Reset())
+		} else {
+			fmt.Println("  + (not received)")
+		}
+	})
 }
 
-func PrintWsClientMsg(msg string) {
-	fmt.Printf("%s[CLIENT]:%s %s\n", BoldGreen, FormatReset, msg)
+func PrintWsReplaySummary(matched, total int) {
+	if jsonOutput {
+		printWsEvent(wsEvent{Type: "replay", Data: fmt.Sprintf("%d of %d messages matched", matched, total)})
+		return
+	}
+	t := StdoutTheme()
+	wsPrintf(os.Stdout, "%s[REPLAY]:%s %d of %d messages matched the recording\n", t.WsServer, t.Reset(), matched, total)
 }
 
 func PrintHTTPClientInfo(ip, httpRequest string) {
-	fmt.Printf("%s\n[To Server] >>%s\n", BoldWhite, FormatReset)
+	fmt.Fprintf(os.Stderr, "%s\n[To Server] >>%s\n", BoldWhite, FormatReset)
 
-	fmt.Printf("%s\nServer Details%s\n", BoldPurple, FormatReset)
-	fmt.Println("---------------------")
-	fmt.Printf("%sServer IP:%s %s\n", RegularPurple, FormatReset, ip)
+	fmt.Fprintf(os.Stderr, "%s\nServer Details%s\n", BoldPurple, FormatReset)
+	fmt.Fprintln(os.Stderr, "---------------------")
+	fmt.Fprintf(os.Stderr, "%sServer IP:%s %s\n", RegularPurple, FormatReset, ip)
 	// Other details
-	fmt.Print("\n")
+	fmt.Fprint(os.Stderr, "\n")
 
-	fmt.Printf("%sRequest%s\n", BoldGreen, FormatReset)
-	fmt.Println("---------------------")
-	fmt.Print(httpRequest)
+	fmt.Fprintf(os.Stderr, "%sRequest%s\n", BoldGreen, FormatReset)
+	fmt.Fprintln(os.Stderr, "---------------------")
+	fmt.Fprint(os.Stderr, httpRequest)
 
 	// If the request didn't have body, it wouldn't
 	// end with new line character.
 	if httpRequest[len(httpRequest)-1] != '\n' {
-		fmt.Print("\n\n")
+		fmt.Fprint(os.Stderr, "\n\n")
 	}
-	fmt.Printf("%s[From Server] <<%s\n", BoldWhite, FormatReset)
+	fmt.Fprintf(os.Stderr, "%s[From Server] <<%s\n", BoldWhite, FormatReset)
 }
 
 func PrintWebSocketClientInfo(ip, wsRequest string) {
-	fmt.Printf("%s\n[To Server] >>%s\n", BoldWhite, FormatReset)
+	fmt.Fprintf(os.Stderr, "%s\n[To Server] >>%s\n", BoldWhite, FormatReset)
 
-	fmt.Printf("%s\nDetails%s\n", BoldPurple, FormatReset)
-	fmt.Println("---------------------")
-	fmt.Printf("%sServer IP:%s %s\n", RegularPurple, FormatReset, ip)
+	fmt.Fprintf(os.Stderr, "%s\nDetails%s\n", BoldPurple, FormatReset)
+	fmt.Fprintln(os.Stderr, "---------------------")
+	fmt.Fprintf(os.Stderr, "%sServer IP:%s %s\n", RegularPurple, FormatReset, ip)
 	// Other details
-	fmt.Print("\n")
+	fmt.Fprint(os.Stderr, "\n")
+
+	fmt.Fprintf(os.Stderr, "%sRequest%s\n", BoldGreen, FormatReset)
+	fmt.Fprintln(os.Stderr, "---------------------")
+	fmt.Fprint(os.Stderr, wsRequest)
+
+	fmt.Fprintf(os.Stderr, "%s[From Server] <<%s\n\n", BoldWhite, FormatReset)
+	fmt.Fprintf(os.Stderr, "%sResponse%s\n", BoldCyan, FormatReset)
+	fmt.Fprintln(os.Stderr, "---------------------")
+}
+
+/*
+Status line and headers of a 101 Switching Protocols
+response (h2c upgrade or WebSocket handshake), which
+are read before the new protocol takes over.
+*/
+func PrintSwitchingProtocols(header string) {
+	if silent || jsonOutput {
+		return
+	}
+
+	t := StderrTheme()
+	lines := strings.Split(strings.TrimSuffix(header, "\r\n\r\n"), "\r\n")
+	fmt.Fprintln(os.Stderr, lines[0])
+	for _, line := range lines[1:] {
+		name, value, _ := strings.Cut(line, ":")
+		fmt.Fprintf(os.Stderr, "%s%s%s:%s\n", t.Header, name, t.Reset(), value)
+	}
+	fmt.Fprint(os.Stderr, "\n")
+}
 
-	fmt.Printf("%sRequest%s\n", BoldGreen, FormatReset)
-	fmt.Println("---------------------")
-	fmt.Print(wsRequest)
+func PrintTLSSessionInfo(resumed bool) {
+	if resumed {
+		fmt.Fprintf(os.Stderr, "%s[TLS]:%s session resumed from cache\n", BoldBlue, FormatReset)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s[TLS]:%s full handshake (new session)\n", BoldBlue, FormatReset)
+}
 
-	fmt.Printf("%s[From Server] <<%s\n\n", BoldWhite, FormatReset)
-	fmt.Printf("%sResponse%s\n", BoldCyan, FormatReset)
-	fmt.Println("---------------------")
+func PrintProxyInfo(proxyAddr string, tunnel bool) {
+	if tunnel {
+		fmt.Fprintf(os.Stderr, "%s[PROXY]:%s tunnel through %s\n", BoldBlue, FormatReset, proxyAddr)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s[PROXY]:%s requests forwarded by %s\n", BoldBlue, FormatReset, proxyAddr)
 }
 
+func PrintHTTP2Frame(outgoing bool, frame string) {
+	if outgoing {
+		fmt.Fprintf(os.Stderr, "%s[H2] >>%s %s\n", BoldGreen, FormatReset, frame)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s[H2] <<%s %s\n", BoldCyan, FormatReset, frame)
+}
+
+// Warnings and errors go to stderr so they don't
+// mix with the output (e.g. JSON) on stdout.
 func PrintAppWarning(msg string) {
-	fmt.Printf("%s[WARNING]:%s %s\n", BoldYellow, FormatReset, msg)
+	if silent {
+		return
+	}
+	t := StderrTheme()
+	wsPrintf(os.Stderr, "%s[WARNING]:%s %s\n", t.Warning, t.Reset(), msg)
 }
 
 func PrintAppError(msg string) {
-	fmt.Printf("%s[ERROR]:%s %s\n", BoldRed, FormatReset, msg)
+	if silent && !showErrors {
+		return
+	}
+	t := StderrTheme()
+	wsPrintf(os.Stderr, "%s[ERROR]:%s %s\n", t.Error, t.Reset(), msg)
 }
 
-func GetWsInputFromStdin() []byte {
+// Shared by the calls so lines buffered after the
+// current one (e.g. piped input) are not lost.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+func GetWsInputFromStdin() ([]byte, error) {
 	// If we use fmt.Scanln(), then it only reads
 	// the characters until the space. bufio lets
 	// us consider all the characters until the
 	// delimiter we decide. We choose '\n' that
 	// shows the end of the input.
-	reader := bufio.NewReader(os.Stdin)
-
 	for {
-		rawInput, err := reader.ReadString('\n')
-		if err != nil {
-			PrintWsError(err.Error())
-			continue
+		rawInput, err := stdinReader.ReadString('\n')
+		// e.g. io.EOF after Ctrl-D; a last line
+		// without '\n' is still sent.
+		if err != nil && (err != io.EOF || strings.TrimSpace(rawInput) == "") {
+			return nil, err
 		}
 
-		// Trim spaces and newlines from the input
-		rawInput = strings.TrimSpace(rawInput)
+		// Only the line ending is removed; spaces
+		// are part of the message.
+		rawInput = strings.TrimRight(rawInput, "\r\n")
 
 		// Check if the input is empty or contains only spaces
-		if len(rawInput) == 0 {
+		if strings.TrimSpace(rawInput) == "" {
 			PrintWsError("empty input!")
 			continue
 		}
 
-		// Remove spaces within the input
-		modInput := make([]byte, 0, len(rawInput))
-		for _, b := range []byte(rawInput) {
-			if b != ' ' {
-				modInput = append(modInput, b)
-			}
+		return []byte(rawInput), nil
+	}
+}
+
+// Phase of a request in the timing waterfall, from
+// Start to End since the start of the connection.
+type TimingPhase struct {
+	Name  string
+	Start time.Duration
+	End   time.Duration
+}
+
+const waterfallWidth = 40
+
+/*
+Each phase is drawn as a bar placed on a common time
+axis so it's visible where the time went. Total is
+the whole operation (e.g. with redirects), e.g.
+
+	DNS lookup       |███                 |   12.1ms
+	TCP connect      |   ████             |   15.3ms
+*/
+func PrintTimingWaterfall(phases []TimingPhase, total time.Duration) {
+	fmt.Fprintf(os.Stderr, "%s\nTiming%s\n", BoldBlue, FormatReset)
+	fmt.Fprintln(os.Stderr, "---------------------")
+
+	var scale time.Duration
+	for _, phase := range phases {
+		scale = max(scale, phase.End)
+	}
+
+	for _, phase := range phases {
+		from, to := 0, 0
+		if scale > 0 {
+			from = int(phase.Start * waterfallWidth / scale)
+			to = int(phase.End * waterfallWidth / scale)
 		}
+		// Short phases still get a visible bar
+		if to == from && to < waterfallWidth {
+			to++
+		}
+
+		bar := strings.Repeat(" ", from) + strings.Repeat("█", to-from) + strings.Repeat(" ", waterfallWidth-to)
+		fmt.Fprintf(os.Stderr, "%s%-16s%s |%s%s%s| %10s\n", RegularBlue, phase.Name, FormatReset, BoldBlue, bar, FormatReset, formatMillis(phase.End-phase.Start))
+	}
+
+	fmt.Fprintf(os.Stderr, "%s%-16s%s  %s  %10s\n\n", RegularBlue, "Total", FormatReset, strings.Repeat(" ", waterfallWidth), formatMillis(total))
+}
 
-		return modInput
+func formatMillis(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+}
+
+const progressBarWidth = 30
+
+// e.g. 1536 -> "1.5 KB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
 	}
+	return fmt.Sprintf("%.1f %cB", value, "KMGT"[exp])
+}
+
+/*
+Redraws the progress line of a download on stderr
+(stdout may be piped). Without the total size (e.g.
+chunked responses), only the bytes and rate show:
+
+	[###############               ]  50.0%  1.2 MB / 2.4 MB  350.0 KB/s  ETA 3s
+*/
+func PrintProgress(done, total int64, rate float64, eta time.Duration) {
+	t := StderrTheme()
+	var line string
+	if total > 0 {
+		ratio := min(float64(done)/float64(total), 1)
+		filled := int(ratio * progressBarWidth)
+		bar := strings.Repeat("#", filled) + strings.Repeat(" ", progressBarWidth-filled)
+		line = fmt.Sprintf("[%s%s%s] %5.1f%%  %s / %s  %s/s", t.Progress, bar, t.Reset(), ratio*100, formatBytes(done), formatBytes(total), formatBytes(int64(rate)))
+		if eta > 0 {
+			line += "  ETA " + eta.Round(time.Second).String()
+		}
+	} else {
+		line = fmt.Sprintf("%s  %s/s", formatBytes(done), formatBytes(int64(rate)))
+	}
+
+	// Spaces clear what's left of a longer previous line
+	fmt.Fprintf(os.Stderr, "\r%s%s", line, strings.Repeat(" ", 8))
+}
+
+// The next output starts on a new line
+func PrintProgressDone() {
+	fmt.Fprintln(os.Stderr)
+}
+
+func PrintSavedFile(path string) {
+	t := StderrTheme()
+	wsPrintf(os.Stderr, "%s[SAVED]:%s %s\n", t.Progress, t.Reset(), path)
 }
@@ -0,0 +1,228 @@
+package terminalutils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/*
+Colors of the parts of the output that have a role
+(rather than the headings, which keep their colors).
+The default is overridden in ~/.gurl/config, e.g.
+
+	# black red green yellow blue purple cyan white,
+	# with bold-, underline- or intense- prefixes,
+	# SGR parameters (38;5;208) or none
+	color.header = bold-blue
+	color.ws_client = 38;5;208
+
+An empty color means the text is printed as it is.
+*/
+type Theme struct {
+	Status2xx string
+	Status3xx string
+	Status4xx string
+	Status5xx string
+	Header    string
+
+	// Tokens of formatted bodies (e.g. JSON and forms)
+	BodyKey     string
+	BodyString  string
+	BodyNumber  string
+	BodyLiteral string
+
+	WsClient string
+	WsServer string
+
+	Warning  string
+	Error    string
+	Progress string
+
+	reset string
+}
+
+func DefaultTheme() Theme {
+	return Theme{
+		Status2xx:   "\033[1;32m",
+		Status3xx:   "\033[1;36m",
+		Status4xx:   "\033[1;31m",
+		Status5xx:   "\033[1;35m",
+		Header:      "\033[0;36m",
+		BodyKey:     "\033[0;36m",
+		BodyString:  "\033[0;32m",
+		BodyNumber:  "\033[0;33m",
+		BodyLiteral: "\033[0;35m",
+		WsClient:    "\033[1;32m",
+		WsServer:    "\033[1;36m",
+		Warning:     "\033[1;33m",
+		Error:       "\033[1;31m",
+		Progress:    "\033[1;32m",
+		reset:       "\033[0m",
+	}
+}
+
+// Ends a color of the theme
+func (t Theme) Reset() string {
+	return t.reset
+}
+
+// Config keys of the roles, without "color."
+func (t *Theme) roles() map[string]*string {
+	return map[string]*string{
+		"status_2xx":   &t.Status2xx,
+		"status_3xx":   &t.Status3xx,
+		"status_4xx":   &t.Status4xx,
+		"status_5xx":   &t.Status5xx,
+		"header":       &t.Header,
+		"body_key":     &t.BodyKey,
+		"body_string":  &t.BodyString,
+		"body_number":  &t.BodyNumber,
+		"body_literal": &t.BodyLiteral,
+		"ws_client":    &t.WsClient,
+		"ws_server":    &t.WsServer,
+		"warning":      &t.Warning,
+		"error":        &t.Error,
+		"progress":     &t.Progress,
+	}
+}
+
+var colorNames = []string{"black", "red", "green", "yellow", "blue", "purple", "cyan", "white"}
+
+/*
+e.g. "cyan" -> "\033[0;36m", "bold-intense-red" ->
+"\033[1;91m" and "38;5;208" -> "\033[38;5;208m".
+"magenta" is the same as "purple".
+*/
+func parseColor(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "none" {
+		return "", nil
+	}
+
+	if value != "" && strings.Trim(value, "0123456789;") == "" {
+		return "\033[" + value + "m", nil
+	}
+
+	style, name := "0", value
+	if rest, found := strings.CutPrefix(name, "bold-"); found {
+		style, name = "1", rest
+	} else if rest, found := strings.CutPrefix(name, "underline-"); found {
+		style, name = "4", rest
+	}
+
+	base := 30
+	if rest, found := strings.CutPrefix(name, "intense-"); found {
+		base, name = 90, rest
+	}
+	if name == "magenta" {
+		name = "purple"
+	}
+
+	for i, colorName := range colorNames {
+		if name == colorName {
+			return fmt.Sprintf("\033[%s;%dm", style, base+i), nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown color: %s", value)
+}
+
+/*
+Reads "color.<role> = <color>" lines over the base
+theme. Other keys are left for other settings and
+lines starting with '#' are comments.
+*/
+func ParseTheme(r io.Reader, base Theme) (Theme, error) {
+	theme := base
+	roles := theme.roles()
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return Theme{}, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+
+		role, isColor := strings.CutPrefix(strings.TrimSpace(key), "color.")
+		if !isColor {
+			continue
+		}
+
+		color, ok := roles[role]
+		if !ok {
+			return Theme{}, fmt.Errorf("line %d: unknown color role: %s", lineNum, role)
+		}
+
+		var err error
+		if *color, err = parseColor(value); err != nil {
+			return Theme{}, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return Theme{}, err
+	}
+
+	return theme, nil
+}
+
+var (
+	theme        = DefaultTheme()
+	stdoutColors = true
+	stderrColors = true
+)
+
+func SetTheme(t Theme) {
+	theme = t
+}
+
+// Empty when stdout is not colored (e.g. piped)
+func StdoutTheme() Theme {
+	if !stdoutColors {
+		return Theme{}
+	}
+	return theme
+}
+
+// stderr may be a terminal while stdout is piped
+// (or the opposite), so it's decided on its own.
+func StderrTheme() Theme {
+	if !stderrColors {
+		return Theme{}
+	}
+	return theme
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func StderrIsTerminal() bool {
+	return isTerminal(os.Stderr)
+}
+
+/*
+Colors are only printed to terminals, and never
+if NO_COLOR is set (https://no-color.org) or the
+terminal is dumb. Called once at the start.
+*/
+func DetectColors() {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		DisableColors()
+		return
+	}
+
+	stdoutColors = isTerminal(os.Stdout)
+	if !isTerminal(os.Stderr) {
+		disableStderrColors()
+	}
+}
@@ -0,0 +1,86 @@
+package terminalutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "regular", value: "cyan", expected: "\033[0;36m"},
+		{name: "bold", value: "bold-green", expected: "\033[1;32m"},
+		{name: "underline", value: "underline-red", expected: "\033[4;31m"},
+		{name: "bold_intense", value: "bold-intense-red", expected: "\033[1;91m"},
+		{name: "magenta", value: " Magenta ", expected: "\033[0;35m"},
+		{name: "sgr", value: "38;5;208", expected: "\033[38;5;208m"},
+		{name: "none", value: "none", expected: ""},
+		{name: "unknown", value: "orange", expectedErr: true},
+		{name: "empty", value: "", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			color, err := parseColor(test.value)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error\tgot: %q", color)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if color != test.expected {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, color)
+			}
+		})
+	}
+}
+
+func TestParseTheme(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		expected    func(Theme) Theme
+		expectedErr bool
+	}{
+		{name: "empty", config: "", expected: func(t Theme) Theme { return t }},
+		{
+			name:   "roles",
+			config: "# colors\n\ncolor.header = bold-blue\ncolor.ws_client=none\n",
+			expected: func(t Theme) Theme {
+				t.Header, t.WsClient = "\033[1;34m", ""
+				return t
+			},
+		},
+		{name: "other_settings", config: "editor = vim\n", expected: func(t Theme) Theme { return t }},
+		{name: "unknown_role", config: "color.footer = red\n", expectedErr: true},
+		{name: "unknown_color", config: "color.header = orange\n", expectedErr: true},
+		{name: "no_value", config: "color.header\n", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			theme, err := ParseTheme(strings.NewReader(test.config), DefaultTheme())
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error\tgot: %+v", theme)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := test.expected(DefaultTheme()); theme != expected {
+				t.Fatalf("expected: %+v\tgot: %+v", expected, theme)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package wsutils
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+/*
+Bytes typed as hex, e.g. "01ff", "01 ff", "01:ff" or
+"0x01ff". Spaces and colons only make it readable.
+*/
+func DecodeHexInput(input string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+	input = strings.TrimPrefix(strings.TrimPrefix(input, "0x"), "0X")
+	input = strings.NewReplacer(" ", "", ":", "", "\t", "").Replace(input)
+
+	if input == "" {
+		return nil, fmt.Errorf("no hex bytes given")
+	}
+
+	b, err := hex.DecodeString(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex input: %w", err)
+	}
+	return b, nil
+}
+
+// Standard or URL-safe base64, with or without padding
+func DecodeBase64Input(input string) ([]byte, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, fmt.Errorf("no base64 bytes given")
+	}
+
+	encodings := []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding}
+	for _, encoding := range encodings {
+		if b, err := encoding.DecodeString(input); err == nil {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid base64 input: %s", input)
+}
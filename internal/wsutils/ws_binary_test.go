@@ -0,0 +1,76 @@
+package wsutils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecodeHexInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    []byte
+		expectedErr bool
+	}{
+		{name: "plain", input: "01ff", expected: []byte{0x01, 0xff}},
+		{name: "spaces", input: " 01 ff 7a ", expected: []byte{0x01, 0xff, 0x7a}},
+		{name: "colons", input: "01:FF", expected: []byte{0x01, 0xff}},
+		{name: "prefix", input: "0x01ff", expected: []byte{0x01, 0xff}},
+		{name: "odd_length", input: "01f", expectedErr: true},
+		{name: "not_hex", input: "zz", expectedErr: true},
+		{name: "empty", input: "  ", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DecodeHexInput(test.input)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", test.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.expected) {
+				t.Fatalf("expected: %x\tgot: %x", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecodeBase64Input(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    []byte
+		expectedErr bool
+	}{
+		{name: "std", input: "Af8=", expected: []byte{0x01, 0xff}},
+		{name: "no_padding", input: "Af8", expected: []byte{0x01, 0xff}},
+		{name: "url", input: "-_8=", expected: []byte{0xfb, 0xff}},
+		{name: "invalid", input: "A", expectedErr: true},
+		{name: "empty", input: "", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := DecodeBase64Input(test.input)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for %q", test.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, test.expected) {
+				t.Fatalf("expected: %x\tgot: %x", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package wsutils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Status codes of close frames (RFC 6455 section 7.4)
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseAbnormal        = 1006
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+/*
+Codes that may be sent in a close frame: the ones
+defined by RFC 6455 (except those only used locally,
+e.g. 1005 and 1006), 3000-3999 registered by IANA and
+4000-4999 for private use.
+*/
+func IsValidCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// Payload of a close frame: 2-byte code then the
+// reason. CloseNoStatus sends an empty payload.
+func EncodeClosePayload(code int, reason string) []byte {
+	if code == CloseNoStatus {
+		return nil
+	}
+
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return append(payload, reason...)
+}
+
+// Empty payload means CloseNoStatus
+func ParseClosePayload(payload []byte) (int, string, error) {
+	if len(payload) == 0 {
+		return CloseNoStatus, "", nil
+	}
+	if len(payload) == 1 {
+		return 0, "", fmt.Errorf("%w: close payload of 1 byte", ErrInvalidFrame)
+	}
+
+	code := int(binary.BigEndian.Uint16(payload))
+	if !IsValidCloseCode(code) {
+		return 0, "", fmt.Errorf("%w: close code %d", ErrInvalidFrame, code)
+	}
+
+	reason := payload[2:]
+	if !utf8.Valid(reason) {
+		return 0, "", ErrInvalidUTF8
+	}
+
+	return code, string(reason), nil
+}
+
+// Code to close with after a read error of the peer
+func CloseCodeOf(err error) int {
+	switch {
+	case errors.Is(err, ErrFrameTooLarge), errors.Is(err, ErrMessageTooLarge):
+		return CloseMessageTooBig
+	case errors.Is(err, ErrInvalidUTF8):
+		return CloseInvalidPayload
+	}
+	return CloseProtocolError
+}
@@ -0,0 +1,65 @@
+package wsutils
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParseClosePayload(t *testing.T) {
+	tests := []struct {
+		name           string
+		payload        []byte
+		expectedCode   int
+		expectedReason string
+		expectedErr    error
+	}{
+		{name: "normal", payload: EncodeClosePayload(CloseNormal, "bye"), expectedCode: CloseNormal, expectedReason: "bye"},
+		{name: "private_code", payload: EncodeClosePayload(4000, ""), expectedCode: 4000},
+		{name: "no_status", payload: nil, expectedCode: CloseNoStatus},
+		{name: "one_byte", payload: []byte{0x03}, expectedErr: ErrInvalidFrame},
+		{name: "reserved_code", payload: []byte{0x03, 0xED}, expectedErr: ErrInvalidFrame},
+		{name: "abnormal_on_wire", payload: []byte{0x03, 0xEE}, expectedErr: ErrInvalidFrame},
+		{name: "invalid_utf8_reason", payload: append(EncodeClosePayload(CloseNormal, ""), 0xff), expectedErr: ErrInvalidUTF8},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, reason, err := ParseClosePayload(test.payload)
+			if test.expectedErr != nil {
+				if !errors.Is(err, test.expectedErr) {
+					t.Fatalf("expected: %v\tgot: %v", test.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != test.expectedCode || reason != test.expectedReason {
+				t.Fatalf("expected: %d %q\tgot: %d %q", test.expectedCode, test.expectedReason, code, reason)
+			}
+		})
+	}
+}
+
+func TestCloseCodeOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{name: "invalid_frame", err: fmt.Errorf("%w: unknown opcode 0x3", ErrInvalidFrame), expected: CloseProtocolError},
+		{name: "frame_too_large", err: fmt.Errorf("%w: 100 bytes", ErrFrameTooLarge), expected: CloseMessageTooBig},
+		{name: "message_too_large", err: ErrMessageTooLarge, expected: CloseMessageTooBig},
+		{name: "invalid_utf8", err: ErrInvalidUTF8, expected: CloseInvalidPayload},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CloseCodeOf(test.err); got != test.expected {
+				t.Fatalf("expected: %d\tgot: %d", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package wsutils
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Name of the extension in Sec-WebSocket-Extensions
+const ExtensionDeflate = "permessage-deflate"
+
+// RSV1 marks the first frame of a compressed message
+const rsv1 byte = 0x4
+
+// Sizes of the LZ77 window, as log2 of the bytes
+const (
+	minWindowBits     = 8
+	maxWindowBits     = 15
+	defaultWindowBits = maxWindowBits
+)
+
+/*
+Each compressed message ends with an empty stored
+block of sync flush (00 00 ff ff) which is removed
+before sending and put back before decompressing.
+*/
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff}
+
+// Final empty stored block, so the reader ends with
+// io.EOF after the message instead of waiting for more.
+var deflateFinalBlock = []byte{0x01, 0x00, 0x00, 0xff, 0xff}
+
+var ErrInvalidExtension = errors.New("invalid ws extension")
+
+/*
+Parameters of permessage-deflate (RFC 7692) agreed in
+the handshake:
+
+  - ServerNoContextTakeover: the server compresses each
+    message on its own, without the previous ones.
+  - ClientNoContextTakeover: same for the client.
+  - ServerMaxWindowBits: max window of the server (8-15).
+  - ClientMaxWindowBits: max window of the client (8-15).
+*/
+type DeflateParams struct {
+	ServerNoContextTakeover bool
+	ClientNoContextTakeover bool
+	ServerMaxWindowBits     int
+	ClientMaxWindowBits     int
+}
+
+/*
+Offer of the client. Without a value for
+client_max_window_bits, the server may choose any
+window for the client (RFC 7692 7.1.2.2).
+*/
+func DeflateOffer() string {
+	return ExtensionDeflate + "; client_max_window_bits"
+}
+
+// e.g. "client_max_window_bits=10, server_max_window_bits=15,
+// server_no_context_takeover"
+func (p DeflateParams) String() string {
+	params := []string{
+		"client_max_window_bits=" + strconv.Itoa(p.ClientMaxWindowBits),
+		"server_max_window_bits=" + strconv.Itoa(p.ServerMaxWindowBits),
+	}
+	if p.ClientNoContextTakeover {
+		params = append(params, "client_no_context_takeover")
+	}
+	if p.ServerNoContextTakeover {
+		params = append(params, "server_no_context_takeover")
+	}
+	return strings.Join(params, ", ")
+}
+
+/*
+Parses Sec-WebSocket-Extensions of the handshake
+response. found is false if the server didn't accept
+permessage-deflate. Other extensions, parameters
+that weren't offered and repeated parameters are
+errors since the client can't go on with them.
+*/
+func ParseDeflateResponse(extensions string) (params DeflateParams, found bool, err error) {
+	params = DeflateParams{ServerMaxWindowBits: defaultWindowBits, ClientMaxWindowBits: defaultWindowBits}
+
+	for _, extension := range strings.Split(extensions, ",") {
+		extension = strings.TrimSpace(extension)
+		if extension == "" {
+			continue
+		}
+
+		segments := strings.Split(extension, ";")
+		name := strings.TrimSpace(segments[0])
+		if !strings.EqualFold(name, ExtensionDeflate) {
+			return DeflateParams{}, false, fmt.Errorf("%w: server accepted %q which was not offered", ErrInvalidExtension, name)
+		}
+		if found {
+			return DeflateParams{}, false, fmt.Errorf("%w: %s accepted twice", ErrInvalidExtension, ExtensionDeflate)
+		}
+		found = true
+
+		seen := make(map[string]bool, len(segments)-1)
+		for _, param := range segments[1:] {
+			key, value, hasValue := strings.Cut(strings.TrimSpace(param), "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			value = strings.Trim(strings.TrimSpace(value), `"`)
+
+			if seen[key] {
+				return DeflateParams{}, false, fmt.Errorf("%w: %s repeated", ErrInvalidExtension, key)
+			}
+			seen[key] = true
+
+			switch key {
+			case "server_no_context_takeover", "client_no_context_takeover":
+				if hasValue {
+					return DeflateParams{}, false, fmt.Errorf("%w: %s must not have a value", ErrInvalidExtension, key)
+				}
+				if key == "server_no_context_takeover" {
+					params.ServerNoContextTakeover = true
+				} else {
+					params.ClientNoContextTakeover = true
+				}
+
+			case "server_max_window_bits", "client_max_window_bits":
+				bits, err := strconv.Atoi(value)
+				if !hasValue || err != nil || bits < minWindowBits || bits > maxWindowBits {
+					return DeflateParams{}, false, fmt.Errorf("%w: %s must be %d-%d", ErrInvalidExtension, key, minWindowBits, maxWindowBits)
+				}
+				if key == "server_max_window_bits" {
+					params.ServerMaxWindowBits = bits
+				} else {
+					params.ClientMaxWindowBits = bits
+				}
+
+			default:
+				return DeflateParams{}, false, fmt.Errorf("%w: unknown parameter %s", ErrInvalidExtension, key)
+			}
+		}
+	}
+
+	return params, found, nil
+}
+
+/*
+Compresses the messages of the client. With context
+takeover, the window carries over to the next message
+so repeated content compresses better.
+
+compress/flate always uses a 32 KB window, so with a
+smaller client_max_window_bits each message is
+compressed on its own, and messages larger than the
+window are sent without compression; back references
+of a message can't then be further than the window.
+*/
+type Compressor struct {
+	fw           *flate.Writer
+	buf          bytes.Buffer
+	contextReset bool
+	maxInputSize int
+}
+
+func NewCompressor(params DeflateParams) *Compressor {
+	c := &Compressor{contextReset: params.ClientNoContextTakeover || params.ClientMaxWindowBits < maxWindowBits}
+	if params.ClientMaxWindowBits < maxWindowBits {
+		c.maxInputSize = 1 << params.ClientMaxWindowBits
+	}
+
+	// Only fails for an invalid level
+	c.fw, _ = flate.NewWriter(&c.buf, flate.DefaultCompression)
+	return c
+}
+
+// ok is false if the message must be sent as it is
+func (c *Compressor) Compress(payload []byte) (compressed []byte, ok bool, err error) {
+	if c.maxInputSize > 0 && len(payload) > c.maxInputSize {
+		return nil, false, nil
+	}
+
+	c.buf.Reset()
+	if c.contextReset {
+		c.fw.Reset(&c.buf)
+	}
+
+	if _, err := c.fw.Write(payload); err != nil {
+		return nil, false, err
+	}
+	if err := c.fw.Flush(); err != nil {
+		return nil, false, err
+	}
+
+	compressed = bytes.TrimSuffix(c.buf.Bytes(), deflateTail)
+	return bytes.Clone(compressed), true, nil
+}
+
+/*
+Decompresses the messages of the server. With context
+takeover, the last 32 KB of output is the dictionary
+of the next message since the server may refer to it.
+*/
+type Decompressor struct {
+	fr             io.ReadCloser
+	window         []byte
+	contextReset   bool
+	maxMessageSize uint64
+}
+
+func NewDecompressor(params DeflateParams, maxMessageSize uint64) *Decompressor {
+	return &Decompressor{
+		fr:             flate.NewReader(bytes.NewReader(nil)),
+		contextReset:   params.ServerNoContextTakeover,
+		maxMessageSize: maxMessageSize,
+	}
+}
+
+func (d *Decompressor) Decompress(payload []byte) ([]byte, error) {
+	stream := io.MultiReader(bytes.NewReader(payload), bytes.NewReader(deflateTail), bytes.NewReader(deflateFinalBlock))
+
+	var dict []byte
+	if !d.contextReset {
+		dict = d.window
+	}
+	if err := d.fr.(flate.Resetter).Reset(stream, dict); err != nil {
+		return nil, err
+	}
+
+	// One byte over the limit to tell a message of
+	// exactly the limit from a larger one.
+	out, err := io.ReadAll(io.LimitReader(d.fr, int64(d.maxMessageSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decompress: %v", ErrInvalidFrame, err)
+	}
+	if uint64(len(out)) > d.maxMessageSize {
+		return nil, fmt.Errorf("%w: more than %d bytes after decompression", ErrMessageTooLarge, d.maxMessageSize)
+	}
+
+	if !d.contextReset {
+		d.window = append(d.window, out...)
+		if len(d.window) > 1<<maxWindowBits {
+			d.window = bytes.Clone(d.window[len(d.window)-1<<maxWindowBits:])
+		}
+	}
+
+	return out, nil
+}
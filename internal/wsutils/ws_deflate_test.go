@@ -0,0 +1,183 @@
+package wsutils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestParseDeflateResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		extensions    string
+		expected      DeflateParams
+		expectedFound bool
+		expectedErr   bool
+	}{
+		{name: "not_accepted", extensions: "", expected: DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 15}},
+		{name: "defaults", extensions: "permessage-deflate", expected: DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 15}, expectedFound: true},
+		{
+			name:          "all_params",
+			extensions:    "permessage-deflate; client_max_window_bits=10; server_max_window_bits=\"12\"; client_no_context_takeover; server_no_context_takeover",
+			expected:      DeflateParams{ServerNoContextTakeover: true, ClientNoContextTakeover: true, ServerMaxWindowBits: 12, ClientMaxWindowBits: 10},
+			expectedFound: true,
+		},
+		{name: "other_extension", extensions: "x-webkit-deflate-frame", expectedErr: true},
+		{name: "accepted_twice", extensions: "permessage-deflate, permessage-deflate", expectedErr: true},
+		{name: "unknown_param", extensions: "permessage-deflate; level=9", expectedErr: true},
+		{name: "repeated_param", extensions: "permessage-deflate; server_no_context_takeover; server_no_context_takeover", expectedErr: true},
+		{name: "window_without_value", extensions: "permessage-deflate; client_max_window_bits", expectedErr: true},
+		{name: "window_out_of_range", extensions: "permessage-deflate; server_max_window_bits=7", expectedErr: true},
+		{name: "takeover_with_value", extensions: "permessage-deflate; client_no_context_takeover=1", expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params, found, err := ParseDeflateResponse(test.extensions)
+			if test.expectedErr {
+				if !errors.Is(err, ErrInvalidExtension) {
+					t.Fatalf("expected: %v\tgot: %v", ErrInvalidExtension, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != test.expectedFound || params != test.expected {
+				t.Fatalf("expected: %v %+v\tgot: %v %+v", test.expectedFound, test.expected, found, params)
+			}
+		})
+	}
+}
+
+// Examples of RFC 7692 section 7.2.3: "Hello" twice
+// with context takeover, so the second one only refers
+// to the first.
+func TestDecompressRFCExamples(t *testing.T) {
+	d := NewDecompressor(DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 15}, DefaultMaxMessageSize)
+
+	messages := [][]byte{
+		{0xf2, 0x48, 0xcd, 0xc9, 0xc9, 0x07, 0x00},
+		{0xf2, 0x00, 0x11, 0x00, 0x00},
+	}
+	for _, message := range messages {
+		got, err := d.Decompress(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "Hello" {
+			t.Fatalf("expected: %q\tgot: %q", "Hello", got)
+		}
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		params     DeflateParams
+		payloadLen int
+		expectedOk bool
+	}{
+		{name: "context_takeover", params: DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 15}, payloadLen: 5000, expectedOk: true},
+		{name: "no_context_takeover", params: DeflateParams{ClientNoContextTakeover: true, ServerNoContextTakeover: true, ServerMaxWindowBits: 15, ClientMaxWindowBits: 15}, payloadLen: 5000, expectedOk: true},
+		{name: "small_window", params: DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 9}, payloadLen: 512, expectedOk: true},
+		{name: "over_small_window", params: DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 9}, payloadLen: 513},
+		{name: "empty", params: DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 15}, expectedOk: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// The server side decompresses what the
+			// client compressed, with the same params.
+			serverParams := test.params
+			serverParams.ServerNoContextTakeover = test.params.ClientNoContextTakeover
+
+			c := NewCompressor(test.params)
+			d := NewDecompressor(serverParams, DefaultMaxMessageSize)
+
+			payload := bytes.Repeat([]byte("gurl "), test.payloadLen/5)
+			payload = append(payload, make([]byte, test.payloadLen%5)...)
+
+			// Twice to use the context of the first message
+			for range 2 {
+				compressed, ok, err := c.Compress(payload)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != test.expectedOk {
+					t.Fatalf("expected: %v\tgot: %v", test.expectedOk, ok)
+				}
+				if !ok {
+					return
+				}
+
+				got, err := d.Decompress(compressed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, payload) {
+					t.Fatalf("expected: %d bytes\tgot: %d bytes", len(payload), len(got))
+				}
+			}
+		})
+	}
+}
+
+func TestDecompressTooLarge(t *testing.T) {
+	params := DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 15}
+	compressed, _, err := NewCompressor(params).Compress(make([]byte, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDecompressor(params, 1000).Decompress(compressed); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected: %v\tgot: %v", ErrMessageTooLarge, err)
+	}
+}
+
+func TestReadCompressedMessage(t *testing.T) {
+	params := DeflateParams{ServerMaxWindowBits: 15, ClientMaxWindowBits: 15}
+	payload := bytes.Repeat([]byte("compressed "), 100)
+
+	// The server writes like the client here, with
+	// RSV1 on the first of the fragments.
+	var stream bytes.Buffer
+	if err := NewFrameWriter(&stream, 10, NewCompressor(params)).WriteMessage(OpcodeText, payload); err != nil {
+		t.Fatal(err)
+	}
+	if stream.Bytes()[0]&0x40 == 0 {
+		t.Fatal("expected RSV1 on the first frame")
+	}
+
+	fr := NewFrameReader(bufio.NewReader(bytes.NewReader(stream.Bytes())), DefaultMaxFrameSize)
+	msg, err := NewMessageReader(fr, DefaultMaxMessageSize, NewDecompressor(params, DefaultMaxMessageSize)).ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Opcode != OpcodeText || !bytes.Equal(msg.Payload, payload) {
+		t.Fatalf("expected: %d bytes\tgot: %d bytes", len(payload), len(msg.Payload))
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		// RSV1 without permessage-deflate is covered by
+		// TestReadMessage; these are with it.
+		{name: "rsv1_on_ping", frame: []byte{0xC9, 0}},
+		{name: "rsv2", frame: []byte{0xA1, 0}},
+		{name: "rsv1_on_continuation", frame: append(serverFrame(false, OpcodeText, []byte("a")), 0xC0, 0)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fr := NewFrameReader(bufio.NewReader(bytes.NewReader(test.frame)), DefaultMaxFrameSize)
+			mr := NewMessageReader(fr, DefaultMaxMessageSize, NewDecompressor(params, DefaultMaxMessageSize))
+			if _, err := mr.ReadMessage(); !errors.Is(err, ErrInvalidFrame) {
+				t.Fatalf("expected: %v\tgot: %v", ErrInvalidFrame, err)
+			}
+		})
+	}
+}
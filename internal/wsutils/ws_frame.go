@@ -0,0 +1,160 @@
+package wsutils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Opcodes of RFC 6455. Control frames (close, ping
+// and pong) are 0x8 and above.
+const (
+	OpcodeContinuation byte = 0x0
+	OpcodeText         byte = 0x1
+	OpcodeBinary       byte = 0x2
+	OpcodeClose        byte = 0x8
+	OpcodePing         byte = 0x9
+	OpcodePong         byte = 0xA
+)
+
+// Values of the 7-bit length that mean the length
+// is in the next 2 or 8 bytes.
+const (
+	payloadLen16Bit = 126
+	payloadLen64Bit = 127
+)
+
+// Payload of control frames must fit in the 7-bit length
+const maxControlPayloadLen = 125
+
+// Limits used by the client unless set otherwise
+const (
+	DefaultMaxFrameSize   = 16 << 20
+	DefaultMaxMessageSize = 32 << 20
+)
+
+var (
+	ErrInvalidFrame    = errors.New("invalid ws frame")
+	ErrFrameTooLarge   = errors.New("ws frame exceeds the size limit")
+	ErrMessageTooLarge = errors.New("ws message exceeds the size limit")
+	ErrInvalidUTF8     = errors.New("ws text message is not valid UTF-8")
+)
+
+// The peer broke RFC 6455 (rather than the conn failing)
+func IsProtocolViolation(err error) bool {
+	return errors.Is(err, ErrInvalidFrame) || errors.Is(err, ErrFrameTooLarge) ||
+		errors.Is(err, ErrMessageTooLarge) || errors.Is(err, ErrInvalidUTF8)
+}
+
+/*
+A single WebSocket frame:
+
+  - FIN (1 bit): Indicates if this is the final fragment of a message.
+  - RSV1-3 (3 bits): Reserved for extensions (e.g. compression).
+  - Opcode (4 bits): Specifies the type of data (e.g., text, binary).
+  - Mask (1 bit): Indicates if the payload is masked. If 1, the payload is masked.
+  - Payload length (7 bits): Specifies the length of the payload data.
+    If the length is 0-125, it directly represents the payload length.
+    If it is 126, the next 2 bytes represent the payload length.
+    If it is 127, the next 8 bytes represent the payload length.
+  - Masking key (4 bytes, if Mask is 1): A key used to unmask the payload.
+  - Payload data: The actual message data (text or binary).
+
+Payload is always unmasked.
+*/
+type Frame struct {
+	Fin     bool
+	Rsv     byte
+	Opcode  byte
+	Payload []byte
+}
+
+func isControl(opcode byte) bool {
+	return opcode >= OpcodeClose
+}
+
+func isKnownOpcode(opcode byte) bool {
+	switch opcode {
+	case OpcodeContinuation, OpcodeText, OpcodeBinary, OpcodeClose, OpcodePing, OpcodePong:
+		return true
+	}
+	return false
+}
+
+// Rules of RFC 6455 that can be checked from
+// the header alone.
+func validateFrameHeader(fin bool, opcode byte, payloadLen uint64) error {
+	if !isKnownOpcode(opcode) {
+		return fmt.Errorf("%w: unknown opcode 0x%x", ErrInvalidFrame, opcode)
+	}
+
+	if isControl(opcode) {
+		if !fin {
+			return fmt.Errorf("%w: fragmented control frame (opcode 0x%x)", ErrInvalidFrame, opcode)
+		}
+		if payloadLen > maxControlPayloadLen {
+			return fmt.Errorf("%w: control frame payload of %d bytes", ErrInvalidFrame, payloadLen)
+		}
+	}
+
+	return nil
+}
+
+// XOR of each byte with the key, used in a cyclic
+// manner. Masking and unmasking are the same.
+func maskBytes(b []byte, maskKey [4]byte) {
+	for i := range b {
+		b[i] ^= maskKey[i%4]
+	}
+}
+
+/*
+Frame as sent on the wire. With a mask key (which
+clients must use), the payload is masked in the
+returned bytes; f.Payload is not changed.
+*/
+func EncodeFrame(f Frame, maskKey *[4]byte) []byte {
+	payloadLen := len(f.Payload)
+
+	headerLen := 2
+	switch {
+	case payloadLen > 0xFFFF:
+		headerLen += 8
+	case payloadLen > maxControlPayloadLen:
+		headerLen += 2
+	}
+	if maskKey != nil {
+		headerLen += 4
+	}
+
+	frame := make([]byte, headerLen, headerLen+payloadLen)
+
+	frame[0] = f.Rsv<<4 | f.Opcode&0x0F
+	if f.Fin {
+		frame[0] |= 0x80
+	}
+
+	offset := 2
+	switch {
+	case payloadLen > 0xFFFF:
+		frame[1] = payloadLen64Bit
+		binary.BigEndian.PutUint64(frame[2:10], uint64(payloadLen))
+		offset += 8
+	case payloadLen > maxControlPayloadLen:
+		frame[1] = payloadLen16Bit
+		binary.BigEndian.PutUint16(frame[2:4], uint16(payloadLen))
+		offset += 2
+	default:
+		frame[1] = byte(payloadLen)
+	}
+
+	frame = append(frame, f.Payload...)
+
+	if maskKey != nil {
+		frame[1] |= 0x80
+		copy(frame[offset:offset+4], maskKey[:])
+		maskBytes(frame[headerLen:], *maskKey)
+	}
+
+	return frame
+}
@@ -0,0 +1,438 @@
+package wsutils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// Unmasked frame as sent by a server
+func serverFrame(fin bool, opcode byte, payload []byte) []byte {
+	return EncodeFrame(Frame{Fin: fin, Opcode: opcode, Payload: payload}, nil)
+}
+
+func TestEncodeFrameHeader(t *testing.T) {
+	tests := []struct {
+		name           string
+		payloadLen     int
+		expectedHeader []byte
+	}{
+		{name: "empty", payloadLen: 0, expectedHeader: []byte{0x81, 0}},
+		{name: "7_bit", payloadLen: 125, expectedHeader: []byte{0x81, 125}},
+		{name: "16_bit_min", payloadLen: 126, expectedHeader: []byte{0x81, 126, 0, 126}},
+		{name: "16_bit_max", payloadLen: 0xFFFF, expectedHeader: []byte{0x81, 126, 0xFF, 0xFF}},
+		{name: "64_bit", payloadLen: 0x10000, expectedHeader: []byte{0x81, 127, 0, 0, 0, 0, 0, 1, 0, 0}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frame := serverFrame(true, OpcodeText, make([]byte, test.payloadLen))
+
+			if !bytes.HasPrefix(frame, test.expectedHeader) {
+				t.Fatalf("expected: %v\tgot: %v", test.expectedHeader, frame[:len(test.expectedHeader)])
+			}
+			if len(frame) != len(test.expectedHeader)+test.payloadLen {
+				t.Fatalf("expected: %d\tgot: %d", len(test.expectedHeader)+test.payloadLen, len(frame))
+			}
+		})
+	}
+}
+
+func TestParseWsFrame(t *testing.T) {
+	tests := []struct {
+		name        string
+		payloadLen  int
+		masked      bool
+		expectedErr bool
+	}{
+		{name: "7_bit", payloadLen: 5},
+		{name: "16_bit", payloadLen: 300},
+		{name: "64_bit", payloadLen: 70000},
+		{name: "masked_64_bit", payloadLen: 70000, masked: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := bytes.Repeat([]byte("x"), test.payloadLen)
+
+			var frame []byte
+			if test.masked {
+				frame, _ = CreateWsFrame(OpcodeText, payload)
+			} else {
+				frame = serverFrame(true, OpcodeText, payload)
+			}
+
+			got, err := ParseWsFrame(frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Fatalf("expected: %d bytes\tgot: %d bytes", len(payload), len(got))
+			}
+		})
+	}
+
+	if _, err := ParseWsFrame([]byte{0x81, 126, 0x01}); err == nil {
+		t.Fatal("expected error for truncated frame")
+	}
+}
+
+func TestReadFrameSplitReads(t *testing.T) {
+	var stream bytes.Buffer
+	payloads := [][]byte{[]byte("first"), bytes.Repeat([]byte("y"), 200), []byte("third")}
+	for _, payload := range payloads {
+		stream.Write(serverFrame(true, OpcodeText, payload))
+	}
+
+	// One byte per read: every frame spans many reads
+	fr := NewFrameReader(bufio.NewReader(iotest.OneByteReader(&stream)), DefaultMaxFrameSize)
+	for _, payload := range payloads {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(frame.Payload, payload) {
+			t.Fatalf("expected: %q\tgot: %q", payload, frame.Payload)
+		}
+	}
+
+	if _, err := fr.ReadFrame(); err != io.EOF {
+		t.Fatalf("expected: %v\tgot: %v", io.EOF, err)
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		frame       []byte
+		maxSize     uint64
+		expectedErr error
+	}{
+		{name: "unknown_opcode", frame: []byte{0x83, 0}, expectedErr: ErrInvalidFrame},
+		{name: "fragmented_ping", frame: []byte{0x09, 0}, expectedErr: ErrInvalidFrame},
+		{name: "long_ping", frame: serverFrame(true, OpcodePing, make([]byte, 126)), expectedErr: ErrInvalidFrame},
+		{name: "64_bit_high_bit", frame: []byte{0x82, 127, 0x80, 0, 0, 0, 0, 0, 0, 0}, expectedErr: ErrInvalidFrame},
+		{name: "too_large", frame: serverFrame(true, OpcodeBinary, make([]byte, 100)), maxSize: 99, expectedErr: ErrFrameTooLarge},
+		{name: "truncated_length", frame: []byte{0x82, 127, 0, 0}, expectedErr: io.ErrUnexpectedEOF},
+		{name: "truncated_payload", frame: []byte{0x82, 5, 'a'}, expectedErr: io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			maxSize := test.maxSize
+			if maxSize == 0 {
+				maxSize = DefaultMaxFrameSize
+			}
+
+			fr := NewFrameReader(bufio.NewReader(bytes.NewReader(test.frame)), maxSize)
+			if _, err := fr.ReadFrame(); !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected: %v\tgot: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestReadFrameRejectMasked(t *testing.T) {
+	maskKey := [4]byte{1, 2, 3, 4}
+	masked := EncodeFrame(Frame{Fin: true, Opcode: OpcodeText, Payload: []byte("hi")}, &maskKey)
+	unmasked := serverFrame(true, OpcodeText, []byte("hi"))
+
+	fr := NewFrameReader(bufio.NewReader(bytes.NewReader(append(unmasked, masked...))), DefaultMaxFrameSize)
+	fr.RejectMaskedFrames()
+
+	if f, err := fr.ReadFrame(); err != nil || string(f.Payload) != "hi" {
+		t.Fatalf("expected: %q\tgot: %q %v", "hi", f.Payload, err)
+	}
+	if _, err := fr.ReadFrame(); !errors.Is(err, ErrInvalidFrame) {
+		t.Fatalf("expected: %v\tgot: %v", ErrInvalidFrame, err)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		frames      [][]byte
+		maxSize     uint64
+		expected    []Message
+		expectedErr error
+	}{
+		{
+			name:     "single_frame",
+			frames:   [][]byte{serverFrame(true, OpcodeText, []byte("hello"))},
+			expected: []Message{{Opcode: OpcodeText, Payload: []byte("hello")}},
+		},
+		{
+			name: "fragmented_with_ping_between",
+			frames: [][]byte{
+				serverFrame(false, OpcodeBinary, []byte("he")),
+				serverFrame(true, OpcodePing, []byte("p")),
+				serverFrame(false, OpcodeContinuation, []byte("ll")),
+				serverFrame(true, OpcodeContinuation, []byte("o")),
+			},
+			expected: []Message{
+				{Opcode: OpcodePing, Payload: []byte("p")},
+				{Opcode: OpcodeBinary, Payload: []byte("hello")},
+			},
+		},
+		{
+			name:        "continuation_first",
+			frames:      [][]byte{serverFrame(true, OpcodeContinuation, []byte("x"))},
+			expectedErr: ErrInvalidFrame,
+		},
+		{
+			name: "new_message_while_fragmenting",
+			frames: [][]byte{
+				serverFrame(false, OpcodeText, []byte("a")),
+				serverFrame(true, OpcodeText, []byte("b")),
+			},
+			expectedErr: ErrInvalidFrame,
+		},
+		{
+			name: "too_large",
+			frames: [][]byte{
+				serverFrame(false, OpcodeText, []byte("abc")),
+				serverFrame(true, OpcodeContinuation, []byte("def")),
+			},
+			maxSize:     5,
+			expectedErr: ErrMessageTooLarge,
+		},
+		{
+			name:        "invalid_utf8",
+			frames:      [][]byte{serverFrame(true, OpcodeText, []byte{0xff, 0xfe})},
+			expectedErr: ErrInvalidUTF8,
+		},
+		{
+			name:        "reserved_bits",
+			frames:      [][]byte{{0xC1, 0}},
+			expectedErr: ErrInvalidFrame,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			maxSize := test.maxSize
+			if maxSize == 0 {
+				maxSize = DefaultMaxMessageSize
+			}
+
+			stream := bytes.Join(test.frames, nil)
+			fr := NewFrameReader(bufio.NewReader(bytes.NewReader(stream)), DefaultMaxFrameSize)
+			mr := NewMessageReader(fr, maxSize, nil)
+
+			for _, expected := range test.expected {
+				msg, err := mr.ReadMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if msg.Opcode != expected.Opcode || !bytes.Equal(msg.Payload, expected.Payload) {
+					t.Fatalf("expected: %d %q\tgot: %d %q", expected.Opcode, expected.Payload, msg.Opcode, msg.Payload)
+				}
+			}
+
+			if test.expectedErr == nil {
+				return
+			}
+			if _, err := mr.ReadMessage(); !errors.Is(err, test.expectedErr) {
+				t.Fatalf("expected: %v\tgot: %v", test.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestWriteMessageFragments(t *testing.T) {
+	tests := []struct {
+		name           string
+		payloadLen     int
+		fragmentSize   int
+		expectedFrames int
+	}{
+		{name: "no_fragmentation", payloadLen: 1000, fragmentSize: 0, expectedFrames: 1},
+		{name: "fits", payloadLen: 1000, fragmentSize: 1000, expectedFrames: 1},
+		{name: "fragmented", payloadLen: 1000, fragmentSize: 300, expectedFrames: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := bytes.Repeat([]byte("z"), test.payloadLen)
+
+			var stream bytes.Buffer
+			if err := NewFrameWriter(&stream, test.fragmentSize, nil).WriteMessage(OpcodeText, payload); err != nil {
+				t.Fatal(err)
+			}
+
+			// Counted with a frame reader before reassembling
+			fr := NewFrameReader(bufio.NewReader(bytes.NewReader(stream.Bytes())), DefaultMaxFrameSize)
+			var frames int
+			for {
+				if _, err := fr.ReadFrame(); err == io.EOF {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				frames++
+			}
+			if frames != test.expectedFrames {
+				t.Fatalf("expected: %d\tgot: %d", test.expectedFrames, frames)
+			}
+
+			fr = NewFrameReader(bufio.NewReader(bytes.NewReader(stream.Bytes())), DefaultMaxFrameSize)
+			msg, err := NewMessageReader(fr, DefaultMaxMessageSize, nil).ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Opcode != OpcodeText || !bytes.Equal(msg.Payload, payload) {
+				t.Fatalf("expected: %d bytes\tgot: %d bytes", len(payload), len(msg.Payload))
+			}
+		})
+	}
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	var stream bytes.Buffer
+	fw := NewFrameWriter(&stream, 0, nil)
+
+	if err := fw.WriteFrame(Frame{Fin: true, Opcode: OpcodeClose, Payload: EncodeClosePayload(CloseNormal, "")}); err != nil {
+		t.Fatal(err)
+	}
+	if !fw.CloseSent() {
+		t.Fatal("expected close frame to be recorded as sent")
+	}
+
+	sent := stream.Len()
+	if err := fw.WriteMessage(OpcodeText, []byte("late")); !errors.Is(err, ErrCloseSent) {
+		t.Fatalf("expected: %v	got: %v", ErrCloseSent, err)
+	}
+	// Control frames (e.g. a pong) may still be sent
+	if err := fw.WriteFrame(Frame{Fin: true, Opcode: OpcodePong}); err != nil {
+		t.Fatal(err)
+	}
+	if stream.Len() == sent {
+		t.Fatal("expected pong to be written")
+	}
+}
+
+// The reader must never panic or allocate past the
+// limits, whatever the bytes of the stream are.
+func FuzzReadMessage(f *testing.F) {
+	f.Add(serverFrame(true, OpcodeText, []byte("hello")))
+	f.Add(serverFrame(true, OpcodeBinary, make([]byte, 300)))
+	f.Add(append(serverFrame(false, OpcodeText, []byte("a")), serverFrame(true, OpcodeContinuation, []byte("b"))...))
+	f.Add([]byte{0x82, 127, 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	f.Add([]byte{0x89, 0x80, 1, 2, 3, 4})
+
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		fr := NewFrameReader(bufio.NewReader(bytes.NewReader(stream)), 1<<16)
+		mr := NewMessageReader(fr, 1<<17, nil)
+
+		for {
+			msg, err := mr.ReadMessage()
+			if err != nil {
+				return
+			}
+			if uint64(len(msg.Payload)) > 1<<17 {
+				t.Fatalf("message of %d bytes is over the limit", len(msg.Payload))
+			}
+		}
+	})
+}
+
+// Encoding and parsing a frame gives the payload back
+func FuzzParseWsFrame(f *testing.F) {
+	f.Add([]byte("hello"))
+	f.Add(make([]byte, 126))
+	f.Add(make([]byte, 0x10000))
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		frame, err := CreateWsFrame(OpcodeBinary, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ParseWsFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("expected: %x\tgot: %x", payload, got)
+		}
+	})
+}
+
+// Key of a masked frame with a 7-bit length
+func frameMaskKey(frame []byte) [4]byte {
+	var key [4]byte
+	copy(key[:], frame[2:6])
+	return key
+}
+
+func TestCreateWsFrameMaskingKey(t *testing.T) {
+	payload := []byte("same payload every time")
+	original := bytes.Clone(payload)
+
+	const frames = 100
+	keys := make(map[[4]byte]bool, frames)
+
+	for range frames {
+		frame, err := CreateWsFrame(OpcodeText, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if frame[1]&0x80 == 0 {
+			t.Fatal("expected masked frame")
+		}
+		keys[frameMaskKey(frame)] = true
+
+		got, err := ParseWsFrame(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("expected: %q\tgot: %q", payload, got)
+		}
+	}
+
+	// A 32-bit key repeats in 100 frames about once
+	// in a million runs.
+	if len(keys) < frames-1 {
+		t.Fatalf("expected: %d different keys\tgot: %d", frames, len(keys))
+	}
+	if !bytes.Equal(payload, original) {
+		t.Fatalf("payload was changed: expected: %q\tgot: %q", original, payload)
+	}
+}
+
+func TestFrameWriterMaskingKey(t *testing.T) {
+	var stream bytes.Buffer
+	fw := NewFrameWriter(&stream, 0, nil)
+
+	payload := []byte("ping")
+	for range 2 {
+		if err := fw.WriteFrame(Frame{Fin: true, Opcode: OpcodePing, Payload: payload}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(payload) != "ping" {
+		t.Fatalf("expected: %q\tgot: %q", "ping", payload)
+	}
+
+	frameLen := stream.Len() / 2
+	first, second := stream.Bytes()[:frameLen], stream.Bytes()[frameLen:]
+	if frameMaskKey(first) == frameMaskKey(second) {
+		t.Fatalf("expected different keys\tgot: %x twice", frameMaskKey(first))
+	}
+
+	fr := NewFrameReader(bufio.NewReader(&stream), DefaultMaxFrameSize)
+	for range 2 {
+		frame, err := fr.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(frame.Payload, payload) {
+			t.Fatalf("expected: %q\tgot: %q", payload, frame.Payload)
+		}
+	}
+}
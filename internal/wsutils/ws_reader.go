@@ -0,0 +1,202 @@
+package wsutils
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+/*
+Reads frames from a stream (e.g. the TCP conn).
+Frames may span several reads, or several frames
+may come in one read; the buffer takes care of both.
+*/
+type FrameReader struct {
+	r            *bufio.Reader
+	maxFrameSize uint64
+	rejectMasked bool
+}
+
+// br is used as it is so the bytes already buffered
+// (e.g. after the handshake response) are not lost.
+func NewFrameReader(br *bufio.Reader, maxFrameSize uint64) *FrameReader {
+	return &FrameReader{r: br, maxFrameSize: maxFrameSize}
+}
+
+// Frames of a server are never masked, so a client
+// fails the connection on a masked one (RFC 6455 5.1).
+func (fr *FrameReader) RejectMaskedFrames() {
+	fr.rejectMasked = true
+}
+
+func (fr *FrameReader) ReadFrame() (Frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(fr.r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	fin := header[0]&0x80 != 0
+	rsv := header[0] >> 4 & 0x07
+	opcode := header[0] & 0x0F
+	isMasked := header[1]&0x80 != 0
+
+	if isMasked && fr.rejectMasked {
+		return Frame{}, fmt.Errorf("%w: masked frame from the server", ErrInvalidFrame)
+	}
+
+	payloadLen := uint64(header[1] & 0x7F)
+	switch payloadLen {
+	case payloadLen16Bit:
+		var ext [2]byte
+		if _, err := io.ReadFull(fr.r, ext[:]); err != nil {
+			return Frame{}, unexpectedEOF(err)
+		}
+		payloadLen = uint64(binary.BigEndian.Uint16(ext[:]))
+
+	case payloadLen64Bit:
+		var ext [8]byte
+		if _, err := io.ReadFull(fr.r, ext[:]); err != nil {
+			return Frame{}, unexpectedEOF(err)
+		}
+		payloadLen = binary.BigEndian.Uint64(ext[:])
+		// The most significant bit must be 0
+		if payloadLen>>63 != 0 {
+			return Frame{}, fmt.Errorf("%w: 64-bit payload length with the high bit set", ErrInvalidFrame)
+		}
+	}
+
+	if err := validateFrameHeader(fin, opcode, payloadLen); err != nil {
+		return Frame{}, err
+	}
+	if payloadLen > fr.maxFrameSize {
+		return Frame{}, fmt.Errorf("%w: %d bytes (max %d)", ErrFrameTooLarge, payloadLen, fr.maxFrameSize)
+	}
+
+	var maskKey [4]byte
+	if isMasked {
+		if _, err := io.ReadFull(fr.r, maskKey[:]); err != nil {
+			return Frame{}, unexpectedEOF(err)
+		}
+	}
+
+	payload := make([]byte, payloadLen)
+	if _, err := io.ReadFull(fr.r, payload); err != nil {
+		return Frame{}, unexpectedEOF(err)
+	}
+
+	if isMasked {
+		maskBytes(payload, maskKey)
+	}
+
+	return Frame{Fin: fin, Rsv: rsv, Opcode: opcode, Payload: payload}, nil
+}
+
+// The stream ended in the middle of a frame
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Text or binary message put back together from its
+// fragments, or a control frame.
+type Message struct {
+	Opcode  byte
+	Payload []byte
+}
+
+/*
+Reassembles fragmented messages: the first frame has
+the opcode (text or binary) and the rest are
+continuation frames until FIN. Control frames may
+come between the fragments and are returned right
+away, while the fragments are kept for the next call.
+*/
+type MessageReader struct {
+	fr             *FrameReader
+	maxMessageSize uint64
+	decompressor   *Decompressor
+
+	fragmentOpcode     byte
+	fragmentCompressed bool
+	fragments          []byte
+	fragmenting        bool
+}
+
+// Nil decompressor means permessage-deflate was
+// not negotiated, so RSV1 is not allowed.
+func NewMessageReader(fr *FrameReader, maxMessageSize uint64, decompressor *Decompressor) *MessageReader {
+	return &MessageReader{fr: fr, maxMessageSize: maxMessageSize, decompressor: decompressor}
+}
+
+// RSV1 is only allowed on the first frame of a
+// message, and only with permessage-deflate.
+func (mr *MessageReader) validateRsv(frame Frame) error {
+	rsv := frame.Rsv
+	if mr.decompressor != nil && !isControl(frame.Opcode) && frame.Opcode != OpcodeContinuation {
+		rsv &^= rsv1
+	}
+
+	if rsv != 0 {
+		return fmt.Errorf("%w: reserved bits 0x%x set (opcode 0x%x)", ErrInvalidFrame, frame.Rsv, frame.Opcode)
+	}
+	return nil
+}
+
+func (mr *MessageReader) ReadMessage() (Message, error) {
+	for {
+		frame, err := mr.fr.ReadFrame()
+		if err != nil {
+			return Message{}, err
+		}
+
+		if err := mr.validateRsv(frame); err != nil {
+			return Message{}, err
+		}
+
+		if isControl(frame.Opcode) {
+			return Message{Opcode: frame.Opcode, Payload: frame.Payload}, nil
+		}
+
+		switch {
+		case frame.Opcode == OpcodeContinuation && !mr.fragmenting:
+			return Message{}, fmt.Errorf("%w: continuation without a message to continue", ErrInvalidFrame)
+		case frame.Opcode != OpcodeContinuation && mr.fragmenting:
+			return Message{}, fmt.Errorf("%w: new message before the end of the fragmented one", ErrInvalidFrame)
+		case frame.Opcode != OpcodeContinuation:
+			mr.fragmentOpcode = frame.Opcode
+			mr.fragmentCompressed = frame.Rsv&rsv1 != 0
+			mr.fragments = mr.fragments[:0]
+		}
+
+		if uint64(len(mr.fragments))+uint64(len(frame.Payload)) > mr.maxMessageSize {
+			return Message{}, fmt.Errorf("%w: more than %d bytes", ErrMessageTooLarge, mr.maxMessageSize)
+		}
+		mr.fragments = append(mr.fragments, frame.Payload...)
+		mr.fragmenting = !frame.Fin
+
+		if !frame.Fin {
+			continue
+		}
+
+		var payload []byte
+		if mr.fragmentCompressed {
+			payload, err = mr.decompressor.Decompress(mr.fragments)
+			if err != nil {
+				return Message{}, err
+			}
+		} else {
+			payload = make([]byte, len(mr.fragments))
+			copy(payload, mr.fragments)
+		}
+
+		if mr.fragmentOpcode == OpcodeText && !utf8.Valid(payload) {
+			return Message{}, ErrInvalidUTF8
+		}
+
+		return Message{Opcode: mr.fragmentOpcode, Payload: payload}, nil
+	}
+}
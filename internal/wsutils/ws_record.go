@@ -0,0 +1,157 @@
+package wsutils
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Direction of a recorded frame
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+var opcodeNames = map[byte]string{
+	OpcodeText:   "text",
+	OpcodeBinary: "binary",
+	OpcodeClose:  "close",
+	OpcodePing:   "ping",
+	OpcodePong:   "pong",
+}
+
+var ErrInvalidRecording = errors.New("invalid ws recording")
+
+/*
+A message or control frame of a recorded session, one
+JSON object per line of the file, e.g.
+
+	{"time":"2024-05-01T10:00:00.5Z","direction":"sent","opcode":"text","data":"hi"}
+
+Text is stored as it is, other payloads (binary, and
+control frames which may have a close code) as base64
+with "encoding": "base64".
+*/
+type RecordedEvent struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Opcode    string    `json:"opcode"`
+	Data      string    `json:"data,omitempty"`
+	Encoding  string    `json:"encoding,omitempty"`
+}
+
+func NewRecordedEvent(direction string, opcode byte, payload []byte) RecordedEvent {
+	event := RecordedEvent{Time: time.Now(), Direction: direction, Opcode: opcodeNames[opcode]}
+	if opcode == OpcodeText {
+		event.Data = string(payload)
+		return event
+	}
+
+	if len(payload) > 0 {
+		event.Data, event.Encoding = base64.StdEncoding.EncodeToString(payload), "base64"
+	}
+	return event
+}
+
+func (e RecordedEvent) OpcodeValue() (byte, bool) {
+	for opcode, name := range opcodeNames {
+		if name == e.Opcode {
+			return opcode, true
+		}
+	}
+	return 0, false
+}
+
+func (e RecordedEvent) Payload() ([]byte, error) {
+	switch e.Encoding {
+	case "":
+		return []byte(e.Data), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(e.Data)
+	}
+	return nil, fmt.Errorf("unknown encoding %q", e.Encoding)
+}
+
+// Writes the events of a session as they happen.
+// Safe to use from the reading and sending goroutines.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// A nil recorder records nothing. After a failed
+// write, the error is kept and nothing more is written.
+func (r *Recorder) Record(direction string, opcode byte, payload []byte) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(NewRecordedEvent(direction, opcode, payload))
+	}
+}
+
+// First error of writing the recording, if any
+func (r *Recorder) Err() error {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// Events must be in the order they happened; empty
+// lines are skipped.
+func ReadRecording(r io.Reader) ([]RecordedEvent, error) {
+	var events []RecordedEvent
+
+	scanner := bufio.NewScanner(r)
+	// Lines are as long as the messages
+	scanner.Buffer(nil, DefaultMaxMessageSize*2)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var event RecordedEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidRecording, lineNum, err)
+		}
+
+		if _, ok := event.OpcodeValue(); !ok {
+			return nil, fmt.Errorf("%w: line %d: unknown opcode %q", ErrInvalidRecording, lineNum, event.Opcode)
+		}
+		if event.Direction != DirectionSent && event.Direction != DirectionReceived {
+			return nil, fmt.Errorf("%w: line %d: unknown direction %q", ErrInvalidRecording, lineNum, event.Direction)
+		}
+		if _, err := event.Payload(); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidRecording, lineNum, err)
+		}
+		if len(events) > 0 && event.Time.Before(events[len(events)-1].Time) {
+			return nil, fmt.Errorf("%w: line %d: time goes back", ErrInvalidRecording, lineNum)
+		}
+
+		events = append(events, event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecording, err)
+	}
+	return events, nil
+}
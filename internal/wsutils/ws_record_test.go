@@ -0,0 +1,81 @@
+package wsutils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRecordingRoundTrip(t *testing.T) {
+	frames := []struct {
+		direction string
+		opcode    byte
+		payload   []byte
+	}{
+		{direction: DirectionSent, opcode: OpcodeText, payload: []byte("hello\nworld")},
+		{direction: DirectionReceived, opcode: OpcodeBinary, payload: []byte{0x00, 0xff, 0x10}},
+		{direction: DirectionSent, opcode: OpcodePing, payload: []byte("gurl-1")},
+		{direction: DirectionReceived, opcode: OpcodePong},
+		{direction: DirectionSent, opcode: OpcodeClose, payload: EncodeClosePayload(CloseNormal, "bye")},
+	}
+
+	var buf bytes.Buffer
+	recorder := NewRecorder(&buf)
+	for _, frame := range frames {
+		recorder.Record(frame.direction, frame.opcode, frame.payload)
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := ReadRecording(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != len(frames) {
+		t.Fatalf("expected: %d events\tgot: %d", len(frames), len(events))
+	}
+
+	for i, event := range events {
+		opcode, ok := event.OpcodeValue()
+		payload, err := event.Payload()
+		if !ok || err != nil {
+			t.Fatalf("event %d: %v %v", i, ok, err)
+		}
+		if event.Direction != frames[i].direction || opcode != frames[i].opcode || !bytes.Equal(payload, frames[i].payload) {
+			t.Fatalf("expected: %s 0x%x %q\tgot: %s 0x%x %q", frames[i].direction, frames[i].opcode, frames[i].payload, event.Direction, opcode, payload)
+		}
+	}
+
+	// Text is readable in the file
+	if events[0].Encoding != "" || events[0].Data != "hello\nworld" {
+		t.Fatalf("expected: text as it is\tgot: %+v", events[0])
+	}
+}
+
+func TestReadRecordingErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		recording string
+	}{
+		{name: "not_json", recording: "{bad\n"},
+		{name: "unknown_opcode", recording: `{"time":"2024-01-01T00:00:00Z","direction":"sent","opcode":"continuation"}`},
+		{name: "unknown_direction", recording: `{"time":"2024-01-01T00:00:00Z","direction":"up","opcode":"text"}`},
+		{name: "invalid_base64", recording: `{"time":"2024-01-01T00:00:00Z","direction":"sent","opcode":"binary","data":"!!","encoding":"base64"}`},
+		{name: "unknown_encoding", recording: `{"time":"2024-01-01T00:00:00Z","direction":"sent","opcode":"binary","data":"00","encoding":"hex"}`},
+		{
+			name: "time_goes_back",
+			recording: `{"time":"2024-01-01T00:00:01Z","direction":"sent","opcode":"text","data":"a"}` + "\n" +
+				`{"time":"2024-01-01T00:00:00Z","direction":"sent","opcode":"text","data":"b"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ReadRecording(strings.NewReader(test.recording)); !errors.Is(err, ErrInvalidRecording) {
+				t.Fatalf("expected: %v\tgot: %v", ErrInvalidRecording, err)
+			}
+		})
+	}
+}
@@ -1,38 +1,35 @@
 package wsutils
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/binary"
+	"crypto/rand"
+	"errors"
 	"fmt"
-	"os"
+	"io"
 )
 
-const (
-	ProtocolWS = iota
-	ProtocolWSS
-)
-
-const (
-	frameFirstByte125OrLess = iota + 125
-	frameFirstByte126
-	frameFirstByte127
-)
+/*
+Every client frame gets a new key from crypto/rand.
+A key that can be predicted lets a page choose the
+bytes on the wire, which is what masking prevents
+(e.g. poisoning the cache of a proxy, RFC 6455 10.3).
+*/
+func newMaskingKey() ([4]byte, error) {
+	var key [4]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return key, fmt.Errorf("failed to generate masking key: %w", err)
+	}
+	return key, nil
+}
 
 /*
-Parses the WebSocker frame read from TCP
-connection. Strips the extra bytes and
-returns the payload.
+Parses a single complete WebSocket frame and returns
+its payload (unmasked if it was masked). The frame
+structure is described in Frame.
 
-This is the structure of a websocket frame (each data that comes)
-  - FIN (1 bit): Indicates if this is the final fragment of a message.
-  - Opcode (4 bits): Specifies the type of data (e.g., text, binary).
-  - Mask (1 bit): Indicates if the payload is masked. If 1, the payload is masked.
-  - Payload length (7 bits): Specifies the length of the payload data.
-    If the length is 0-125, it directly represents the payload length.
-    If it is 126, the next 2 bytes represent the payload length.
-    If it is 127, the next 8 bytes represent the payload length.
-  - Masking key (4 bytes, if Mask is 1): A key used to unmask the payload.
-  - Payload data: The actual message data (text or binary).
+Streams should be read with FrameReader since a read
+may have part of a frame or several frames.
 */
 func ParseWsFrame(frame []byte) ([]byte, error) {
 	// The first two bytes are needed to determine
@@ -42,115 +39,29 @@ func ParseWsFrame(frame []byte) ([]byte, error) {
 		return nil, fmt.Errorf("ws frames must be at least 2 bytes")
 	}
 
-	// AND operation on 128 (0x80) and second byte of frame.
-	// Checks the most significant bit. If that's 1, it means
-	// that the payload is masked (needs a key to unmask)
-	isMasked := (frame[1] & 0x80) != 0
-
-	// AND operation on 127 (0x7F) and second byte of frame.
-	// Extracts the lower 7 bits of the second byte which
-	// shows the length of the payload.
-	//
-	// if 0-125 => It is itself the length of payload
-	// if 126 => the next 2 bytes represent the length
-	// if 127 => the next 8 bytes represent the length
-	payloadLen := int(frame[1] & 0x7F)
-
-	// Declaring an offset to trace our position
-	// in frame slice of bytes.
-	offset := 2
-
-	switch payloadLen {
-	case frameFirstByte125OrLess:
-		// No action required
-
-	case frameFirstByte126:
-		// Reads the next 2 bytes and interpret them as
-		// a 16-bit integer
-		//
-		// alternative solution:
-		// int(frame[2])<<8 | int(frame[3])
-		if len(frame) < 4 {
-			return nil, fmt.Errorf("frame too short for extended payload length")
-		}
-		payloadLen = int(binary.BigEndian.Uint16(frame[2:4]))
-		offset += 2
-
-	case frameFirstByte127:
-		// Reads the next 8 bytes and interpret them as
-		// a 64-bit integer
-		if len(frame) < 10 {
-			return nil, fmt.Errorf("frame too short for 64-bit payload length")
-		}
-
-		payloadLen = int(binary.BigEndian.Uint64(frame[2:10]))
-		offset += 2
-	}
-
-	// Now we have the payload length, we need to make sure
-	// frame is long enough to have the payload!
-	if payloadLen+offset > len(frame) {
+	fr := NewFrameReader(bufio.NewReader(bytes.NewReader(frame)), uint64(len(frame)))
+	f, err := fr.ReadFrame()
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
 		return nil, fmt.Errorf("frame too short to read payload")
 	}
-
-	// we want to extract masking ket ([]byte) if
-	// the payload was masked. It should exist in
-	// the next 4 bytes after payload length.
-	var maskKey []byte
-	if isMasked {
-		if len(frame) < offset+4 {
-			return nil, fmt.Errorf("frame too short to contain mask key")
-		}
-
-		maskKey = frame[offset : offset+4]
-		offset += 4
-	}
-
-	// Now we're at the position of payload
-	payload := frame[offset : offset+payloadLen]
-
-	// If isMasked, then we use the key to unmask
-	// unmasking is done through XORing each byte
-	// of payload with a corresponding byte from
-	// the 4-byte mask key. If the length of payload
-	// is more, the key is used in a cyclic manner.
-	if isMasked {
-		for i := 0; i < payloadLen; i++ {
-			// ^ is XOR sign
-			payload[i] ^= maskKey[i%4]
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	return payload, nil
+	return f.Payload, nil
 }
 
-func CreateWsFrame(payload []byte) []byte {
-	payloadLen := len(payload)
-	if payloadLen > 125 {
-		fmt.Println("for now it's too long of a payload")
-		os.Exit(1)
+// Masked frame with FIN set, of any length. opcode
+// is OpcodeText or OpcodeBinary. The payload is
+// masked in the frame; the given slice isn't changed.
+func CreateWsFrame(opcode byte, payload []byte) ([]byte, error) {
+	if opcode != OpcodeText && opcode != OpcodeBinary {
+		return nil, fmt.Errorf("%w: opcode 0x%x is not text or binary", ErrInvalidFrame, opcode)
 	}
 
-	var frame bytes.Buffer
-	// FIN + RSV (1 2 3) + OPCODE (1 is for text)
-	// TODO: Adding feature for other types of messages
-	firstByte := byte(0b10000001)
-	frame.WriteByte(firstByte)
-
-	// MASK + len of payload
-	secondByte := byte(0b10000000 | payloadLen)
-	// masking
-	maskingKey := []byte{0x37, 0xfa, 0x21, 0x3d}
-	for i := range payload {
-		payload[i] ^= maskingKey[i%4]
+	maskKey, err := newMaskingKey()
+	if err != nil {
+		return nil, err
 	}
-	frame.WriteByte(secondByte)
-
-	// Add the masking key to frame
-	frame.Write(maskingKey)
-
-	// Append the payload to the end of the frame
-	frame.Write(payload)
-
-	return frame.Bytes()
+	return EncodeFrame(Frame{Fin: true, Opcode: opcode, Payload: payload}, &maskKey), nil
 }
@@ -0,0 +1,109 @@
+package wsutils
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// Messages larger than this are sent in fragments
+// by the client unless set otherwise.
+const DefaultFragmentSize = 1 << 20
+
+// No message may follow the close frame (RFC 6455 5.5.1)
+var ErrCloseSent = errors.New("close frame already sent")
+
+/*
+Writes the frames of the client, which are always
+masked with a new key. It's safe to use from several goroutines
+(e.g. a pong while a message is sent): the frames of
+a message are written before any other frame.
+*/
+type FrameWriter struct {
+	mu           sync.Mutex
+	w            io.Writer
+	fragmentSize int
+	compressor   *Compressor
+	closeSent    bool
+}
+
+// Zero fragmentSize sends every message in one frame.
+// Nil compressor sends messages without compression.
+func NewFrameWriter(w io.Writer, fragmentSize int, compressor *Compressor) *FrameWriter {
+	return &FrameWriter{w: w, fragmentSize: fragmentSize, compressor: compressor}
+}
+
+func (fw *FrameWriter) WriteFrame(f Frame) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	return fw.writeFrame(f)
+}
+
+// Waits for the message being written, if any
+func (fw *FrameWriter) CloseSent() bool {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	return fw.closeSent
+}
+
+func (fw *FrameWriter) writeFrame(f Frame) error {
+	if fw.closeSent && !isControl(f.Opcode) {
+		return ErrCloseSent
+	}
+	if f.Opcode == OpcodeClose {
+		fw.closeSent = true
+	}
+
+	maskKey, err := newMaskingKey()
+	if err != nil {
+		return err
+	}
+
+	_, err = fw.w.Write(EncodeFrame(f, &maskKey))
+	return err
+}
+
+/*
+Text or binary message. Over fragmentSize, the first
+frame has the opcode and the rest are continuation
+frames, the last one with FIN. With compression, the
+first frame has RSV1 and the size is the compressed one.
+*/
+func (fw *FrameWriter) WriteMessage(opcode byte, payload []byte) error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	// Compressed under the lock since with context
+	// takeover, the order must be the order sent.
+	var rsv byte
+	if fw.compressor != nil {
+		compressed, ok, err := fw.compressor.Compress(payload)
+		if err != nil {
+			return err
+		}
+		if ok {
+			payload, rsv = compressed, rsv1
+		}
+	}
+
+	if fw.fragmentSize <= 0 || len(payload) <= fw.fragmentSize {
+		return fw.writeFrame(Frame{Fin: true, Rsv: rsv, Opcode: opcode, Payload: payload})
+	}
+
+	for offset := 0; offset < len(payload); offset += fw.fragmentSize {
+		end := min(offset+fw.fragmentSize, len(payload))
+
+		frame := Frame{Fin: end == len(payload), Opcode: OpcodeContinuation, Payload: payload[offset:end]}
+		if offset == 0 {
+			frame.Opcode, frame.Rsv = opcode, rsv
+		}
+
+		if err := fw.writeFrame(frame); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package gurl
+
+import (
+	"context"
+	"io"
+
+	"github.com/saeidalz13/gurl/internal/domainparser"
+	"github.com/saeidalz13/gurl/internal/httpconstants"
+	"github.com/saeidalz13/gurl/internal/methodparser"
+)
+
+// Content-Type of the body
+const (
+	DataTypeJSON = httpconstants.DataTypeJson
+	DataTypeText = httpconstants.DataTypeText
+)
+
+/*
+Decides where the body of a response goes once its
+status code and headers ("Name: value") arrived, e.g.
+a file for successful responses. A nil writer keeps
+the body in Response.Body.
+
+It's called for every response, including redirects
+and retries.
+*/
+type BodyWriterFunc func(statusCode string, header []string) (io.Writer, error)
+
+/*
+Request to be sent with Client.Do. URL may omit the
+scheme, which defaults to https. Body is only sent
+for POST, PUT and PATCH, with the Content-Type of
+DataType. Cookies (e.g. "name1=value1; name2=value2")
+are sent along with the ones from the jar of the client.
+
+Header lines are in format of "Name: value". With
+BodyWriter, bodies are streamed instead of being kept
+in memory (see BodyWriterFunc).
+*/
+type Request struct {
+	Method     string
+	URL        string
+	Body       string
+	DataType   uint8
+	Cookies    string
+	Header     []string
+	BodyWriter BodyWriterFunc
+
+	ctx         context.Context
+	authScheme  string
+	user        string
+	password    string
+	bearerToken string
+}
+
+// Method and URL are validated here, so invalid ones
+// fail before anything is sent.
+func NewRequest(ctx context.Context, method, rawURL string) (Request, error) {
+	req := Request{Method: method, URL: rawURL, ctx: ctx}
+
+	if _, _, err := req.parse(); err != nil {
+		return Request{}, err
+	}
+
+	return req, nil
+}
+
+// Background context if none was given
+func (r Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+func (r Request) WithContext(ctx context.Context) Request {
+	r.ctx = ctx
+	return r
+}
+
+func (r Request) parse() (string, domainparser.DomainParser, error) {
+	method, err := methodparser.ParseMethod(r.Method)
+	if err != nil {
+		return "", domainparser.DomainParser{}, err
+	}
+
+	dp := domainparser.NewDomainParser(r.URL)
+	if err := dp.Parse(); err != nil {
+		return "", domainparser.DomainParser{}, err
+	}
+
+	return method, dp, nil
+}
+
+func (r *Request) SetBasicAuth(user, password string) {
+	r.authScheme, r.user, r.password = httpconstants.AuthSchemeBasic, user, password
+}
+
+// The request is sent first without credentials to get
+// the challenge of the server, then again with them.
+func (r *Request) SetDigestAuth(user, password string) {
+	r.authScheme, r.user, r.password = httpconstants.AuthSchemeDigest, user, password
+}
+
+func (r *Request) SetBearerToken(token string) {
+	r.authScheme, r.bearerToken = httpconstants.AuthSchemeBearer, token
+}
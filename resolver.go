@@ -0,0 +1,41 @@
+package gurl
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/saeidalz13/gurl/api/conninfo"
+)
+
+// Resolver finds the IP address of a host
+// (domain without port) to connect to.
+type Resolver interface {
+	LookupIP(ctx context.Context, host string) (net.IP, error)
+}
+
+// Adapter to use a function as a Resolver
+type ResolverFunc func(ctx context.Context, host string) (net.IP, error)
+
+func (f ResolverFunc) LookupIP(ctx context.Context, host string) (net.IP, error) {
+	return f(ctx, host)
+}
+
+/*
+DNSResolver sends its own DNS queries to 8.8.8.8 over
+UDP instead of using the resolver of the system. IPs
+of localhost and IP addresses are returned as they are.
+
+With CacheDir, the IP of each domain is stored in a
+file there and reused without a DNS query next time.
+*/
+type DNSResolver struct {
+	CacheDir string
+}
+
+func (r DNSResolver) LookupIP(ctx context.Context, host string) (net.IP, error) {
+	resolver := conninfo.NewConnInfoResolver(r.CacheDir, host, strings.Split(host, "."), 0)
+
+	ip, _, err := resolver.LookupIP(ctx)
+	return ip, err
+}
@@ -0,0 +1,89 @@
+package gurl
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"github.com/saeidalz13/gurl/api/http"
+)
+
+/*
+Request as it was sent for the response, with the
+credentials masked. Line is the request line (empty
+for HTTP/2, where the pseudo headers such as ":path"
+are in Header instead).
+*/
+type SentRequest struct {
+	Proto  string
+	Line   string
+	Header []string
+	Body   string
+}
+
+/*
+Final response of Client.Do. Proto is "HTTP/1.1" or
+"HTTP/2", and Status is the status message (empty for
+HTTP/2). Header lines are in format of "Name: value".
+
+URL is the one that responded (after redirects) and
+RemoteIP is empty behind a proxy since it resolves
+the IP. TLS is nil without TLS.
+
+BodySize is in bytes and also counts a body written
+to Request.BodyWriter, which is not in Body.
+*/
+type Response struct {
+	Proto      string
+	StatusCode string
+	Status     string
+	Header     []string
+	Body       string
+	BodySize   int64
+
+	URL        string
+	Redirects  int
+	RemoteIP   string
+	RemotePort int
+	Timing     Timing
+	TLS        *tls.ConnectionState
+	Request    SentRequest
+
+	parser http.HTTPResponseParser
+}
+
+func newResponse(parser http.HTTPResponseParser) *Response {
+	return &Response{
+		Proto:      parser.Version(),
+		StatusCode: parser.StatusCode(),
+		Status:     parser.StatusMsg(),
+		Header:     parser.Headers(),
+		Body:       parser.Body(),
+		BodySize:   int64(len(parser.Body())),
+		parser:     parser,
+	}
+}
+
+// Header names are case-insensitive and the same
+// header may appear more than once.
+func (r *Response) HeaderValues(name string) []string {
+	return r.parser.HeaderValues(name)
+}
+
+// Prints the body, and with verbose the status
+// and headers too, the same way as the command line.
+// Unless raw, the body is formatted by its Content-Type.
+func (r *Response) Print(verbose, raw bool) {
+	r.parser.Print(verbose, raw)
+}
+
+// Size of the status line and headers as
+// HTTP/1.1 text (HTTP/2 compresses them).
+func (r *Response) HeaderSize() int {
+	statusLine := strings.TrimSpace(r.Proto + " " + r.StatusCode + " " + r.Status)
+	size := len(statusLine) + len("\r\n")
+	for _, h := range r.Header {
+		size += len(h) + len("\r\n")
+	}
+	// Empty line before the body
+	return size + len("\r\n")
+}
@@ -0,0 +1,85 @@
+package gurl
+
+import (
+	"time"
+
+	"github.com/saeidalz13/gurl/api/tcp"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+)
+
+/*
+Timing of the connection that received the response.
+Each field is the time passed since the connection
+started until the phase ended (like the -w variables
+of cURL), or zero if the phase did not happen:
+
+  - DNSLookup: zero behind a proxy (it resolves the IP)
+  - Connect: TCP connected, with the proxy handshake
+  - TLSHandshake: zero without TLS
+  - RequestSent: request fully written
+  - FirstByte: first byte of the response received
+  - Done: response fully read
+
+After a retry or a Digest challenge, it's the timing
+of the last connection. Total is the whole Do call,
+including redirects and retries.
+*/
+type Timing struct {
+	DNSLookup    time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	RequestSent  time.Duration
+	FirstByte    time.Duration
+	Done         time.Duration
+	Total        time.Duration
+}
+
+func newTiming(trace *tcp.Trace, total time.Duration) Timing {
+	if trace == nil {
+		return Timing{Total: total}
+	}
+
+	return Timing{
+		DNSLookup:    trace.DNSLookup,
+		Connect:      trace.Connect,
+		TLSHandshake: trace.TLSHandshake,
+		RequestSent:  trace.RequestSent,
+		FirstByte:    trace.FirstByte,
+		Done:         trace.Done,
+		Total:        total,
+	}
+}
+
+// Phases that happened, each starting where
+// the previous one ended.
+func (t Timing) phases() []terminalutils.TimingPhase {
+	ends := []struct {
+		name string
+		end  time.Duration
+	}{
+		{"DNS lookup", t.DNSLookup},
+		{"TCP connect", t.Connect},
+		{"TLS handshake", t.TLSHandshake},
+		{"Request sent", t.RequestSent},
+		{"Server wait", t.FirstByte},
+		{"Content transfer", t.Done},
+	}
+
+	phases := make([]terminalutils.TimingPhase, 0, len(ends))
+	var start time.Duration
+	for _, e := range ends {
+		if e.end == 0 {
+			continue
+		}
+		phases = append(phases, terminalutils.TimingPhase{Name: e.name, Start: start, End: e.end})
+		start = e.end
+	}
+
+	return phases
+}
+
+// Prints the phases as a waterfall, the
+// same way as the command line in verbose.
+func (t Timing) Print() {
+	terminalutils.PrintTimingWaterfall(t.phases(), t.Total)
+}
@@ -0,0 +1,52 @@
+package gurl
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+)
+
+func TestTimingPhases(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		name     string
+		timing   Timing
+		expected []terminalutils.TimingPhase
+	}{
+		{
+			name:   "tls",
+			timing: Timing{DNSLookup: 10 * ms, Connect: 30 * ms, TLSHandshake: 70 * ms, RequestSent: 71 * ms, FirstByte: 120 * ms, Done: 130 * ms},
+			expected: []terminalutils.TimingPhase{
+				{Name: "DNS lookup", Start: 0, End: 10 * ms},
+				{Name: "TCP connect", Start: 10 * ms, End: 30 * ms},
+				{Name: "TLS handshake", Start: 30 * ms, End: 70 * ms},
+				{Name: "Request sent", Start: 70 * ms, End: 71 * ms},
+				{Name: "Server wait", Start: 71 * ms, End: 120 * ms},
+				{Name: "Content transfer", Start: 120 * ms, End: 130 * ms},
+			},
+		},
+		{
+			// Proxy resolves the IP and no TLS
+			name:   "proxy_without_tls",
+			timing: Timing{Connect: 30 * ms, RequestSent: 31 * ms, FirstByte: 50 * ms, Done: 60 * ms},
+			expected: []terminalutils.TimingPhase{
+				{Name: "TCP connect", Start: 0, End: 30 * ms},
+				{Name: "Request sent", Start: 30 * ms, End: 31 * ms},
+				{Name: "Server wait", Start: 31 * ms, End: 50 * ms},
+				{Name: "Content transfer", Start: 50 * ms, End: 60 * ms},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			phases := test.timing.phases()
+			if !reflect.DeepEqual(phases, test.expected) {
+				t.Fatalf("expected: %v\tgot: %v", test.expected, phases)
+			}
+		})
+	}
+}
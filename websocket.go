@@ -0,0 +1,205 @@
+package gurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/saeidalz13/gurl/api/apperrors"
+	"github.com/saeidalz13/gurl/api/http"
+	"github.com/saeidalz13/gurl/api/tcp"
+	"github.com/saeidalz13/gurl/api/ws"
+	"github.com/saeidalz13/gurl/internal/domainparser"
+	"github.com/saeidalz13/gurl/internal/terminalutils"
+	"github.com/saeidalz13/gurl/internal/wsutils"
+)
+
+// Settings of a WebSocket session (see tcp.WebSocketOptions)
+type WebSocketOptions = tcp.WebSocketOptions
+
+// Non-interactive session (see tcp.WebSocketScript)
+type WebSocketScript = tcp.WebSocketScript
+
+// Replay of a recorded session, made with
+// tcp.NewWebSocketReplay
+type WebSocketReplay = tcp.WebSocketReplay
+
+/*
+Opens an interactive WebSocket session to rawURL
+(ws:// or wss://). Lines typed in the terminal are
+sent as text messages (or run commands, e.g. /hex to
+send binary) and the messages of the server are
+printed, until either side closes the session or
+ctx is done (then it's closed with 1000).
+
+It returns nil for a normal closure, otherwise
+apperrors.WebSocketCloseError with the close code.
+*/
+func (c *Client) WebSocketSession(ctx context.Context, rawURL string, opts WebSocketOptions) error {
+	dp := domainparser.NewDomainParser(rawURL)
+	if err := dp.Parse(); err != nil {
+		return err
+	}
+
+	if !domainparser.IsWebSocket(dp.Protocol) {
+		return apperrors.URLError{URL: rawURL, Reason: "websocket url must start with ws:// or wss://"}
+	}
+
+	connInfo, tcm, _, err := c.prepareConn(ctx, dp, c.Timeouts.start())
+	if err != nil {
+		return err
+	}
+
+	if err := tcm.InitTCPConn(ctx); err != nil {
+		return err
+	}
+	defer tcm.Close()
+
+	secWsKey, err := ws.GenerateSecWebSocketKey()
+	if err != nil {
+		return err
+	}
+
+	var jarCookies string
+	if c.Jar != nil {
+		jarCookies = c.Jar.CookieHeader(dp.Domain, dp.Path, connInfo.IsTls)
+	}
+
+	headers, err := handshakeHeaders(opts, jarCookies)
+	if err != nil {
+		return err
+	}
+	wsRequest := ws.GenerateWebSocketRequest(dp.Domain, dp.Path, secWsKey, headers)
+
+	if c.Verbose {
+		terminalutils.PrintWebSocketClientInfo(serverIP(connInfo), http.MaskCredentials(wsRequest))
+	}
+
+	wc, err := tcm.OpenWebSocket(wsRequest, secWsKey, c.Verbose, opts)
+	if err != nil {
+		terminalutils.PrintWsClose(err.Error())
+		return err
+	}
+
+	if c.Jar != nil {
+		storeResponseCookies(c.Jar, wc.Handshake().Values("Set-Cookie"), dp.Domain, dp.Path, connInfo.IsTls, c.Verbose)
+	}
+
+	readDone := make(chan error, 1)
+	go func() { readDone <- wc.ReadMessages() }()
+
+	switch {
+	case opts.Replay != nil:
+		err = wc.RunReplay(ctx, readDone)
+	case opts.Script != nil:
+		err = wc.RunScript(ctx, readDone)
+	default:
+		err = interactiveSession(ctx, wc, readDone, opts.HistoryFile)
+	}
+
+	if recordErr := wc.RecordErr(); recordErr != nil {
+		terminalutils.PrintAppWarning(fmt.Sprintf("recording of the session is incomplete: %v", recordErr))
+	}
+
+	if err != nil {
+		terminalutils.PrintWsClose(err.Error())
+	} else {
+		terminalutils.PrintWsClose("websocket closed normally")
+	}
+	return err
+}
+
+/*
+Messages are typed in the terminal until the session
+is closed by either side. In a terminal, the line can
+be edited while the messages of the server are printed
+above it; otherwise (e.g. piped) lines are read as
+they are.
+*/
+func interactiveSession(ctx context.Context, wc *tcp.WebSocketConn, readDone <-chan error, historyFile string) error {
+	readLine := terminalutils.GetWsInputFromStdin
+	if terminalutils.CanEditLines() {
+		editor, err := terminalutils.StartLineEditor(historyFile)
+		if err != nil {
+			terminalutils.PrintAppWarning(fmt.Sprintf("line editing is disabled: %v", err))
+		} else {
+			defer editor.Close()
+			readLine = editor.ReadLine
+		}
+	}
+
+	writeDone := make(chan error, 1)
+	go func() { writeDone <- wc.SendInput(readLine) }()
+
+	var err error
+	select {
+	case err = <-readDone:
+
+	case err = <-writeDone:
+		// nil after /close
+		if err == nil {
+			err = wc.AwaitClose(readDone)
+		}
+
+	case <-ctx.Done():
+		// e.g. Ctrl-C
+		if err = wc.Close(wsutils.CloseNormal, ""); err == nil {
+			err = wc.AwaitClose(readDone)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+// Set by the handshake itself, so -H can't change them
+var handshakeOnlyHeaders = []string{
+	"Host",
+	"Upgrade",
+	"Connection",
+	"Sec-WebSocket-Key",
+	"Sec-WebSocket-Version",
+	"Sec-WebSocket-Extensions",
+	"Sec-WebSocket-Protocol",
+}
+
+// Headers of the upgrade request after the ones
+// every handshake has.
+func handshakeHeaders(opts WebSocketOptions, jarCookies string) ([]string, error) {
+	headers := make([]string, 0, len(opts.Header)+4)
+
+	if !opts.DisableCompression {
+		headers = append(headers, "Sec-WebSocket-Extensions: "+wsutils.DeflateOffer())
+	}
+
+	for _, subprotocol := range opts.Subprotocols {
+		if subprotocol == "" || strings.ContainsAny(subprotocol, " ,;\t\"") {
+			return nil, apperrors.UsageError{Reason: fmt.Sprintf("invalid subprotocol: %q", subprotocol)}
+		}
+	}
+	if len(opts.Subprotocols) > 0 {
+		headers = append(headers, "Sec-WebSocket-Protocol: "+strings.Join(opts.Subprotocols, ", "))
+	}
+
+	if opts.Origin != "" {
+		headers = append(headers, "Origin: "+opts.Origin)
+	}
+
+	if cookies := joinCookies(opts.Cookies, jarCookies); cookies != "" {
+		headers = append(headers, "Cookie: "+cookies)
+	}
+
+	for _, header := range opts.Header {
+		name, _, _ := strings.Cut(header, ":")
+		for _, reserved := range handshakeOnlyHeaders {
+			if strings.EqualFold(strings.TrimSpace(name), reserved) {
+				return nil, apperrors.UsageError{Reason: fmt.Sprintf("%s is set by the WebSocket handshake and can't be changed", reserved)}
+			}
+		}
+		headers = append(headers, header)
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,166 @@
+package gurl
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/saeidalz13/gurl/api/ws"
+	"github.com/saeidalz13/gurl/internal/wsutils"
+)
+
+func TestHandshakeHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        WebSocketOptions
+		jarCookies  string
+		expected    []string
+		expectedErr bool
+	}{
+		{
+			name:     "default",
+			expected: []string{"Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits"},
+		},
+		{
+			name: "all",
+			opts: WebSocketOptions{
+				Subprotocols:       []string{"graphql-ws", "chat"},
+				Origin:             "https://example.com",
+				Header:             []string{"X-Api-Key: abc"},
+				Cookies:            "a=1",
+				DisableCompression: true,
+			},
+			jarCookies: "b=2",
+			expected: []string{
+				"Sec-WebSocket-Protocol: graphql-ws, chat",
+				"Origin: https://example.com",
+				"Cookie: a=1; b=2",
+				"X-Api-Key: abc",
+			},
+		},
+		{name: "invalid_subprotocol", opts: WebSocketOptions{Subprotocols: []string{"a b"}}, expectedErr: true},
+		{name: "handshake_header", opts: WebSocketOptions{Header: []string{"sec-websocket-key: abc"}}, expectedErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := handshakeHeaders(test.opts, test.jarCookies)
+			if test.expectedErr {
+				if err == nil {
+					t.Fatalf("expected error for %+v", test.opts)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, test.expected) {
+				t.Fatalf("expected: %q\tgot: %q", test.expected, got)
+			}
+		})
+	}
+}
+
+/*
+WebSocket server that echoes text messages until the
+client closes the session. Each handshake sends the
+Host header it was sent on hosts.
+*/
+func echoWebSocketHandler(hosts chan<- string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.Host
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", ws.AcceptKey(r.Header.Get("Sec-WebSocket-Key")))
+
+		// Frames of the server aren't masked
+		sfr := wsutils.NewFrameReader(rw.Reader, wsutils.DefaultMaxFrameSize)
+		for {
+			frame, err := sfr.ReadFrame()
+			if err != nil {
+				return
+			}
+
+			switch frame.Opcode {
+			case wsutils.OpcodeText:
+				conn.Write(wsutils.EncodeFrame(wsutils.Frame{Fin: true, Opcode: wsutils.OpcodeText, Payload: frame.Payload}, nil))
+			case wsutils.OpcodeClose:
+				conn.Write(wsutils.EncodeFrame(wsutils.Frame{Fin: true, Opcode: wsutils.OpcodeClose, Payload: frame.Payload}, nil))
+				return
+			}
+		}
+	})
+}
+
+func TestWebSocketSessionEcho(t *testing.T) {
+	hosts := make(chan string, 1)
+
+	wsServer := httptest.NewServer(echoWebSocketHandler(hosts))
+	defer wsServer.Close()
+	wssServer := httptest.NewTLSServer(echoWebSocketHandler(hosts))
+	defer wssServer.Close()
+
+	// The certificate of the TLS server is for example.com
+	pool := x509.NewCertPool()
+	pool.AddCert(wssServer.Certificate())
+
+	tests := []struct {
+		name   string
+		scheme string
+		server *httptest.Server
+	}{
+		{name: "ws", scheme: "ws", server: wsServer},
+		{name: "wss", scheme: "wss", server: wssServer},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, port, err := net.SplitHostPort(test.server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := NewClient()
+			client.Proxy = nil
+			client.TLSConfig = &tls.Config{RootCAs: pool}
+			client.Resolver = ResolverFunc(func(ctx context.Context, host string) (net.IP, error) {
+				return net.IPv4(127, 0, 0, 1), nil
+			})
+
+			opts := WebSocketOptions{
+				DisableCompression: true,
+				Script: &WebSocketScript{
+					Input:   strings.NewReader("hello\n"),
+					Count:   1,
+					Expect:  regexp.MustCompile("^hello$"),
+					Timeout: 5 * time.Second,
+				},
+			}
+
+			// Not the default port of the protocol
+			rawURL := test.scheme + "://example.com:" + port + "/echo"
+			if err := client.WebSocketSession(context.Background(), rawURL, opts); err != nil {
+				t.Fatal(err)
+			}
+
+			if host := <-hosts; host != "example.com:"+port {
+				t.Fatalf("expected: %s\tgot: %s", "example.com:"+port, host)
+			}
+		})
+	}
+}